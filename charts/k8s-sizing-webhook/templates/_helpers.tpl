@@ -63,3 +63,22 @@ matchExpressions:
   operator: NotIn
   values: [{{ .Release.Name | quote }}]
 {{- end }}
+
+{{/*
+Webhook registration args, the failure policies of the enabled webhooks and the pods excluded from them.
+*/}}
+{{- define "k8s-sizing-webhook.registrationArgs" -}}
+- --webhook-registration
+{{- if not .Values.webhook.tls.bootstrap }}
+- --webhook-registration-ca-bundle-file=/etc/webhook/certs/ca.crt
+{{- end }}
+- --webhook-registration-exclude-labels=app.kubernetes.io/name={{ include "k8s-sizing-webhook.name" . }}
+- --webhook-registration-exclude-labels=app.kubernetes.io/instance={{ .Release.Name }}
+- --webhook-registration-failure-policies=allmark={{ .Values.webhook.mark.failurePolicy }}
+- --webhook-registration-failure-policies=memfix={{ .Values.webhook.memory.failurePolicy }}
+- --webhook-registration-failure-policies=hpamemory={{ .Values.webhook.hpaMemory.failurePolicy }}
+- --webhook-registration-failure-policies=cpubounds={{ .Values.webhook.cpu.failurePolicy }}
+- --webhook-registration-failure-policies=nodefit={{ .Values.webhook.nodeFit.failurePolicy }}
+- --webhook-registration-failure-policies=namespacebudget={{ .Values.webhook.namespaceBudget.failurePolicy }}
+- --webhook-registration-failure-policies=sizinglevel={{ .Values.webhook.sizingLevel.failurePolicy }}
+{{- end }}
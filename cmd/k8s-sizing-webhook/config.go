@@ -1,46 +1,271 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
 	"os"
+	"reflect"
+	"slices"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
+	"sigs.k8s.io/yaml"
 )
 
-// CmdConfig represents the configuration of the command.
+// CmdConfig represents the configuration of the command, the JSON names are the flag names used in the
+// config file. The settings only reference the secrets by path or name, a setting with a secret value must be
+// tagged with `secret:"true"` so it's redacted when printed.
 type CmdConfig struct {
-	Debug                  bool
-	Development            bool
-	WebhookListenAddr      string
-	MetricsListenAddr      string
-	MetricsPath            string
-	TLSCertFilePath        string
-	TLSKeyFilePath         string
-	EnableGuaranteedMemory bool
-	LabelMarks             map[string]string
+	Debug                   bool              `json:"debug"`
+	Development             bool              `json:"development"`
+	WebhookListenAddr       string            `json:"webhook-listen-address"`
+	MetricsListenAddr       string            `json:"metrics-listen-address"`
+	MetricsPath             string            `json:"metrics-path"`
+	TLSCertFilePath         string            `json:"tls-cert-file-path"`
+	TLSKeyFilePath          string            `json:"tls-key-file-path"`
+	TLSReloadInterval       time.Duration     `json:"tls-reload-interval"`
+	TLSMinVersion           string            `json:"tls-min-version"`
+	TLSCipherSuites         []string          `json:"tls-cipher-suites"`
+	TLSCurvePreferences     []string          `json:"tls-curve-preferences"`
+	TLSClientCAFilePath     string            `json:"tls-client-ca-file-path"`
+	TLSBootstrap            bool              `json:"tls-bootstrap"`
+	TLSBootstrapSecret      string            `json:"tls-bootstrap-secret"`
+	ServiceNamespace        string            `json:"service-namespace"`
+	ServiceName             string            `json:"service-name"`
+	WebhookConfigName       string            `json:"webhook-configuration-name"`
+	WebhookRegistration     bool              `json:"webhook-registration"`
+	RegistrationCABundle    string            `json:"webhook-registration-ca-bundle-file"`
+	RegistrationInterval    time.Duration     `json:"webhook-registration-interval"`
+	RegistrationPolicies    map[string]string `json:"webhook-registration-failure-policies"`
+	RegistrationExclude     map[string]string `json:"webhook-registration-exclude-labels"`
+	UnregisterWebhooks      bool              `json:"-"`
+	EnableGuaranteedMemory  bool              `json:"webhook-enable-guaranteed-memory"`
+	EnableHPAMemory         bool              `json:"webhook-enable-hpa-memory"`
+	EnableVPACoordination   bool              `json:"webhook-enable-vpa-coordination"`
+	VPAMode                 string            `json:"webhook-vpa-mode"`
+	LabelMarks              map[string]string `json:"webhook-label-marks"`
+	AnnotationMarks         map[string]string `json:"webhook-annotation-marks"`
+	MarkRules               []string          `json:"webhook-mark-rules"`
+	MarkPodTemplates        bool              `json:"webhook-mark-pod-templates"`
+	MarkMergeStrategy       string            `json:"webhook-mark-merge-strategy"`
+	MarkMergeStrategies     map[string]string `json:"webhook-mark-merge-strategies"`
+	ForbiddenLabels         []string          `json:"webhook-forbidden-labels"`
+	NamespaceLabels         []string          `json:"webhook-namespace-labels"`
+	NamespaceLabelsStrategy string            `json:"webhook-namespace-labels-strategy"`
+	EnableCPUBounds         bool              `json:"webhook-enable-cpu-bounds"`
+	CPUBounds               string            `json:"webhook-cpu-bounds"`
+	CPUNamespaceBounds      map[string]string `json:"webhook-cpu-namespace-bounds"`
+	EnableNodeFit           bool              `json:"webhook-enable-node-fit"`
+	NodeFitMode             string            `json:"webhook-node-fit-mode"`
+	KubeConfigPath          string            `json:"kube-config-path"`
+	PolicyFile              string            `json:"policy-file"`
+	PolicyReloadInterval    time.Duration     `json:"policy-reload-interval"`
+	EnablePolicyCRDs        bool              `json:"enable-policy-crds"`
+	EnableNamespaceBudget   bool              `json:"webhook-enable-namespace-budget"`
+	NamespaceBudget         string            `json:"webhook-namespace-budget"`
+	NamespaceBudgets        map[string]string `json:"webhook-namespace-budgets"`
+	NamespaceBudgetMode     string            `json:"webhook-namespace-budget-mode"`
+	EnableSizingLevels      bool              `json:"webhook-enable-sizing-levels"`
+	ConfigFile              string            `json:"-"`
+	PrintConfig             bool              `json:"-"`
 }
 
 // NewCmdConfig returns a new command configuration.
 func NewCmdConfig() (*CmdConfig, error) {
+	return newCmdConfig(os.Args[1:])
+}
+
+func newCmdConfig(args []string) (*CmdConfig, error) {
 	c := &CmdConfig{
-		LabelMarks: map[string]string{},
+		LabelMarks:           map[string]string{},
+		AnnotationMarks:      map[string]string{},
+		MarkMergeStrategies:  map[string]string{},
+		CPUNamespaceBounds:   map[string]string{},
+		NamespaceBudgets:     map[string]string{},
+		RegistrationPolicies: map[string]string{},
+		RegistrationExclude:  map[string]string{},
 	}
 	app := kingpin.New("k8s-sizing-webhook", "A Kubernetes production-ready admission webhook example.")
 	app.Version(Version)
+	// Every flag can be set with its K8S_SIZING_WEBHOOK_* environment variable (e.g K8S_SIZING_WEBHOOK_DEBUG).
+	app.DefaultEnvars()
+	app.HelpFlag.NoEnvar()
+	app.VersionFlag.NoEnvar()
+
+	app.Flag("config-file", "the path of a YAML file with the settings by flag name, the flags and environment variables take precedence over it.").StringVar(&c.ConfigFile)
+	app.Flag("print-config", "prints the effective configuration, with the secrets redacted, and exits.").BoolVar(&c.PrintConfig)
 
 	app.Flag("debug", "Enable debug mode.").BoolVar(&c.Debug)
 	app.Flag("development", "Enable development mode.").BoolVar(&c.Development)
 	app.Flag("webhook-listen-address", "the address where the HTTPS server will be listening to serve the webhooks.").Default(":8080").StringVar(&c.WebhookListenAddr)
 	app.Flag("metrics-listen-address", "the address where the HTTP server will be listening to serve metrics, healthchecks, profiling...").Default(":8081").StringVar(&c.MetricsListenAddr)
 	app.Flag("metrics-path", "the path where Prometheus metrics will be served.").Default("/metrics").StringVar(&c.MetricsPath)
+	app.Flag("kube-config-path", "the path of the kubeconfig used to connect to the Kubernetes API, if empty the in-cluster configuration will be used.").StringVar(&c.KubeConfigPath)
+	app.Flag("policy-file", "the path of the YAML sizing policy, its ordered rules replace the label marks and guaranteed memory flags.").StringVar(&c.PolicyFile)
+	app.Flag("policy-reload-interval", "how often the policy file is checked for changes, it's also reloaded on SIGHUP.").Default("10s").DurationVar(&c.PolicyReloadInterval)
+	app.Flag("enable-policy-crds", "enables the SizingPolicy and ClusterSizingPolicy resources, they take precedence over the policy file.").BoolVar(&c.EnablePolicyCRDs)
 	app.Flag("tls-cert-file-path", "the path for the webhook HTTPS server TLS cert file.").StringVar(&c.TLSCertFilePath)
 	app.Flag("tls-key-file-path", "the path for the webhook HTTPS server TLS key file.").StringVar(&c.TLSKeyFilePath)
-	app.Flag("webhook-label-marks", "a map of labels the webhook will set to all resources, if no labels, the label marker webhook will be disabled. Can repeat flag").Short('l').StringMapVar(&c.LabelMarks)
+	app.Flag("tls-reload-interval", "how often the TLS cert and key files are checked for changes (e.g rotated by cert-manager).").Default("10s").DurationVar(&c.TLSReloadInterval)
+	app.Flag("tls-min-version", "the minimum TLS version of the webhook HTTPS server.").Default("1.2").EnumVar(&c.TLSMinVersion, "1.2", "1.3")
+	app.Flag("tls-cipher-suites", "a TLS 1.2 cipher suite of the webhook HTTPS server (e.g 'TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256'), the Go defaults if none. Can repeat flag").StringsVar(&c.TLSCipherSuites)
+	app.Flag("tls-curve-preferences", "a key exchange curve of the webhook HTTPS server (X25519, P256, P384 or P521) in order of preference, the Go defaults if none. Can repeat flag").StringsVar(&c.TLSCurvePreferences)
+	app.Flag("tls-client-ca-file-path", "the path of the PEM CA the client certificates are verified against, if set only the clients with a certificate signed by it (e.g the API server) can call the webhooks.").StringVar(&c.TLSClientCAFilePath)
+	app.Flag("tls-bootstrap", "generates the CA and the serving certificate, stores them in the bootstrap secret and sets the CA on the webhook configuration, instead of the TLS cert and key files.").BoolVar(&c.TLSBootstrap)
+	app.Flag("tls-bootstrap-secret", "the name of the secret where the bootstrapped certificates are stored.").Default("k8s-sizing-webhook-certs").StringVar(&c.TLSBootstrapSecret)
+	app.Flag("service-namespace", "the namespace of the webhook service and the bootstrap secret, used by the TLS bootstrap and the webhook registration.").StringVar(&c.ServiceNamespace)
+	app.Flag("service-name", "the name of the webhook service, the bootstrapped serving certificate is valid for its DNS names and the registered webhooks call it.").Default("k8s-sizing-webhook").StringVar(&c.ServiceName)
+	app.Flag("webhook-configuration-name", "the name of the MutatingWebhookConfiguration and ValidatingWebhookConfiguration, registered or whose caBundle is set to the bootstrapped CA.").Default("k8s-sizing-webhook").StringVar(&c.WebhookConfigName)
+	app.Flag("webhook-registration", "creates and updates the webhook configurations with the enabled webhooks, instead of deploying them.").BoolVar(&c.WebhookRegistration)
+	app.Flag("webhook-registration-ca-bundle-file", "the path of the PEM CA that signed the TLS cert file, set as the registered webhooks caBundle, if empty their caBundle is kept (e.g set by the TLS bootstrap or cert-manager).").StringVar(&c.RegistrationCABundle)
+	app.Flag("webhook-registration-interval", "how often the registered webhook configurations are reconciled.").Default("1m").DurationVar(&c.RegistrationInterval)
+	app.Flag("webhook-registration-failure-policies", "a map of webhooks and the failure policy (Fail or Ignore) that replaces their default one (e.g 'nodefit=Fail'). Can repeat flag").StringMapVar(&c.RegistrationPolicies)
+	app.Flag("webhook-registration-exclude-labels", "a map of the webhook pod labels, the resources with them are not sent to the registered webhooks so the webhook can always be deployed. Can repeat flag").StringMapVar(&c.RegistrationExclude)
+	app.Flag("unregister-webhooks", "deletes the webhook configurations and exits, on uninstall (e.g from a Helm pre-delete hook).").BoolVar(&c.UnregisterWebhooks)
+	app.Flag("webhook-label-marks", "a map of labels the webhook will set to all resources, the values can be templates (e.g '{{ .Namespace }}'), if no labels, the label marker webhook will be disabled. Can repeat flag").Short('l').StringMapVar(&c.LabelMarks)
+	app.Flag("webhook-annotation-marks", "a map of annotations the webhook will set to all resources, together with the label marks or the policy marks, the values can be templates (e.g '{{ .UserInfo.Username }}'). Can repeat flag").StringMapVar(&c.AnnotationMarks)
+	app.Flag("webhook-mark-rules", "a YAML or JSON marking rule, with the kinds, namespaces, namespaceSelector and objectSelector of the resources it sets its labels and annotations to (e.g '{\"namespaces\": [\"prod-*\"], \"labels\": {\"pci\": \"true\"}}'). Can repeat flag").StringsVar(&c.MarkRules)
+	app.Flag("webhook-mark-pod-templates", "also marks the pod templates of the workloads, except the labels of their pod selector").BoolVar(&c.MarkPodTemplates)
+	app.Flag("webhook-mark-merge-strategy", "how the marks are merged with the existing labels and annotations, overwrite sets the mark, keep-existing keeps the existing value, deny-on-differ denies the resources with a different value.").Default("overwrite").EnumVar(&c.MarkMergeStrategy, "overwrite", "keep-existing", "deny-on-differ")
+	app.Flag("webhook-mark-merge-strategies", "a map of the merge strategies by mark key, instead of the merge strategy (e.g 'team=keep-existing'). Can repeat flag").StringMapVar(&c.MarkMergeStrategies)
+	app.Flag("webhook-forbidden-labels", "a label key, or a prefix ending with '*' (e.g 'sizing.bitteeinbit.dev/*'), removed from the resources unless set by the marks. Can repeat flag").StringsVar(&c.ForbiddenLabels)
+	app.Flag("webhook-namespace-labels", "a namespace label key the webhook will copy from the namespaces to their resources and the pod templates of their workloads (e.g 'cost-center'). Can repeat flag").StringsVar(&c.NamespaceLabels)
+	app.Flag("webhook-namespace-labels-strategy", "how the namespace labels are merged with the existing resource labels, overwrite, keep-existing or deny-on-differ.").Default("overwrite").EnumVar(&c.NamespaceLabelsStrategy, "overwrite", "keep-existing", "deny-on-differ")
 	app.Flag("webhook-enable-guaranteed-memory", "enables a webhook which ensures memory request is equal to memory limit.").Short('m').BoolVar(&c.EnableGuaranteedMemory)
+	app.Flag("webhook-enable-hpa-memory", "enables the warnings for the HPAs whose memory utilization target is skewed by the guaranteed memory webhook raising the requests, and the webhook which adjusts those targets.").BoolVar(&c.EnableHPAMemory)
+	app.Flag("webhook-enable-vpa-coordination", "enables the guaranteed memory webhook coordination with the VerticalPodAutoscalers in Auto, Recreate or Initial mode, requires the VPA CRD.").BoolVar(&c.EnableVPACoordination)
+	app.Flag("webhook-vpa-mode", "how the memory of the VPA managed workloads is fixed, skip leaves it to the VPA, recommendation uses the VPA recommendation as request and limit, enforce sets the limit to the VPA request.").Default("skip").EnumVar(&c.VPAMode, "skip", "recommendation", "enforce")
+	app.Flag("webhook-enable-cpu-bounds", "enables a webhook which validates the CPU limit to request ratio and the CPU minimum and maximum of every container.").BoolVar(&c.EnableCPUBounds)
+	app.Flag("webhook-cpu-bounds", "the default CPU bounds in 'ratio=4,min=100m,max=2,mode=deny|warn' format, all keys are optional.").StringVar(&c.CPUBounds)
+	app.Flag("webhook-cpu-namespace-bounds", "a map of namespaces and the CPU bounds that replace the default ones on that namespace, same format as the default bounds. Can repeat flag").StringMapVar(&c.CPUNamespaceBounds)
+	app.Flag("webhook-enable-node-fit", "enables a webhook which validates the pods fit on at least one of the cluster nodes they could be scheduled on.").BoolVar(&c.EnableNodeFit)
+	app.Flag("webhook-node-fit-mode", "how the pods that don't fit on any node are handled, deny rejects them and warn admits them with a warning.").Default("deny").EnumVar(&c.NodeFitMode, "deny", "warn")
+	app.Flag("webhook-enable-namespace-budget", "enables a webhook which validates the deployments and statefulsets of a namespace at their maximum scale fit on the namespace budget.").BoolVar(&c.EnableNamespaceBudget)
+	app.Flag("webhook-namespace-budget", "the default namespace budget in 'cpu=10,memory=20Gi' format, if empty only the namespaces with a specific budget are checked.").StringVar(&c.NamespaceBudget)
+	app.Flag("webhook-namespace-budgets", "a map of namespaces and the budget that replaces the default one on that namespace, same format as the default budget. Can repeat flag").StringMapVar(&c.NamespaceBudgets)
+	app.Flag("webhook-namespace-budget-mode", "how the workloads exceeding the namespace budget are handled, deny rejects them and warn admits them with a warning.").Default("deny").EnumVar(&c.NamespaceBudgetMode, "deny", "warn")
+	app.Flag("webhook-enable-sizing-levels", "enables a webhook which validates the resources with the sizing levels (none, bounded or guaranteed) set on the 'sizing.bitteeinbit.dev/enforce', 'warn' and 'audit' namespace labels.").BoolVar(&c.EnableSizingLevels)
 
-	_, err := app.Parse(os.Args[1:])
+	// The config file settings are the flag defaults, so the flags and environment variables take precedence.
+	pc, err := app.ParseContext(args)
+	if err != nil {
+		return nil, err
+	}
+	if file := configFile(app, pc); file != "" {
+		err := loadConfigFile(app, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = app.Parse(args)
 	if err != nil {
 		return nil, err
 	}
 
 	return c, nil
 }
+
+// configFile returns the config file path set with the flag or its environment variable.
+func configFile(app *kingpin.Application, pc *kingpin.ParseContext) string {
+	for _, el := range pc.Elements {
+		if f, ok := el.Clause.(*kingpin.FlagClause); ok && f.Model().Name == "config-file" && el.Value != nil {
+			return *el.Value
+		}
+	}
+
+	return app.GetFlag("config-file").GetEnvarValue()
+}
+
+// loadConfigFile sets the config file settings as the defaults of their flags, the lists are repeated
+// flags, the maps `key=value` flags and the objects JSON values.
+func loadConfigFile(app *kingpin.Application, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	settings := map[string]interface{}{}
+	err = yaml.Unmarshal(data, &settings, func(d *json.Decoder) *json.Decoder {
+		d.UseNumber()
+		return d
+	})
+	if err != nil {
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		f := app.GetFlag(name)
+		if f == nil || name == "config-file" || name == "print-config" || name == "help" || name == "version" {
+			return fmt.Errorf("invalid config file: unknown setting %q", name)
+		}
+
+		var values []string
+		switch v := settings[name].(type) {
+		case nil:
+		case map[string]interface{}:
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				values = append(values, fmt.Sprintf("%s=%v", k, v[k]))
+			}
+		case []interface{}:
+			for _, item := range v {
+				switch item.(type) {
+				case map[string]interface{}, []interface{}:
+					// Structured values (e.g the marking rules) are passed as JSON.
+					data, err := json.Marshal(item)
+					if err != nil {
+						return fmt.Errorf("invalid config file: %s: %w", name, err)
+					}
+					values = append(values, string(data))
+				default:
+					values = append(values, fmt.Sprint(item))
+				}
+			}
+		default:
+			values = append(values, fmt.Sprint(v))
+		}
+		f.Default(values...)
+	}
+
+	return nil
+}
+
+// redactedValue replaces the secret values of the printed configuration.
+const redactedValue = "<redacted>"
+
+// Print writes the configuration as a config file, with the secrets redacted.
+func (c CmdConfig) Print(w io.Writer) error {
+	return printSettings(w, c)
+}
+
+// printSettings writes the JSON tagged fields of the config struct as a config file, with the secret ones redacted.
+func printSettings(w io.Writer, config interface{}) error {
+	settings := map[string]interface{}{}
+	v := reflect.ValueOf(config)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("json")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		value := v.Field(i).Interface()
+		switch {
+		case field.Tag.Get("secret") == "true" && !v.Field(i).IsZero():
+			value = redactedValue
+		case field.Type == reflect.TypeOf(time.Duration(0)):
+			value = value.(time.Duration).String()
+		}
+		settings[name] = value
+	}
+
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("could not marshal configuration: %w", err)
+	}
+
+	_, err = w.Write(data)
+	return err
+}
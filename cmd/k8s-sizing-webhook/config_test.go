@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCmdConfig(t *testing.T) {
+	tests := map[string]struct {
+		file   string
+		env    map[string]string
+		args   []string
+		expErr bool
+		expCfg func(c *CmdConfig)
+	}{
+		"Having only the config file, its settings should be used.": {
+			file: `metrics-path: /file`,
+			expCfg: func(c *CmdConfig) {
+				c.MetricsPath = "/file"
+			},
+		},
+		"Having the config file and an environment variable, the environment variable should take precedence.": {
+			file: `metrics-path: /file`,
+			env:  map[string]string{"K8S_SIZING_WEBHOOK_METRICS_PATH": "/env"},
+			expCfg: func(c *CmdConfig) {
+				c.MetricsPath = "/env"
+			},
+		},
+		"Having the config file, an environment variable and a flag, the flag should take precedence.": {
+			file: `metrics-path: /file`,
+			env:  map[string]string{"K8S_SIZING_WEBHOOK_METRICS_PATH": "/env"},
+			args: []string{"--metrics-path=/flag"},
+			expCfg: func(c *CmdConfig) {
+				c.MetricsPath = "/flag"
+			},
+		},
+		"Having the config file set with its environment variable, its settings should be used.": {
+			file: `metrics-path: /file`,
+			env:  map[string]string{"K8S_SIZING_WEBHOOK_CONFIG_FILE": "{file}"},
+			expCfg: func(c *CmdConfig) {
+				c.MetricsPath = "/file"
+			},
+		},
+		"Having lists, maps, durations and objects in the config file, they should be set as their flags.": {
+			file: `
+webhook-enable-guaranteed-memory: true
+webhook-forbidden-labels: [team, cost-center]
+webhook-label-marks:
+  team: platform
+  cost-center: 1234
+webhook-mark-rules:
+  - kinds: [Deployment]
+    labels:
+      tier: web
+policy-reload-interval: 30s
+`,
+			expCfg: func(c *CmdConfig) {
+				c.EnableGuaranteedMemory = true
+				c.ForbiddenLabels = []string{"team", "cost-center"}
+				c.LabelMarks = map[string]string{"team": "platform", "cost-center": "1234"}
+				c.MarkRules = []string{`{"kinds":["Deployment"],"labels":{"tier":"web"}}`}
+				c.PolicyReloadInterval = 30 * time.Second
+			},
+		},
+		"Having a list in the config file and the flag, the flag values should replace the file ones.": {
+			file: `webhook-forbidden-labels: [team, cost-center]`,
+			args: []string{"--webhook-forbidden-labels=owner"},
+			expCfg: func(c *CmdConfig) {
+				c.ForbiddenLabels = []string{"owner"}
+			},
+		},
+		"Having an unknown setting in the config file, it should fail.": {
+			file:   `metrics-paths: /file`,
+			expErr: true,
+		},
+		"Having a command setting in the config file, it should fail.": {
+			file:   `print-config: true`,
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			// The expected configuration is the default one with the test settings.
+			exp, err := newCmdConfig(nil)
+			require.NoError(err)
+			if test.expCfg != nil {
+				test.expCfg(exp)
+			}
+
+			file := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(os.WriteFile(file, []byte(test.file), 0o600))
+			args := test.args
+			if _, ok := test.env["K8S_SIZING_WEBHOOK_CONFIG_FILE"]; !ok {
+				args = append([]string{"--config-file", file}, args...)
+			}
+			for k, v := range test.env {
+				if v == "{file}" {
+					v = file
+				}
+				t.Setenv(k, v)
+			}
+
+			got, err := newCmdConfig(args)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			// Only the settings are compared.
+			got.ConfigFile = ""
+			exp.ConfigFile = ""
+			assert.Equal(exp, got)
+		})
+	}
+}
+
+func TestPrintSettings(t *testing.T) {
+	type settings struct {
+		Path     string        `json:"path"`
+		Token    string        `json:"token" secret:"true"`
+		Password string        `json:"password" secret:"true"`
+		Interval time.Duration `json:"interval"`
+		Internal string        `json:"-"`
+	}
+
+	tests := map[string]struct {
+		config interface{}
+		exp    string
+	}{
+		"Having secret settings, they should be redacted.": {
+			config: settings{Path: "/etc/tls/tls.key", Token: "t0k3n", Interval: time.Minute, Internal: "x"},
+			exp:    "interval: 1m0s\npassword: \"\"\npath: /etc/tls/tls.key\ntoken: <redacted>\n",
+		},
+		"Having the command configuration, the secret paths should be printed.": {
+			config: CmdConfig{TLSKeyFilePath: "/etc/tls/tls.key"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var b bytes.Buffer
+			require.NoError(printSettings(&b, test.config))
+
+			if test.exp != "" {
+				assert.Equal(test.exp, b.String())
+			} else {
+				assert.Contains(b.String(), "tls-key-file-path: /etc/tls/tls.key\n")
+				assert.NotContains(b.String(), redactedValue)
+			}
+		})
+	}
+}
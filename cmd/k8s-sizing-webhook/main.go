@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
@@ -14,12 +16,32 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/cert"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/health"
 	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/http/webhook"
 	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/log"
 	internalmetricsprometheus "github.com/bitte-ein-bit/k8s-sizing-webhook/internal/metrics/prometheus"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/hpa"
 	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
 	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mem"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/vpa"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/policy"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/registration"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/budget"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/cpu"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/level"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/nodefit"
 )
 
 var (
@@ -27,12 +49,19 @@ var (
 	Version = "dev"
 )
 
+// informerResync is the resync period of the Kubernetes informers.
+const informerResync = 10 * time.Minute
+
 func runApp() error {
 	cfg, err := NewCmdConfig()
 	if err != nil {
 		return fmt.Errorf("could not get commandline configuration: %w", err)
 	}
 
+	if cfg.PrintConfig {
+		return cfg.Print(os.Stdout)
+	}
+
 	// Set up logger.
 	logrusLog := logrus.New()
 	logrusLogEntry := logrus.NewEntry(logrusLog).WithField("app", "k8s-sizing-webhook")
@@ -45,29 +74,425 @@ func runApp() error {
 	logger := log.NewLogrus(logrusLogEntry).WithKV(log.KV{"version": Version})
 	logger.Infof("Starting up with Debug: %v", cfg.Debug)
 
+	// On uninstall the registered webhook configurations are deleted, so the API server doesn't call a
+	// removed webhook.
+	if cfg.UnregisterWebhooks {
+		reconciler, err := newRegistrationReconciler(cfg, nil, nil, logger)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return reconciler.Delete(ctx)
+	}
+
 	// Dependencies.
 	metricsRec := internalmetricsprometheus.NewRecorder(prometheus.DefaultRegisterer)
 
+	// The policy replaces the label marks and guaranteed memory flags, it's reloaded when the file
+	// changes or on SIGHUP.
+	var policyStore *policy.Store
+	var policyReloader *policy.Reloader
+	if (cfg.PolicyFile != "" || cfg.EnablePolicyCRDs) && (len(cfg.LabelMarks) > 0 || len(cfg.MarkRules) > 0 || cfg.EnableGuaranteedMemory) {
+		return fmt.Errorf("the policies can't be used with the label marks, marking rules or guaranteed memory flags, use the policy rules instead")
+	}
+	if cfg.PolicyFile != "" {
+		p, err := policy.Load(cfg.PolicyFile)
+		if err != nil {
+			return fmt.Errorf("could not load policy: %w", err)
+		}
+		policyStore = policy.NewStore(p)
+		logger.WithKV(log.KV{"policy": p.Hash()}).Infof("policy loaded with %d rules", len(p.Rules))
+
+		hupC := make(chan os.Signal, 1)
+		signal.Notify(hupC, syscall.SIGHUP)
+		policyReloader, err = policy.NewReloader(policy.ReloaderConfig{
+			File:            cfg.PolicyFile,
+			Store:           policyStore,
+			Interval:        cfg.PolicyReloadInterval,
+			Signals:         hupC,
+			MetricsRecorder: metricsRec,
+			Logger:          logger,
+		})
+		if err != nil {
+			return fmt.Errorf("could not create policy reloader: %w", err)
+		}
+	}
+
+	markRules := make([]mark.Rule, 0, len(cfg.MarkRules))
+	for _, r := range cfg.MarkRules {
+		rule, err := mark.ParseRule([]byte(r))
+		if err != nil {
+			return err
+		}
+		markRules = append(markRules, rule)
+	}
+
+	// Kubernetes informers are only required by the webhooks that need to know the cluster state.
+	// The CRDs (e.g VPA) are watched with dynamic informers.
+	var informerFactory informers.SharedInformerFactory
+	var dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	if cfg.EnableNodeFit || cfg.EnableNamespaceBudget || cfg.EnableHPAMemory || cfg.EnableVPACoordination || cfg.PolicyFile != "" || cfg.EnablePolicyCRDs || cfg.EnableSizingLevels || mark.RulesNeedNamespaceLabels(markRules) || len(cfg.NamespaceLabels) > 0 {
+		kubeCfg, err := newKubernetesConfig(cfg.KubeConfigPath)
+		if err != nil {
+			return err
+		}
+
+		kubeCli, err := kubernetes.NewForConfig(kubeCfg)
+		if err != nil {
+			return fmt.Errorf("could not create kubernetes client: %w", err)
+		}
+		informerFactory = informers.NewSharedInformerFactory(kubeCli, informerResync)
+
+		// The informers of a resource that is not served would never sync and block the startup.
+		if cfg.EnableVPACoordination {
+			err := checkResourceServed(kubeCli.Discovery(), vpa.GroupVersionResource)
+			if err != nil {
+				return fmt.Errorf("vpa coordination requires the VerticalPodAutoscaler CRD: %w", err)
+			}
+		}
+
+		dynamicCli, err := dynamic.NewForConfig(kubeCfg)
+		if err != nil {
+			return fmt.Errorf("could not create kubernetes dynamic client: %w", err)
+		}
+		dynamicInformerFactory = dynamicinformer.NewDynamicSharedInformerFactory(dynamicCli, informerResync)
+	}
+
 	var marker mark.Marker
-	if len(cfg.LabelMarks) > 0 {
-		marker = mark.NewLabelMarker(cfg.LabelMarks)
-		for k, v := range cfg.LabelMarks {
-			logger.Debugf("applying \"%s\": \"%s\"", k, v)
+	var memFixer mem.Fixer
+	var policySource policy.Source
+	if policyStore != nil || cfg.EnablePolicyCRDs {
+		// The policy resources take precedence over the policy file: first the SizingPolicies of the
+		// resource namespace, then the ClusterSizingPolicies and finally the file rules.
+		var sources []policy.Source
+		if cfg.EnablePolicyCRDs {
+			spInformer := dynamicInformerFactory.ForResource(policy.SizingPolicyGVR)
+			cspInformer := dynamicInformerFactory.ForResource(policy.ClusterSizingPolicyGVR)
+			crdSource, err := policy.NewCRDSource(policy.CRDSourceConfig{
+				SizingPolicyLister:        spInformer.Lister(),
+				ClusterSizingPolicyLister: cspInformer.Lister(),
+				HasSynced: func() bool {
+					return spInformer.Informer().HasSynced() && cspInformer.Informer().HasSynced()
+				},
+				Logger: logger,
+			})
+			if err != nil {
+				return fmt.Errorf("could not create policy resources source: %w", err)
+			}
+			sources = append(sources, crdSource)
+			logger.Infof("SizingPolicy and ClusterSizingPolicy resources enabled")
+		}
+		if policyStore != nil {
+			sources = append(sources, policyStore)
+		}
+
+		// A changed policy could select the namespaces by their labels, so they are always watched.
+		policySource = policy.Sources(sources...)
+		policyCfg := policy.Config{
+			Source:          policySource,
+			NamespaceLister: informerFactory.Core().V1().Namespaces().Lister(),
 		}
-		logger.Infof("label marker webhook enabled")
+
+		marker, err = policy.NewMarker(policyCfg)
+		if err != nil {
+			return fmt.Errorf("could not create policy marker: %w", err)
+		}
+		memFixer, err = policy.NewFixer(policyCfg)
+		if err != nil {
+			return fmt.Errorf("could not create policy fixer: %w", err)
+		}
+		logger.Infof("policy marker and fixer enabled")
 	} else {
-		marker = mark.DummyMarker
-		logger.Warningf("label marker webhook disabled")
+		if len(cfg.LabelMarks) > 0 {
+			marker, err = mark.NewLabelTemplateMarker(cfg.LabelMarks)
+			if err != nil {
+				return fmt.Errorf("could not create label marker: %w", err)
+			}
+			for k, v := range cfg.LabelMarks {
+				logger.Debugf("applying \"%s\": \"%s\"", k, v)
+			}
+			logger.Infof("label marker webhook enabled")
+		} else {
+			marker = mark.DummyMarker
+			logger.Warningf("label marker webhook disabled")
+		}
+
+		if len(markRules) > 0 {
+			var nsLister corev1listers.NamespaceLister
+			if informerFactory != nil {
+				nsLister = informerFactory.Core().V1().Namespaces().Lister()
+			}
+			rulesMarker, err := mark.NewRulesMarker(mark.RulesConfig{Rules: markRules, NamespaceLister: nsLister})
+			if err != nil {
+				return fmt.Errorf("could not create marking rules marker: %w", err)
+			}
+			marker = mark.Compose(marker, rulesMarker)
+			logger.Infof("%d marking rules enabled", len(markRules))
+		}
+
+		if cfg.EnableGuaranteedMemory {
+			memFixer = mem.NewMemRequestFixer()
+			logger.Infof("memory fixer enabled")
+		} else {
+			memFixer = mem.DummyFixer
+			logger.Warningf("memory fixer disabled")
+		}
 	}
 
-	var memFixer mem.Fixer
-	if cfg.EnableGuaranteedMemory {
-		memFixer = mem.NewMemRequestFixer()
-		logger.Infof("memory fixer enabled")
+	// The annotation marks are set in the same admission as the label or policy marks.
+	if len(cfg.AnnotationMarks) > 0 {
+		annotationMarker, err := mark.NewAnnotationTemplateMarker(cfg.AnnotationMarks)
+		if err != nil {
+			return fmt.Errorf("could not create annotation marker: %w", err)
+		}
+		marker = mark.Compose(marker, annotationMarker)
+		for k, v := range cfg.AnnotationMarks {
+			logger.Debugf("annotating \"%s\": \"%s\"", k, v)
+		}
+		logger.Infof("annotation marker webhook enabled")
+	}
+
+	// The merge strategies and forbidden labels apply to all the marks.
+	strategies := make(map[string]mark.MergeStrategy, len(cfg.MarkMergeStrategies))
+	for k, s := range cfg.MarkMergeStrategies {
+		strategies[k] = mark.MergeStrategy(s)
+	}
+	marker, err = mark.NewMergeMarker(mark.MergeConfig{
+		Marker:          marker,
+		Strategy:        mark.MergeStrategy(cfg.MarkMergeStrategy),
+		Strategies:      strategies,
+		ForbiddenLabels: cfg.ForbiddenLabels,
+	})
+	if err != nil {
+		return fmt.Errorf("could not create merge marker: %w", err)
+	}
+	if len(cfg.ForbiddenLabels) > 0 {
+		logger.Infof("%d forbidden labels removed by the marker", len(cfg.ForbiddenLabels))
+	}
+
+	// The namespace labels are merged with their own strategy, on the resources and their pod templates.
+	if len(cfg.NamespaceLabels) > 0 {
+		nsLabelMarker, err := mark.NewNamespaceLabelMarker(mark.NamespaceLabelsConfig{
+			Labels:          cfg.NamespaceLabels,
+			Strategy:        mark.MergeStrategy(cfg.NamespaceLabelsStrategy),
+			NamespaceLister: informerFactory.Core().V1().Namespaces().Lister(),
+		})
+		if err != nil {
+			return fmt.Errorf("could not create namespace label marker: %w", err)
+		}
+		marker = mark.Compose(marker, nsLabelMarker)
+		logger.Infof("namespace label marker enabled")
+	}
+
+	if cfg.MarkPodTemplates {
+		marker = mark.NewPodTemplateMarker(marker)
+		logger.Infof("pod template marks enabled")
+	}
+
+	var vpaCoordinator vpa.Coordinator
+	if cfg.EnableVPACoordination {
+		vpaCoordinator, err = vpa.NewVPACoordinator(vpa.Config{
+			VPALister: dynamicInformerFactory.ForResource(vpa.GroupVersionResource).Lister(),
+			Mode:      vpa.Mode(cfg.VPAMode),
+		})
+		if err != nil {
+			return fmt.Errorf("could not create vpa coordinator: %w", err)
+		}
+		logger.Infof("vpa coordinator enabled")
+	} else {
+		vpaCoordinator = vpa.DummyCoordinator
+		logger.Warningf("vpa coordinator disabled")
+	}
+
+	var hpaAdjuster hpa.Adjuster
+	if cfg.EnableHPAMemory {
+		hpaAdjuster, err = hpa.NewHPAAdjuster(hpa.Config{
+			HPALister:         informerFactory.Autoscaling().V2().HorizontalPodAutoscalers().Lister(),
+			DeploymentLister:  informerFactory.Apps().V1().Deployments().Lister(),
+			StatefulSetLister: informerFactory.Apps().V1().StatefulSets().Lister(),
+			ReplicaSetLister:  informerFactory.Apps().V1().ReplicaSets().Lister(),
+		})
+		if err != nil {
+			return fmt.Errorf("could not create hpa adjuster: %w", err)
+		}
+		logger.Infof("hpa memory adjuster enabled")
+	} else {
+		hpaAdjuster = hpa.DummyAdjuster
+		logger.Warningf("hpa memory adjuster disabled")
+	}
+
+	var cpuValidator cpu.Validator
+	if cfg.EnableCPUBounds {
+		cpuValidator, err = newCPUValidator(cfg)
+		if err != nil {
+			return fmt.Errorf("could not create cpu bounds validator: %w", err)
+		}
+		logger.Infof("cpu bounds validator enabled")
+	} else {
+		cpuValidator = cpu.DummyValidator
+		logger.Warningf("cpu bounds validator disabled")
+	}
+
+	var nodeFitChecker nodefit.Checker
+	if cfg.EnableNodeFit {
+		nodeFitChecker, err = nodefit.NewNodeFitChecker(nodefit.Config{
+			NodeLister: informerFactory.Core().V1().Nodes().Lister(),
+			Mode:       nodefit.Mode(cfg.NodeFitMode),
+		})
+		if err != nil {
+			return fmt.Errorf("could not create node fit checker: %w", err)
+		}
+		logger.Infof("node fit checker enabled")
+	} else {
+		nodeFitChecker = nodefit.DummyChecker
+		logger.Warningf("node fit checker disabled")
+	}
+
+	var budgetChecker budget.Checker
+	if cfg.EnableNamespaceBudget {
+		budgetChecker, err = newBudgetChecker(cfg, informerFactory)
+		if err != nil {
+			return fmt.Errorf("could not create namespace budget checker: %w", err)
+		}
+		logger.Infof("namespace budget checker enabled")
+	} else {
+		budgetChecker = budget.DummyChecker
+		logger.Warningf("namespace budget checker disabled")
+	}
+
+	var levelChecker level.Checker
+	if cfg.EnableSizingLevels {
+		levelChecker, err = level.NewLevelChecker(level.Config{
+			NamespaceLister: informerFactory.Core().V1().Namespaces().Lister(),
+			MetricsRecorder: metricsRec,
+		})
+		if err != nil {
+			return fmt.Errorf("could not create sizing level checker: %w", err)
+		}
+		logger.Infof("sizing level checker enabled")
+	} else {
+		levelChecker = level.DummyChecker
+		logger.Warningf("sizing level checker disabled")
+	}
+
+	// The TLS certificate is reloaded when the files change, so the rotated certificates are served without restarts.
+	// Or bootstrapped by the webhook itself, without external tooling.
+	var certReloader *cert.Reloader
+	var certBootstrapper *cert.Bootstrapper
+	switch {
+	case cfg.TLSBootstrap:
+		if cfg.TLSCertFilePath != "" || cfg.TLSKeyFilePath != "" {
+			return fmt.Errorf("the TLS cert and key files can't be used with the TLS bootstrap")
+		}
+
+		kubeCli, err := newKubernetesClient(cfg.KubeConfigPath)
+		if err != nil {
+			return err
+		}
+
+		svc, ns := cfg.ServiceName, cfg.ServiceNamespace
+		certBootstrapper, err = cert.NewBootstrapper(cert.BootstrapConfig{
+			Client:                   kubeCli,
+			Namespace:                ns,
+			SecretName:               cfg.TLSBootstrapSecret,
+			DNSNames:                 []string{svc + "." + ns + ".svc", svc, svc + "." + ns, svc + "." + ns + ".svc.cluster.local"},
+			WebhookConfigurationName: cfg.WebhookConfigName,
+			MetricsRecorder:          metricsRec,
+			Logger:                   logger,
+		})
+		if err != nil {
+			return fmt.Errorf("could not create certificate bootstrapper: %w", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = certBootstrapper.Sync(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("could not bootstrap certificates: %w", err)
+		}
+	case cfg.TLSCertFilePath != "" && cfg.TLSKeyFilePath != "":
+		certReloader, err = cert.NewReloader(cert.ReloaderConfig{
+			CertFile:        cfg.TLSCertFilePath,
+			KeyFile:         cfg.TLSKeyFilePath,
+			Interval:        cfg.TLSReloadInterval,
+			MetricsRecorder: metricsRec,
+			Logger:          logger,
+		})
+		if err != nil {
+			return fmt.Errorf("could not create certificate reloader: %w", err)
+		}
+	}
+
+	// The webhook configurations are registered with the enabled webhooks once the webhook is ready,
+	// with the bootstrapped CA so they are never registered without it.
+	var registrationReconciler *registration.Reconciler
+	if cfg.WebhookRegistration {
+		var caBundle func() []byte
+		if certBootstrapper != nil {
+			caBundle = certBootstrapper.CABundle
+		}
+
+		registrationReconciler, err = newRegistrationReconciler(cfg, &webhookFeatures{
+			allMark:         policyStore != nil || cfg.EnablePolicyCRDs || len(cfg.LabelMarks) > 0 || len(markRules) > 0 || len(cfg.AnnotationMarks) > 0 || len(cfg.NamespaceLabels) > 0 || len(cfg.ForbiddenLabels) > 0,
+			memFix:          policyStore != nil || cfg.EnablePolicyCRDs || cfg.EnableGuaranteedMemory,
+			memFixReinvoke:  cfg.EnableVPACoordination,
+			hpaMemory:       cfg.EnableHPAMemory,
+			cpuBounds:       cfg.EnableCPUBounds,
+			nodeFit:         cfg.EnableNodeFit,
+			namespaceBudget: cfg.EnableNamespaceBudget,
+			sizingLevel:     cfg.EnableSizingLevels,
+		}, caBundle, logger)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Webhook handler, the explain handler runs the same mutators.
+	whConfig := webhook.Config{
+		Marker:          marker,
+		MemoryFixer:     memFixer,
+		HPAAdjuster:     hpaAdjuster,
+		VPACoordinator:  vpaCoordinator,
+		CPUValidator:    cpuValidator,
+		NodeFitChecker:  nodeFitChecker,
+		BudgetChecker:   budgetChecker,
+		LevelChecker:    levelChecker,
+		MetricsRecorder: metricsRec,
+		Logger:          logger,
+	}
+	wh, err := webhook.New(whConfig)
+	if err != nil {
+		return fmt.Errorf("could not create webhooks handler: %w", err)
+	}
+	explainHandler, err := webhook.NewExplain(whConfig)
+	if err != nil {
+		return fmt.Errorf("could not create explain handler: %w", err)
+	}
+
+	// The webhook is ready when its server is listening, the certificate is valid, the informers are synced and
+	// the self-test passed, so a broken webhook never receives traffic.
+	serverStatus := health.NewStatus("webhook server not listening")
+	informersStatus := health.NewStatus("informer caches not synced")
+	selfTestStatus := health.NewStatus("self-test not run")
+	informersSyncedC := make(chan struct{})
+	readyChecks := []health.Check{{Name: "webhook-server", Check: serverStatus.Check}}
+	switch {
+	case certBootstrapper != nil:
+		readyChecks = append(readyChecks, health.Check{Name: "certificate", Check: health.CertificateCheck(certBootstrapper.GetCertificate)})
+	case certReloader != nil:
+		readyChecks = append(readyChecks, health.Check{Name: "certificate", Check: health.CertificateCheck(certReloader.GetCertificate)})
+	}
+	if informerFactory != nil {
+		readyChecks = append(readyChecks, health.Check{Name: "informers", Check: informersStatus.Check})
 	} else {
-		memFixer = mem.DummyFixer
-		logger.Warningf("memory fixer disabled")
+		close(informersSyncedC)
+	}
+	if policySource != nil {
+		readyChecks = append(readyChecks, health.Check{Name: "policy", Check: policySource.Ready})
 	}
+	readyChecks = append(readyChecks, health.Check{Name: "self-test", Check: selfTestStatus.Check})
 
 	// Prepare run entrypoints.
 	var g run.Group
@@ -94,6 +519,138 @@ func runApp() error {
 		)
 	}
 
+	// Kubernetes informers.
+	if informerFactory != nil {
+		stopC := make(chan struct{})
+
+		g.Add(
+			func() error {
+				informerFactory.Start(stopC)
+				for informerType, synced := range informerFactory.WaitForCacheSync(stopC) {
+					if !synced {
+						return fmt.Errorf("could not sync %s informer cache", informerType)
+					}
+				}
+				dynamicInformerFactory.Start(stopC)
+				for gvr, synced := range dynamicInformerFactory.WaitForCacheSync(stopC) {
+					if !synced {
+						return fmt.Errorf("could not sync %s informer cache", gvr)
+					}
+				}
+				logger.Infof("informer caches synced")
+				informersStatus.Set(nil)
+				close(informersSyncedC)
+
+				<-stopC
+				return nil
+			},
+			func(_ error) {
+				close(stopC)
+				informerFactory.Shutdown()
+				dynamicInformerFactory.Shutdown()
+			},
+		)
+	}
+
+	// Policy reloader.
+	if policyReloader != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		g.Add(
+			func() error {
+				return policyReloader.Run(ctx)
+			},
+			func(_ error) {
+				cancel()
+			},
+		)
+	}
+
+	// Webhook registration reconciler, the Fail policy webhooks would block the cluster admissions if they were
+	// registered before the webhook can serve them.
+	if registrationReconciler != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		g.Add(
+			func() error {
+				err := health.Wait(ctx, time.Second, readyChecks...)
+				if err != nil {
+					// Stopped before being ready.
+					return nil
+				}
+
+				err = registrationReconciler.Apply(ctx)
+				if err != nil {
+					return fmt.Errorf("could not register webhooks: %w", err)
+				}
+				logger.Infof("webhooks registered")
+
+				return registrationReconciler.Run(ctx)
+			},
+			func(_ error) {
+				cancel()
+			},
+		)
+	}
+
+	// TLS certificate bootstrapper.
+	if certBootstrapper != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		g.Add(
+			func() error {
+				return certBootstrapper.Run(ctx)
+			},
+			func(_ error) {
+				cancel()
+			},
+		)
+	}
+
+	// TLS certificate reloader.
+	if certReloader != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		g.Add(
+			func() error {
+				return certReloader.Run(ctx)
+			},
+			func(_ error) {
+				cancel()
+			},
+		)
+	}
+
+	// Webhook self-test, once the informers are synced.
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+
+		g.Add(
+			func() error {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-informersSyncedC:
+				}
+
+				err := webhook.SelfTest(ctx, wh)
+				if err != nil {
+					logger.Errorf("webhook self-test failed, the webhook will not be ready: %s", err)
+					selfTestStatus.Set(fmt.Errorf("self-test failed: %w", err))
+				} else {
+					logger.Infof("webhook self-test passed")
+					selfTestStatus.Set(nil)
+				}
+
+				<-ctx.Done()
+				return nil
+			},
+			func(_ error) {
+				cancel()
+			},
+		)
+	}
+
 	// Metrics HTTP server.
 	{
 		logger := logger.WithKV(log.KV{"addr": cfg.MetricsListenAddr, "http-server": "metrics"})
@@ -111,6 +668,10 @@ func runApp() error {
 
 		// Health checks.
 		mux.HandleFunc("/healthz", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+		mux.Handle("/readyz", health.NewReadyHandler(readyChecks...))
+
+		// Explain the mutations of a manifest.
+		mux.Handle("/explain", explainHandler)
 
 		server := http.Server{Addr: cfg.MetricsListenAddr, Handler: mux}
 
@@ -138,31 +699,53 @@ func runApp() error {
 	{
 		logger := logger.WithKV(log.KV{"addr": cfg.WebhookListenAddr, "http-server": "webhooks"})
 
-		// Webhook handler.
-		wh, err := webhook.New(webhook.Config{
-			Marker:          marker,
-			MemoryFixer:     memFixer,
-			MetricsRecorder: metricsRec,
-			Logger:          logger,
-		})
-		if err != nil {
-			return fmt.Errorf("could not create webhooks handler: %w", err)
-		}
-
 		mux := http.NewServeMux()
 		mux.Handle("/", wh)
 		server := http.Server{Addr: cfg.WebhookListenAddr, Handler: mux}
 
 		g.Add(
 			func() error {
-				if cfg.TLSCertFilePath == "" || cfg.TLSKeyFilePath == "" {
+				var getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+				switch {
+				case certBootstrapper != nil:
+					getCertificate = certBootstrapper.GetCertificate
+				case certReloader != nil:
+					getCertificate = certReloader.GetCertificate
+				case cfg.TLSClientCAFilePath != "":
+					return fmt.Errorf("the TLS client CA file requires the TLS cert and key files or the TLS bootstrap")
+				default:
 					logger.Warningf("webhook running without TLS")
+					ln, err := net.Listen("tcp", cfg.WebhookListenAddr)
+					if err != nil {
+						return err
+					}
+					serverStatus.Set(nil)
 					logger.Infof("http server listening...")
-					return server.ListenAndServe()
+					return server.Serve(ln)
+				}
+
+				tlsConfig, err := cert.NewServerTLSConfig(cert.ServerConfig{
+					GetCertificate:   getCertificate,
+					MinVersion:       cfg.TLSMinVersion,
+					CipherSuites:     cfg.TLSCipherSuites,
+					CurvePreferences: cfg.TLSCurvePreferences,
+					ClientCAFile:     cfg.TLSClientCAFilePath,
+				})
+				if err != nil {
+					return fmt.Errorf("could not create webhook TLS configuration: %w", err)
+				}
+				if tlsConfig.ClientCAs != nil {
+					logger.Infof("client certificates required")
 				}
 
+				server.TLSConfig = tlsConfig
+				ln, err := net.Listen("tcp", cfg.WebhookListenAddr)
+				if err != nil {
+					return err
+				}
+				serverStatus.Set(nil)
 				logger.Infof("https server listening...")
-				return server.ListenAndServeTLS(cfg.TLSCertFilePath, cfg.TLSKeyFilePath)
+				return server.ServeTLS(ln, "", "")
 			},
 			func(_ error) {
 				logger.Infof("start draining connections")
@@ -187,6 +770,128 @@ func runApp() error {
 	return nil
 }
 
+// newKubernetesConfig returns the Kubernetes client configuration using the kubeconfig on the path, or the
+// in-cluster configuration if the path is empty.
+func newKubernetesConfig(kubeConfigPath string) (*rest.Config, error) {
+	restCfg, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load kubernetes configuration: %w", err)
+	}
+
+	return restCfg, nil
+}
+
+// newKubernetesClient returns a Kubernetes client using the kubeconfig on the path, or the in-cluster
+// configuration if the path is empty.
+func newKubernetesClient(kubeConfigPath string) (kubernetes.Interface, error) {
+	kubeCfg, err := newKubernetesConfig(kubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeCli, err := kubernetes.NewForConfig(kubeCfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create kubernetes client: %w", err)
+	}
+
+	return kubeCli, nil
+}
+
+// checkResourceServed returns an error if the API server doesn't serve the resource, e.g its CRD is not installed.
+func checkResourceServed(disc discovery.DiscoveryInterface, gvr schema.GroupVersionResource) error {
+	resources, err := disc.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return fmt.Errorf("could not discover %s resources: %w", gvr.GroupVersion(), err)
+	}
+
+	for _, r := range resources.APIResources {
+		if r.Name == gvr.Resource {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("resource %s is not served by the API server", gvr.GroupResource())
+}
+
+// newRegistrationReconciler returns the webhook registration reconciler of the enabled webhooks, without
+// webhooks if no features, e.g to delete them. The caBundle returns the bootstrapped CA, if any.
+func newRegistrationReconciler(cfg *CmdConfig, features *webhookFeatures, caBundle func() []byte, logger log.Logger) (*registration.Reconciler, error) {
+	var webhooks []registration.Webhook
+	if features != nil {
+		var err error
+		webhooks, err = registrationWebhooks(cfg, *features)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kubeCli, err := newKubernetesClient(cfg.KubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciler, err := registration.NewReconciler(registration.Config{
+		Client:           kubeCli,
+		Name:             cfg.WebhookConfigName,
+		ServiceNamespace: cfg.ServiceNamespace,
+		ServiceName:      cfg.ServiceName,
+		Webhooks:         webhooks,
+		CABundleFile:     cfg.RegistrationCABundle,
+		CABundle:         caBundle,
+		Interval:         cfg.RegistrationInterval,
+		Logger:           logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create webhook registration reconciler: %w", err)
+	}
+
+	return reconciler, nil
+}
+
+func newCPUValidator(cfg *CmdConfig) (cpu.Validator, error) {
+	defaultBounds, err := cpu.ParseBounds(cfg.CPUBounds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default cpu bounds: %w", err)
+	}
+
+	nsBounds := map[string]cpu.Bounds{}
+	for ns, b := range cfg.CPUNamespaceBounds {
+		nsBounds[ns], err = cpu.ParseBounds(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q namespace cpu bounds: %w", ns, err)
+		}
+	}
+
+	return cpu.NewBoundsValidator(cpu.Config{
+		Default:    defaultBounds,
+		Namespaces: nsBounds,
+	})
+}
+
+func newBudgetChecker(cfg *CmdConfig, informerFactory informers.SharedInformerFactory) (budget.Checker, error) {
+	defaultBudget, err := budget.ParseBudget(cfg.NamespaceBudget)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default namespace budget: %w", err)
+	}
+
+	nsBudgets := map[string]corev1.ResourceList{}
+	for ns, b := range cfg.NamespaceBudgets {
+		nsBudgets[ns], err = budget.ParseBudget(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q namespace budget: %w", ns, err)
+		}
+	}
+
+	return budget.NewBudgetChecker(budget.Config{
+		Default:           defaultBudget,
+		Namespaces:        nsBudgets,
+		Mode:              budget.Mode(cfg.NamespaceBudgetMode),
+		DeploymentLister:  informerFactory.Apps().V1().Deployments().Lister(),
+		StatefulSetLister: informerFactory.Apps().V1().StatefulSets().Lister(),
+		HPALister:         informerFactory.Autoscaling().V2().HorizontalPodAutoscalers().Lister(),
+	})
+}
+
 func main() {
 	err := runApp()
 	if err != nil {
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubernetesfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/vpa"
+)
+
+func TestCheckResourceServed(t *testing.T) {
+	tests := map[string]struct {
+		resources []*metav1.APIResourceList
+		expErr    bool
+	}{
+		"Having the VPA CRD installed, it should be served.": {
+			resources: []*metav1.APIResourceList{{
+				GroupVersion: "autoscaling.k8s.io/v1",
+				APIResources: []metav1.APIResource{{Name: "verticalpodautoscalers"}, {Name: "verticalpodautoscalercheckpoints"}},
+			}},
+		},
+		"Having the VPA group without the VPA resource, it should fail.": {
+			resources: []*metav1.APIResourceList{{
+				GroupVersion: "autoscaling.k8s.io/v1",
+				APIResources: []metav1.APIResource{{Name: "verticalpodautoscalercheckpoints"}},
+			}},
+			expErr: true,
+		},
+		"Having the VPA CRD not installed, it should fail.": {
+			resources: []*metav1.APIResourceList{{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{{Name: "deployments"}},
+			}},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			disc := kubernetesfake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+			disc.Resources = test.resources
+
+			err := checkResourceServed(disc, vpa.GroupVersionResource)
+			if test.expErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/http/webhook"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/registration"
+)
+
+// webhookFeatures are the enabled webhooks, by their short name.
+type webhookFeatures struct {
+	allMark         bool
+	memFix          bool
+	memFixReinvoke  bool
+	hpaMemory       bool
+	cpuBounds       bool
+	nodeFit         bool
+	namespaceBudget bool
+	sizingLevel     bool
+}
+
+var (
+	workloadRules = []admissionregistrationv1.RuleWithOperations{{
+		Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+		Rule: admissionregistrationv1.Rule{
+			APIGroups:   []string{"*"},
+			APIVersions: []string{"*"},
+			Resources:   []string{"deployments", "daemonsets", "cronjobs", "jobs", "statefulsets", "pods"},
+		},
+	}}
+	hpaRules = []admissionregistrationv1.RuleWithOperations{{
+		Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+		Rule: admissionregistrationv1.Rule{
+			APIGroups:   []string{"autoscaling"},
+			APIVersions: []string{"v2"},
+			Resources:   []string{"horizontalpodautoscalers"},
+		},
+	}}
+	scaleRules = []admissionregistrationv1.RuleWithOperations{{
+		Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+		Rule: admissionregistrationv1.Rule{
+			APIGroups:   []string{"apps"},
+			APIVersions: []string{"v1"},
+			Resources:   []string{"deployments", "statefulsets", "deployments/scale", "statefulsets/scale"},
+		},
+	}}
+)
+
+// registrationWebhooks returns the enabled webhooks to register, with the same defaults as the Helm chart.
+func registrationWebhooks(cfg *CmdConfig, features webhookFeatures) ([]registration.Webhook, error) {
+	// Avoid chicken-egg problem with our webhook deployment.
+	var selfSelector *metav1.LabelSelector
+	if len(cfg.RegistrationExclude) > 0 {
+		selfSelector = &metav1.LabelSelector{}
+		for _, k := range slices.Sorted(maps.Keys(cfg.RegistrationExclude)) {
+			selfSelector.MatchExpressions = append(selfSelector.MatchExpressions, metav1.LabelSelectorRequirement{
+				Key:      k,
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   []string{cfg.RegistrationExclude[k]},
+			})
+		}
+	}
+
+	memFixReinvocation := admissionregistrationv1.NeverReinvocationPolicy
+	if features.memFixReinvoke {
+		// Run again after the VPA admission controller sets the pod requests.
+		memFixReinvocation = admissionregistrationv1.IfNeededReinvocationPolicy
+	}
+
+	all := []struct {
+		id      string
+		enabled bool
+		webhook registration.Webhook
+	}{
+		{"memfix", features.memFix, registration.Webhook{Path: webhook.MemFixPath, Mutating: true, FailurePolicy: admissionregistrationv1.Fail, ReinvocationPolicy: memFixReinvocation, Rules: workloadRules, ObjectSelector: selfSelector}},
+		{"allmark", features.allMark, registration.Webhook{Path: webhook.AllMarkPath, Mutating: true, FailurePolicy: admissionregistrationv1.Fail, Rules: workloadRules, ObjectSelector: selfSelector}},
+		{"hpamemory", features.hpaMemory, registration.Webhook{Path: webhook.HPAMemoryPath, Mutating: true, FailurePolicy: admissionregistrationv1.Ignore, Rules: hpaRules}},
+		{"cpubounds", features.cpuBounds, registration.Webhook{Path: webhook.CPUBoundsPath, FailurePolicy: admissionregistrationv1.Fail, Rules: workloadRules, ObjectSelector: selfSelector}},
+		{"nodefit", features.nodeFit, registration.Webhook{Path: webhook.NodeFitPath, FailurePolicy: admissionregistrationv1.Ignore, Rules: workloadRules, ObjectSelector: selfSelector}},
+		{"namespacebudget", features.namespaceBudget, registration.Webhook{Path: webhook.NamespaceBudgetPath, FailurePolicy: admissionregistrationv1.Ignore, Rules: scaleRules, ObjectSelector: selfSelector}},
+		// The namespaces opt in with their labels, read by the webhook.
+		{"sizinglevel", features.sizingLevel, registration.Webhook{Path: webhook.SizingLevelPath, FailurePolicy: admissionregistrationv1.Ignore, Rules: workloadRules, ObjectSelector: selfSelector}},
+	}
+
+	ids := map[string]bool{}
+	for _, wh := range all {
+		ids[wh.id] = true
+	}
+	for id := range cfg.RegistrationPolicies {
+		if !ids[id] {
+			return nil, fmt.Errorf("invalid webhook registration failure policy: unknown %q webhook", id)
+		}
+	}
+
+	var webhooks []registration.Webhook
+	for _, wh := range all {
+		if !wh.enabled {
+			continue
+		}
+		wh.webhook.Name = wh.id + ".bitteeinbit.dev"
+		if fp, ok := cfg.RegistrationPolicies[wh.id]; ok {
+			wh.webhook.FailurePolicy = admissionregistrationv1.FailurePolicyType(fp)
+		}
+		webhooks = append(webhooks, wh.webhook)
+	}
+
+	return webhooks, nil
+}
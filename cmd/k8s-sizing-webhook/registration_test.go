@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/http/webhook"
+)
+
+func TestRegistrationWebhooks(t *testing.T) {
+	selfSelector := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "app", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"k8s-sizing-webhook"}},
+		{Key: "release", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"sizing"}},
+	}}
+
+	tests := map[string]struct {
+		cfg      CmdConfig
+		features webhookFeatures
+		expNames []string
+		expErr   bool
+		check    func(assert *assert.Assertions, whs map[string]webhookSummary)
+	}{
+		"Having no features, it should not register webhooks.": {},
+		"Having all the features, they should be registered in order with the chart defaults.": {
+			features: webhookFeatures{allMark: true, memFix: true, hpaMemory: true, cpuBounds: true, nodeFit: true, namespaceBudget: true, sizingLevel: true},
+			expNames: []string{
+				"memfix.bitteeinbit.dev",
+				"allmark.bitteeinbit.dev",
+				"hpamemory.bitteeinbit.dev",
+				"cpubounds.bitteeinbit.dev",
+				"nodefit.bitteeinbit.dev",
+				"namespacebudget.bitteeinbit.dev",
+				"sizinglevel.bitteeinbit.dev",
+			},
+			check: func(assert *assert.Assertions, whs map[string]webhookSummary) {
+				assert.Equal(webhookSummary{path: webhook.MemFixPath, mutating: true, failurePolicy: admissionregistrationv1.Fail, reinvocation: admissionregistrationv1.NeverReinvocationPolicy}, whs["memfix.bitteeinbit.dev"])
+				assert.Equal(webhookSummary{path: webhook.HPAMemoryPath, mutating: true, failurePolicy: admissionregistrationv1.Ignore}, whs["hpamemory.bitteeinbit.dev"])
+				assert.Equal(webhookSummary{path: webhook.SizingLevelPath, failurePolicy: admissionregistrationv1.Ignore}, whs["sizinglevel.bitteeinbit.dev"])
+			},
+		},
+		"Having the VPA coordination, the memfix webhook should be reinvoked.": {
+			features: webhookFeatures{memFix: true, memFixReinvoke: true},
+			expNames: []string{"memfix.bitteeinbit.dev"},
+			check: func(assert *assert.Assertions, whs map[string]webhookSummary) {
+				assert.Equal(admissionregistrationv1.IfNeededReinvocationPolicy, whs["memfix.bitteeinbit.dev"].reinvocation)
+			},
+		},
+		"Having failure policy overrides, they should replace the defaults.": {
+			cfg:      CmdConfig{RegistrationPolicies: map[string]string{"nodefit": "Fail", "memfix": "Ignore"}},
+			features: webhookFeatures{memFix: true, nodeFit: true},
+			expNames: []string{"memfix.bitteeinbit.dev", "nodefit.bitteeinbit.dev"},
+			check: func(assert *assert.Assertions, whs map[string]webhookSummary) {
+				assert.Equal(admissionregistrationv1.Ignore, whs["memfix.bitteeinbit.dev"].failurePolicy)
+				assert.Equal(admissionregistrationv1.Fail, whs["nodefit.bitteeinbit.dev"].failurePolicy)
+			},
+		},
+		"Having a failure policy override of an unknown webhook, it should fail.": {
+			cfg:      CmdConfig{RegistrationPolicies: map[string]string{"memfixx": "Ignore"}},
+			features: webhookFeatures{memFix: true},
+			expErr:   true,
+		},
+		"Having exclude labels, the webhook pods should be excluded from all the webhooks but the HPA one.": {
+			cfg:      CmdConfig{RegistrationExclude: map[string]string{"release": "sizing", "app": "k8s-sizing-webhook"}},
+			features: webhookFeatures{allMark: true, memFix: true, hpaMemory: true, cpuBounds: true, nodeFit: true, namespaceBudget: true, sizingLevel: true},
+			expNames: []string{
+				"memfix.bitteeinbit.dev",
+				"allmark.bitteeinbit.dev",
+				"hpamemory.bitteeinbit.dev",
+				"cpubounds.bitteeinbit.dev",
+				"nodefit.bitteeinbit.dev",
+				"namespacebudget.bitteeinbit.dev",
+				"sizinglevel.bitteeinbit.dev",
+			},
+			check: func(assert *assert.Assertions, whs map[string]webhookSummary) {
+				for name, wh := range whs {
+					if name == "hpamemory.bitteeinbit.dev" {
+						assert.Nil(wh.objectSelector, name)
+						continue
+					}
+					assert.Equal(selfSelector, wh.objectSelector, name)
+				}
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			got, err := registrationWebhooks(&test.cfg, test.features)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			var gotNames []string
+			whs := map[string]webhookSummary{}
+			for _, wh := range got {
+				gotNames = append(gotNames, wh.Name)
+				whs[wh.Name] = webhookSummary{
+					path:           wh.Path,
+					mutating:       wh.Mutating,
+					failurePolicy:  wh.FailurePolicy,
+					reinvocation:   wh.ReinvocationPolicy,
+					objectSelector: wh.ObjectSelector,
+				}
+			}
+			assert.Equal(test.expNames, gotNames)
+			if test.check != nil {
+				test.check(assert, whs)
+			}
+		})
+	}
+}
+
+// webhookSummary are the registered webhook fields checked by the tests, the rules are the chart ones.
+type webhookSummary struct {
+	path           string
+	mutating       bool
+	failurePolicy  admissionregistrationv1.FailurePolicyType
+	reinvocation   admissionregistrationv1.ReinvocationPolicyType
+	objectSelector *metav1.LabelSelector
+}
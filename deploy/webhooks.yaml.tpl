@@ -25,4 +25,108 @@ webhooks:
       - operations: ["CREATE", "UPDATE"]
         apiGroups: ["*"]
         apiVersions: ["*"]
-        resources: ["deployments", "daemonsets", "cronjobs", "jobs", "statefulsets", "pods"]
\ No newline at end of file
+        resources: ["deployments", "daemonsets", "cronjobs", "jobs", "statefulsets", "pods"]
+  - name: hpamemory.bitteeinbit.dev
+    admissionReviewVersions: ["v1"]
+    sideEffects: None
+    # Don't block the HPAs if the webhook can't reach their workloads.
+    failurePolicy: Ignore
+    clientConfig:
+      service:
+        name: k8s-sizing-webhook
+        namespace: k8s-sizing-webhook
+        path: /wh/mutating/hpamemory
+      caBundle: CA_BUNDLE
+    rules:
+      - operations: ["CREATE", "UPDATE"]
+        apiGroups: ["autoscaling"]
+        apiVersions: ["v2"]
+        resources: ["horizontalpodautoscalers"]
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: k8s-sizing-webhook
+  labels:
+    app: k8s-sizing-webhook
+    kind: validator
+webhooks:
+  - name: cpubounds.bitteeinbit.dev
+    # Avoid chicken-egg problem with our webhook deployment.
+    objectSelector:
+      matchExpressions:
+      - key: app
+        operator: NotIn
+        values: ["k8s-sizing-webhook"]
+    admissionReviewVersions: ["v1"]
+    sideEffects: None
+    clientConfig:
+      service:
+        name: k8s-sizing-webhook
+        namespace: k8s-sizing-webhook
+        path: /wh/validating/cpubounds
+      caBundle: CA_BUNDLE
+    rules:
+      - operations: ["CREATE", "UPDATE"]
+        apiGroups: ["*"]
+        apiVersions: ["*"]
+        resources: ["deployments", "daemonsets", "cronjobs", "jobs", "statefulsets", "pods"]
+  - name: nodefit.bitteeinbit.dev
+    # Avoid chicken-egg problem with our webhook deployment.
+    objectSelector:
+      matchExpressions:
+      - key: app
+        operator: NotIn
+        values: ["k8s-sizing-webhook"]
+    admissionReviewVersions: ["v1"]
+    sideEffects: None
+    # Don't block the cluster if the webhook can't reach the nodes.
+    failurePolicy: Ignore
+    clientConfig:
+      service:
+        name: k8s-sizing-webhook
+        namespace: k8s-sizing-webhook
+        path: /wh/validating/nodefit
+      caBundle: CA_BUNDLE
+    rules:
+      - operations: ["CREATE", "UPDATE"]
+        apiGroups: ["*"]
+        apiVersions: ["*"]
+        resources: ["deployments", "daemonsets", "cronjobs", "jobs", "statefulsets", "pods"]
+  - name: namespacebudget.bitteeinbit.dev
+    # Avoid chicken-egg problem with our webhook deployment.
+    objectSelector:
+      matchExpressions:
+      - key: app
+        operator: NotIn
+        values: ["k8s-sizing-webhook"]
+    admissionReviewVersions: ["v1"]
+    sideEffects: None
+    clientConfig:
+      service:
+        name: k8s-sizing-webhook
+        namespace: k8s-sizing-webhook
+        path: /wh/validating/namespacebudget
+      caBundle: CA_BUNDLE
+    rules:
+      - operations: ["CREATE", "UPDATE"]
+        apiGroups: ["apps"]
+        apiVersions: ["v1"]
+        resources: ["deployments", "statefulsets", "deployments/scale", "statefulsets/scale"]
+  - name: sizinglevel.bitteeinbit.dev
+    # The namespaces opt in with the `sizing.bitteeinbit.dev/enforce|warn|audit` labels, read by the webhook.
+    admissionReviewVersions: ["v1"]
+    sideEffects: None
+    # Don't block the cluster if the webhook can't reach the namespaces.
+    failurePolicy: Ignore
+    clientConfig:
+      service:
+        name: k8s-sizing-webhook
+        namespace: k8s-sizing-webhook
+        path: /wh/validating/sizinglevel
+      caBundle: CA_BUNDLE
+    rules:
+      - operations: ["CREATE", "UPDATE"]
+        apiGroups: ["*"]
+        apiVersions: ["*"]
+        resources: ["deployments", "daemonsets", "cronjobs", "jobs", "statefulsets", "pods"]
@@ -0,0 +1,478 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/log"
+)
+
+// The keys of the bootstrap Secret data.
+const (
+	// CACertKey has the PEM CA certificate, followed by the previous one while it's valid.
+	CACertKey = "ca.crt"
+	// CAKeyKey has the PEM CA private key.
+	CAKeyKey = "ca.key"
+	// CertKey has the PEM serving certificate.
+	CertKey = corev1.TLSCertKey
+	// KeyKey has the PEM serving certificate private key.
+	KeyKey = corev1.TLSPrivateKeyKey
+)
+
+// BootstrapConfig is the configuration of the certificate bootstrapper.
+type BootstrapConfig struct {
+	// Client is the Kubernetes client used to manage the Secret and the webhook configurations.
+	Client kubernetes.Interface
+	// Namespace is the namespace of the Secret.
+	Namespace string
+	// SecretName is the name of the Secret storing the CA and the serving certificate, shared by all the replicas.
+	SecretName string
+	// DNSNames are the names of the serving certificate, the webhook service ones (e.g `webhook.ns.svc`).
+	DNSNames []string
+	// WebhookConfigurationName is the name of the MutatingWebhookConfiguration and ValidatingWebhookConfiguration
+	// whose webhooks caBundle are patched with the CA, the missing ones are skipped.
+	WebhookConfigurationName string
+	// CAValidity is the validity of the generated CAs, by default 10 years.
+	CAValidity time.Duration
+	// CertValidity is the validity of the generated serving certificates, by default 1 year.
+	CertValidity time.Duration
+	// RenewBefore is how long before expiring the CA and the serving certificate are renewed, by default 30 days.
+	RenewBefore time.Duration
+	// Interval is how often the certificates are checked, by default 1h.
+	Interval time.Duration
+	// MetricsRecorder records the certificate expiry and the reloads.
+	MetricsRecorder MetricsRecorder
+	// Logger logs the renewals.
+	Logger log.Logger
+}
+
+func (c *BootstrapConfig) defaults() error {
+	if c.Client == nil {
+		return fmt.Errorf("kubernetes client is required")
+	}
+
+	if c.Namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+
+	if c.SecretName == "" {
+		return fmt.Errorf("secret name is required")
+	}
+
+	if len(c.DNSNames) == 0 {
+		return fmt.Errorf("dns names are required")
+	}
+
+	if c.CAValidity <= 0 {
+		c.CAValidity = 10 * 365 * 24 * time.Hour
+	}
+
+	if c.CertValidity <= 0 {
+		c.CertValidity = 365 * 24 * time.Hour
+	}
+
+	if c.RenewBefore <= 0 {
+		c.RenewBefore = 30 * 24 * time.Hour
+	}
+
+	if c.RenewBefore >= c.CertValidity || c.CertValidity >= c.CAValidity {
+		return fmt.Errorf("the renew before (%s) must be shorter than the certificate validity (%s), and this shorter than the CA validity (%s)", c.RenewBefore, c.CertValidity, c.CAValidity)
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = time.Hour
+	}
+
+	if c.MetricsRecorder == nil {
+		c.MetricsRecorder = DummyMetricsRecorder
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	return nil
+}
+
+// Bootstrapper generates a CA and a serving certificate, stores them in a Secret shared by all the replicas, serves
+// the certificate and sets the CA on the webhook configurations. They are renewed before expiring.
+type Bootstrapper struct {
+	cfg    BootstrapConfig
+	logger log.Logger
+	active atomic.Pointer[tls.Certificate]
+	ca     atomic.Pointer[[]byte]
+	mu     sync.Mutex
+}
+
+// NewBootstrapper returns a new certificate bootstrapper, Sync must be called before serving the certificate.
+func NewBootstrapper(config BootstrapConfig) (*Bootstrapper, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return &Bootstrapper{
+		cfg:    config,
+		logger: config.Logger.WithKV(log.KV{"svc": "cert.Bootstrapper", "secret": config.Namespace + "/" + config.SecretName}),
+	}, nil
+}
+
+// GetCertificate returns the active certificate, it satisfies tls.Config GetCertificate.
+func (b *Bootstrapper) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := b.active.Load()
+	if cert == nil {
+		return nil, fmt.Errorf("certificate not bootstrapped yet")
+	}
+
+	return cert, nil
+}
+
+// CABundle returns the PEM CA of the active certificate, nil until the certificates are synced.
+func (b *Bootstrapper) CABundle() []byte {
+	ca := b.ca.Load()
+	if ca == nil {
+		return nil
+	}
+
+	return *ca
+}
+
+// Sync generates or renews the certificates of the Secret if required, serves its certificate and sets its CA on
+// the webhook configurations.
+func (b *Bootstrapper) Sync(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := b.sync(ctx)
+	if err != nil {
+		b.cfg.MetricsRecorder.IncCertificateReload(false)
+		b.logger.Errorf("could not sync certificates: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bootstrapper) sync(ctx context.Context) error {
+	secrets := b.cfg.Client.CoreV1().Secrets(b.cfg.Namespace)
+
+	// Other replicas could be storing their certificates at the same time, on conflict the stored ones are used.
+	var secret *corev1.Secret
+	for attempt := 0; ; attempt++ {
+		var err error
+		secret, err = secrets.Get(ctx, b.cfg.SecretName, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("could not get secret: %w", err)
+		}
+		exists := err == nil
+
+		var data map[string][]byte
+		if exists {
+			data = secret.Data
+		}
+		newData, changed, err := b.renew(data, time.Now())
+		if err != nil {
+			return err
+		}
+		if !changed {
+			break
+		}
+
+		if exists {
+			secret = secret.DeepCopy()
+			secret.Data = newData
+			secret, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		} else {
+			secret, err = secrets.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: b.cfg.SecretName, Namespace: b.cfg.Namespace},
+				Type:       corev1.SecretTypeOpaque,
+				Data:       newData,
+			}, metav1.CreateOptions{})
+		}
+		if err == nil {
+			b.logger.Infof("certificates stored")
+			break
+		}
+		if attempt == 0 && (apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)) {
+			continue
+		}
+		return fmt.Errorf("could not store secret: %w", err)
+	}
+
+	err := b.load(secret.Data)
+	if err != nil {
+		return err
+	}
+	ca := secret.Data[CACertKey]
+	b.ca.Store(&ca)
+
+	return b.patchCABundle(ctx, secret.Data[CACertKey])
+}
+
+// renew returns the Secret data with the missing, invalid or expiring certificates renewed, and if it changed.
+func (b *Bootstrapper) renew(data map[string][]byte, now time.Time) (map[string][]byte, bool, error) {
+	renewAt := now.Add(b.cfg.RenewBefore)
+
+	caCerts := parseCerts(data[CACertKey])
+	caKey, caKeyErr := parseKey(data[CAKeyKey])
+	var ca *x509.Certificate
+	if len(caCerts) > 0 && caKeyErr == nil && caKey.PublicKey.Equal(caCerts[0].PublicKey) && caCerts[0].NotAfter.After(renewAt) {
+		ca = caCerts[0]
+	}
+
+	newData := map[string][]byte{
+		CACertKey: data[CACertKey],
+		CAKeyKey:  data[CAKeyKey],
+		CertKey:   data[CertKey],
+		KeyKey:    data[KeyKey],
+	}
+	changed := false
+
+	if ca == nil {
+		var err error
+		ca, caKey, err = newCA(now, b.cfg.CAValidity)
+		if err != nil {
+			return nil, false, err
+		}
+		// The previous CA is kept in the bundle, so the replicas still serving its certificates are trusted.
+		bundle := encodeCert(ca)
+		if len(caCerts) > 0 && caCerts[0].NotAfter.After(now) {
+			bundle = append(bundle, encodeCert(caCerts[0])...)
+		}
+		keyPEM, err := encodeKey(caKey)
+		if err != nil {
+			return nil, false, err
+		}
+		newData[CACertKey], newData[CAKeyKey] = bundle, keyPEM
+		changed = true
+		b.logger.Infof("CA generated, expires at %s", ca.NotAfter.Format(time.RFC3339))
+	}
+
+	certs := parseCerts(data[CertKey])
+	_, keyErr := tls.X509KeyPair(data[CertKey], data[KeyKey])
+	if changed || len(certs) == 0 || keyErr != nil || !certs[0].NotAfter.After(renewAt) ||
+		certs[0].CheckSignatureFrom(ca) != nil || !slices.Equal(certs[0].DNSNames, b.cfg.DNSNames) {
+		cert, key, err := newServingCert(now, b.cfg.CertValidity, b.cfg.DNSNames, ca, caKey)
+		if err != nil {
+			return nil, false, err
+		}
+		keyPEM, err := encodeKey(key)
+		if err != nil {
+			return nil, false, err
+		}
+		newData[CertKey], newData[KeyKey] = encodeCert(cert), keyPEM
+		changed = true
+		b.logger.Infof("serving certificate generated, expires at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+
+	return newData, changed, nil
+}
+
+// load serves the certificate of the Secret data if it changed.
+func (b *Bootstrapper) load(data map[string][]byte) error {
+	cert, err := tls.X509KeyPair(data[CertKey], data[KeyKey])
+	if err != nil {
+		return fmt.Errorf("could not load certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("could not parse certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	if active := b.active.Load(); active != nil && active.Leaf.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+		return nil
+	}
+
+	b.active.Store(&cert)
+	b.cfg.MetricsRecorder.IncCertificateReload(true)
+	b.cfg.MetricsRecorder.SetCertificateExpiry(leaf.NotAfter)
+	b.logger.WithKV(log.KV{"serial": leaf.SerialNumber.String()}).Infof("certificate loaded, expires at %s", leaf.NotAfter.Format(time.RFC3339))
+
+	return nil
+}
+
+// patchCABundle sets the CA bundle on all the webhooks of the webhook configurations.
+func (b *Bootstrapper) patchCABundle(ctx context.Context, bundle []byte) error {
+	if b.cfg.WebhookConfigurationName == "" {
+		return nil
+	}
+	name := b.cfg.WebhookConfigurationName
+	admissionregistration := b.cfg.Client.AdmissionregistrationV1()
+
+	mwc, err := admissionregistration.MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		b.logger.Debugf("mutating webhook configuration %s not found", name)
+	case err != nil:
+		return fmt.Errorf("could not get mutating webhook configuration: %w", err)
+	default:
+		changed := false
+		for i, wh := range mwc.Webhooks {
+			if !bytes.Equal(wh.ClientConfig.CABundle, bundle) {
+				mwc.Webhooks[i].ClientConfig.CABundle = bundle
+				changed = true
+			}
+		}
+		if changed {
+			_, err := admissionregistration.MutatingWebhookConfigurations().Update(ctx, mwc, metav1.UpdateOptions{})
+			if err != nil {
+				return fmt.Errorf("could not update mutating webhook configuration: %w", err)
+			}
+			b.logger.Infof("mutating webhook configuration %s caBundle patched", name)
+		}
+	}
+
+	vwc, err := admissionregistration.ValidatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		b.logger.Debugf("validating webhook configuration %s not found", name)
+	case err != nil:
+		return fmt.Errorf("could not get validating webhook configuration: %w", err)
+	default:
+		changed := false
+		for i, wh := range vwc.Webhooks {
+			if !bytes.Equal(wh.ClientConfig.CABundle, bundle) {
+				vwc.Webhooks[i].ClientConfig.CABundle = bundle
+				changed = true
+			}
+		}
+		if changed {
+			_, err := admissionregistration.ValidatingWebhookConfigurations().Update(ctx, vwc, metav1.UpdateOptions{})
+			if err != nil {
+				return fmt.Errorf("could not update validating webhook configuration: %w", err)
+			}
+			b.logger.Infof("validating webhook configuration %s caBundle patched", name)
+		}
+	}
+
+	return nil
+}
+
+// Run syncs the certificates on every interval until the context is done.
+func (b *Bootstrapper) Run(ctx context.Context) error {
+	t := time.NewTicker(b.cfg.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			_ = b.Sync(ctx)
+		}
+	}
+}
+
+func newCA(now time.Time, validity time.Duration) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	return newCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "k8s-sizing-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+}
+
+func newServingCert(now time.Time, validity time.Duration, dnsNames []string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	notAfter := now.Add(validity)
+	if notAfter.After(ca.NotAfter) {
+		notAfter = ca.NotAfter
+	}
+
+	return newCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:    dnsNames,
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+}
+
+// newCert returns a new certificate from the template signed by the parent, self-signed if nil.
+func newCert(tpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not generate key: %w", err)
+	}
+	tpl.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not generate serial number: %w", err)
+	}
+	if parent == nil {
+		parent, parentKey = tpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not parse certificate: %w", err)
+	}
+
+	return cert, key, nil
+}
+
+func encodeCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// parseCerts returns the valid PEM certificates of the data.
+func parseCerts(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+}
+
+func parseKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("missing PEM key")
+	}
+
+	return x509.ParseECPrivateKey(block.Bytes)
+}
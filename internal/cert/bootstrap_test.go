@@ -0,0 +1,206 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/cert"
+)
+
+var testDNSNames = []string{"webhook.test.svc", "webhook.test.svc.cluster.local"}
+
+func newTestBootstrapper(t *testing.T, cli *fake.Clientset, config cert.BootstrapConfig) *cert.Bootstrapper {
+	t.Helper()
+
+	config.Client = cli
+	config.Namespace = "test"
+	config.SecretName = "webhook-certs"
+	config.DNSNames = testDNSNames
+	config.WebhookConfigurationName = "webhook"
+	b, err := cert.NewBootstrapper(config)
+	require.NoError(t, err)
+
+	return b
+}
+
+// parseTestCerts returns the PEM certificates of the data.
+func parseTestCerts(t *testing.T, data []byte) []*x509.Certificate {
+	t.Helper()
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		certs = append(certs, c)
+	}
+}
+
+func TestBootstrapperSync(t *testing.T) {
+	shortLived := cert.BootstrapConfig{CAValidity: 48 * time.Hour, CertValidity: 24 * time.Hour, RenewBefore: time.Hour}
+
+	tests := map[string]struct {
+		// previous is the configuration of the replica that stored the certificates before, none if nil.
+		previous    *cert.BootstrapConfig
+		config      cert.BootstrapConfig
+		expRenewed  bool
+		expCAs      int
+		expSameCA   bool
+		expWebhooks bool
+	}{
+		"Having no certificates, they should be generated.": {
+			expRenewed:  true,
+			expCAs:      1,
+			expWebhooks: true,
+		},
+		"Having valid certificates, they should be used.": {
+			previous:    &cert.BootstrapConfig{},
+			expCAs:      1,
+			expSameCA:   true,
+			expWebhooks: true,
+		},
+		"Having an expiring serving certificate, it should be renewed with the same CA.": {
+			previous:    &cert.BootstrapConfig{CAValidity: 365 * 24 * time.Hour, CertValidity: 24 * time.Hour, RenewBefore: time.Hour},
+			config:      cert.BootstrapConfig{CAValidity: 365 * 24 * time.Hour, CertValidity: 48 * time.Hour, RenewBefore: 36 * time.Hour},
+			expRenewed:  true,
+			expCAs:      1,
+			expSameCA:   true,
+			expWebhooks: true,
+		},
+		"Having an expiring CA, it should be renewed keeping the previous one in the bundle.": {
+			previous:    &shortLived,
+			expRenewed:  true,
+			expCAs:      2,
+			expWebhooks: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			ctx := context.Background()
+
+			cli := fake.NewSimpleClientset(
+				&admissionregistrationv1.MutatingWebhookConfiguration{
+					ObjectMeta: metav1.ObjectMeta{Name: "webhook"},
+					Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "allmark.bitteeinbit.dev"}, {Name: "memfix.bitteeinbit.dev"}},
+				},
+				&admissionregistrationv1.ValidatingWebhookConfiguration{
+					ObjectMeta: metav1.ObjectMeta{Name: "webhook"},
+					Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "cpubounds.bitteeinbit.dev"}},
+				},
+			)
+
+			var previous *corev1.Secret
+			if test.previous != nil {
+				require.NoError(newTestBootstrapper(t, cli, *test.previous).Sync(ctx))
+				var err error
+				previous, err = cli.CoreV1().Secrets("test").Get(ctx, "webhook-certs", metav1.GetOptions{})
+				require.NoError(err)
+			}
+
+			b := newTestBootstrapper(t, cli, test.config)
+			_, err := b.GetCertificate(nil)
+			assert.Error(err, "the certificate should not be served before the sync")
+
+			require.NoError(b.Sync(ctx))
+
+			secret, err := cli.CoreV1().Secrets("test").Get(ctx, "webhook-certs", metav1.GetOptions{})
+			require.NoError(err)
+			if previous != nil {
+				assert.Equal(test.expRenewed, string(previous.Data[cert.CertKey]) != string(secret.Data[cert.CertKey]))
+				assert.Equal(test.expSameCA, string(previous.Data[cert.CAKeyKey]) == string(secret.Data[cert.CAKeyKey]))
+			}
+
+			// The served certificate is the stored one, valid for the service names and trusted by the CA bundle.
+			cas := parseTestCerts(t, secret.Data[cert.CACertKey])
+			assert.Len(cas, test.expCAs)
+			assert.Equal(secret.Data[cert.CACertKey], b.CABundle())
+			served, err := b.GetCertificate(nil)
+			require.NoError(err)
+			assert.Equal(parseTestCerts(t, secret.Data[cert.CertKey])[0].SerialNumber, served.Leaf.SerialNumber)
+			pool := x509.NewCertPool()
+			require.True(pool.AppendCertsFromPEM(secret.Data[cert.CACertKey]))
+			_, err = served.Leaf.Verify(x509.VerifyOptions{DNSName: testDNSNames[0], Roots: pool})
+			assert.NoError(err)
+
+			mwc, err := cli.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "webhook", metav1.GetOptions{})
+			require.NoError(err)
+			for _, wh := range mwc.Webhooks {
+				assert.Equal(secret.Data[cert.CACertKey], wh.ClientConfig.CABundle)
+			}
+			vwc, err := cli.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "webhook", metav1.GetOptions{})
+			require.NoError(err)
+			for _, wh := range vwc.Webhooks {
+				assert.Equal(secret.Data[cert.CACertKey], wh.ClientConfig.CABundle)
+			}
+		})
+	}
+}
+
+func TestBootstrapperSyncWithoutWebhookConfigurations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cli := fake.NewSimpleClientset()
+	b := newTestBootstrapper(t, cli, cert.BootstrapConfig{})
+	assert.Nil(b.CABundle())
+
+	require.NoError(b.Sync(context.Background()))
+	_, err := b.GetCertificate(nil)
+	assert.NoError(err)
+}
+
+func TestNewBootstrapper(t *testing.T) {
+	tests := map[string]struct {
+		config cert.BootstrapConfig
+		expErr bool
+	}{
+		"Having a valid configuration, it should not fail.": {
+			config: cert.BootstrapConfig{Client: fake.NewSimpleClientset(), Namespace: "test", SecretName: "certs", DNSNames: testDNSNames},
+		},
+		"Having no DNS names, it should fail.": {
+			config: cert.BootstrapConfig{Client: fake.NewSimpleClientset(), Namespace: "test", SecretName: "certs"},
+			expErr: true,
+		},
+		"Having a renewal longer than the certificate validity, it should fail.": {
+			config: cert.BootstrapConfig{
+				Client:       fake.NewSimpleClientset(),
+				Namespace:    "test",
+				SecretName:   "certs",
+				DNSNames:     testDNSNames,
+				CertValidity: 24 * time.Hour,
+				RenewBefore:  48 * time.Hour,
+			},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := cert.NewBootstrapper(test.config)
+			if test.expErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/log"
+)
+
+// MetricsRecorder knows how to record the certificate metrics.
+type MetricsRecorder interface {
+	// SetCertificateExpiry records when the served certificate expires.
+	SetCertificateExpiry(notAfter time.Time)
+	// IncCertificateReload records a certificate reload attempt.
+	IncCertificateReload(success bool)
+}
+
+// DummyMetricsRecorder is a metrics recorder that doesn't record anything.
+var DummyMetricsRecorder MetricsRecorder = dummyMetricsRecorder(0)
+
+type dummyMetricsRecorder int
+
+func (dummyMetricsRecorder) SetCertificateExpiry(_ time.Time) {}
+func (dummyMetricsRecorder) IncCertificateReload(_ bool)      {}
+
+// ReloaderConfig is the configuration of the certificate reloader.
+type ReloaderConfig struct {
+	// CertFile is the PEM certificate file, normally a mounted Secret (e.g managed by cert-manager).
+	CertFile string
+	// KeyFile is the PEM private key file of the certificate.
+	KeyFile string
+	// Interval is how often the files are checked for changes, by default 10s.
+	Interval time.Duration
+	// MetricsRecorder records the certificate expiry and the reloads.
+	MetricsRecorder MetricsRecorder
+	// Logger logs the reloads.
+	Logger log.Logger
+}
+
+func (c *ReloaderConfig) defaults() error {
+	if c.CertFile == "" {
+		return fmt.Errorf("certificate file is required")
+	}
+
+	if c.KeyFile == "" {
+		return fmt.Errorf("key file is required")
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+
+	if c.MetricsRecorder == nil {
+		c.MetricsRecorder = DummyMetricsRecorder
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	return nil
+}
+
+// Reloader serves the certificate of the files and reloads it when they change, if the new certificate is
+// invalid the active one is kept.
+type Reloader struct {
+	cfg    ReloaderConfig
+	logger log.Logger
+	active atomic.Pointer[tls.Certificate]
+	mu     sync.Mutex
+	// certData and keyData are the last loaded files, so an unchanged or invalid pair is only loaded once.
+	certData []byte
+	keyData  []byte
+}
+
+// NewReloader returns a new certificate reloader with the certificate of the files loaded.
+func NewReloader(config ReloaderConfig) (*Reloader, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	r := &Reloader{
+		cfg:    config,
+		logger: config.Logger.WithKV(log.KV{"svc": "cert.Reloader", "cert": config.CertFile}),
+	}
+	err = r.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate returns the active certificate, it satisfies tls.Config GetCertificate.
+func (r *Reloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.active.Load(), nil
+}
+
+// Reload loads the certificate files and replaces the active certificate if they changed.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certData, err := os.ReadFile(r.cfg.CertFile)
+	if err != nil {
+		r.cfg.MetricsRecorder.IncCertificateReload(false)
+		r.logger.Errorf("could not read certificate file, keeping the active certificate: %s", err)
+		return fmt.Errorf("could not read certificate file: %w", err)
+	}
+	keyData, err := os.ReadFile(r.cfg.KeyFile)
+	if err != nil {
+		r.cfg.MetricsRecorder.IncCertificateReload(false)
+		r.logger.Errorf("could not read key file, keeping the active certificate: %s", err)
+		return fmt.Errorf("could not read key file: %w", err)
+	}
+
+	// The files are not updated at the same time, a failed pair is retried when any of them changes.
+	if bytes.Equal(certData, r.certData) && bytes.Equal(keyData, r.keyData) {
+		return nil
+	}
+	r.certData, r.keyData = certData, keyData
+
+	cert, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		r.cfg.MetricsRecorder.IncCertificateReload(false)
+		r.logger.Errorf("could not load certificate, keeping the active certificate: %s", err)
+		return fmt.Errorf("could not load certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		r.cfg.MetricsRecorder.IncCertificateReload(false)
+		r.logger.Errorf("could not parse certificate, keeping the active certificate: %s", err)
+		return fmt.Errorf("could not parse certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	r.active.Store(&cert)
+	r.cfg.MetricsRecorder.IncCertificateReload(true)
+	r.cfg.MetricsRecorder.SetCertificateExpiry(leaf.NotAfter)
+	r.logger.WithKV(log.KV{"serial": leaf.SerialNumber.String()}).Infof("certificate loaded, expires at %s", leaf.NotAfter.Format(time.RFC3339))
+
+	return nil
+}
+
+// Run reloads the certificate on every interval until the context is done.
+func (r *Reloader) Run(ctx context.Context) error {
+	t := time.NewTicker(r.cfg.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			_ = r.Reload()
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package cert_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/cert"
+)
+
+type testMetricsRecorder struct {
+	expiry  time.Time
+	reloads map[bool]int
+}
+
+func (t *testMetricsRecorder) SetCertificateExpiry(notAfter time.Time) { t.expiry = notAfter }
+func (t *testMetricsRecorder) IncCertificateReload(success bool) {
+	if t.reloads == nil {
+		t.reloads = map[bool]int{}
+	}
+	t.reloads[success]++
+}
+
+// newTestKeyPair returns a PEM self-signed certificate and key with the serial number, expiring at notAfter.
+func newTestKeyPair(t *testing.T, serial int64, notAfter time.Time) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestReloaderReload(t *testing.T) {
+	initialExpiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	newExpiry := time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		update        func(t *testing.T, certFile, keyFile string)
+		expErr        bool
+		expSerial     int64
+		expExpiry     time.Time
+		expReloadsOK  int
+		expReloadsErr int
+	}{
+		"Having the same certificate, it should not be reloaded.": {
+			update:       func(t *testing.T, certFile, keyFile string) {},
+			expSerial:    1,
+			expExpiry:    initialExpiry,
+			expReloadsOK: 1,
+		},
+		"Having a rotated certificate, it should be replaced.": {
+			update: func(t *testing.T, certFile, keyFile string) {
+				c, k := newTestKeyPair(t, 2, newExpiry)
+				require.NoError(t, os.WriteFile(certFile, c, 0o600))
+				require.NoError(t, os.WriteFile(keyFile, k, 0o600))
+			},
+			expSerial:    2,
+			expExpiry:    newExpiry,
+			expReloadsOK: 2,
+		},
+		"Having a certificate without its key, the active one should be kept.": {
+			update: func(t *testing.T, certFile, keyFile string) {
+				c, _ := newTestKeyPair(t, 2, newExpiry)
+				require.NoError(t, os.WriteFile(certFile, c, 0o600))
+			},
+			expErr:        true,
+			expSerial:     1,
+			expExpiry:     initialExpiry,
+			expReloadsOK:  1,
+			expReloadsErr: 1,
+		},
+		"Having a missing certificate file, the active one should be kept.": {
+			update: func(t *testing.T, certFile, keyFile string) {
+				require.NoError(t, os.Remove(certFile))
+			},
+			expErr:        true,
+			expSerial:     1,
+			expExpiry:     initialExpiry,
+			expReloadsOK:  1,
+			expReloadsErr: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			dir := t.TempDir()
+			certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+			c, k := newTestKeyPair(t, 1, initialExpiry)
+			require.NoError(os.WriteFile(certFile, c, 0o600))
+			require.NoError(os.WriteFile(keyFile, k, 0o600))
+
+			rec := &testMetricsRecorder{}
+			r, err := cert.NewReloader(cert.ReloaderConfig{CertFile: certFile, KeyFile: keyFile, MetricsRecorder: rec})
+			require.NoError(err)
+
+			test.update(t, certFile, keyFile)
+			err = r.Reload()
+			if test.expErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+
+			active, err := r.GetCertificate(nil)
+			require.NoError(err)
+			assert.Equal(test.expSerial, active.Leaf.SerialNumber.Int64())
+			assert.Equal(test.expExpiry, rec.expiry)
+			assert.Equal(test.expReloadsOK, rec.reloads[true])
+			assert.Equal(test.expReloadsErr, rec.reloads[false])
+		})
+	}
+}
+
+func TestNewReloaderInvalidCertificate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.NoError(os.WriteFile(certFile, []byte("invalid"), 0o600))
+	require.NoError(os.WriteFile(keyFile, []byte("invalid"), 0o600))
+
+	_, err := cert.NewReloader(cert.ReloaderConfig{CertFile: certFile, KeyFile: keyFile})
+	assert.Error(err)
+}
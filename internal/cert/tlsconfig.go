@@ -0,0 +1,108 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	curves = map[string]tls.CurveID{
+		"X25519": tls.X25519,
+		"P256":   tls.CurveP256,
+		"P384":   tls.CurveP384,
+		"P521":   tls.CurveP521,
+	}
+)
+
+// ServerConfig is the TLS configuration of the webhook server.
+type ServerConfig struct {
+	// GetCertificate returns the served certificate, e.g the reloader or bootstrapper one.
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// MinVersion is the minimum TLS version, `1.2` or `1.3`, by default `1.2`.
+	MinVersion string
+	// CipherSuites are the names of the TLS 1.2 cipher suites (e.g `TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256`), the
+	// Go defaults if empty. The TLS 1.3 cipher suites are not configurable.
+	CipherSuites []string
+	// CurvePreferences are the names of the key exchange curves (`X25519`, `P256`, `P384` or `P521`) in order of
+	// preference, the Go defaults if empty.
+	CurvePreferences []string
+	// ClientCAFile is the PEM CA file that the client certificates are verified against, if set the clients must
+	// present a certificate (e.g the API server configured to authenticate to the webhooks).
+	ClientCAFile string
+}
+
+func (c *ServerConfig) defaults() error {
+	if c.GetCertificate == nil {
+		return fmt.Errorf("get certificate is required")
+	}
+
+	if c.MinVersion == "" {
+		c.MinVersion = "1.2"
+	}
+
+	if _, ok := tlsVersions[c.MinVersion]; !ok {
+		return fmt.Errorf("invalid minimum TLS version %q, must be 1.2 or 1.3", c.MinVersion)
+	}
+
+	if c.MinVersion == "1.3" && len(c.CipherSuites) > 0 {
+		return fmt.Errorf("the cipher suites can't be set with the TLS 1.3 minimum version")
+	}
+
+	return nil
+}
+
+// NewServerTLSConfig returns the TLS configuration of the webhook server, only the secure cipher suites can be used.
+func NewServerTLSConfig(config ServerConfig) (*tls.Config, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: config.GetCertificate,
+		MinVersion:     tlsVersions[config.MinVersion],
+	}
+
+	if len(config.CipherSuites) > 0 {
+		suites := map[string]uint16{}
+		for _, s := range tls.CipherSuites() {
+			suites[s.Name] = s.ID
+		}
+		for _, name := range config.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("invalid configuration: unknown or insecure cipher suite %q", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+
+	for _, name := range config.CurvePreferences {
+		id, ok := curves[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid configuration: unknown curve %q, must be X25519, P256, P384 or P521", name)
+		}
+		tlsConfig.CurvePreferences = append(tlsConfig.CurvePreferences, id)
+	}
+
+	if config.ClientCAFile != "" {
+		data, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("invalid client CA file: no PEM certificates")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,152 @@
+package cert_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/cert"
+)
+
+func testGetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil }
+
+func TestNewServerTLSConfig(t *testing.T) {
+	tests := map[string]struct {
+		config        cert.ServerConfig
+		expErr        bool
+		expMinVersion uint16
+		expSuites     []uint16
+		expCurves     []tls.CurveID
+	}{
+		"Having the default configuration, it should require TLS 1.2.": {
+			config:        cert.ServerConfig{GetCertificate: testGetCertificate},
+			expMinVersion: tls.VersionTLS12,
+		},
+		"Having cipher suites and curves, they should be set in order.": {
+			config: cert.ServerConfig{
+				GetCertificate:   testGetCertificate,
+				CipherSuites:     []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+				CurvePreferences: []string{"P384", "X25519"},
+			},
+			expMinVersion: tls.VersionTLS12,
+			expSuites:     []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			expCurves:     []tls.CurveID{tls.CurveP384, tls.X25519},
+		},
+		"Having the TLS 1.3 minimum version, it should be set.": {
+			config:        cert.ServerConfig{GetCertificate: testGetCertificate, MinVersion: "1.3"},
+			expMinVersion: tls.VersionTLS13,
+		},
+		"Having cipher suites with the TLS 1.3 minimum version, it should fail.": {
+			config: cert.ServerConfig{GetCertificate: testGetCertificate, MinVersion: "1.3", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}},
+			expErr: true,
+		},
+		"Having an insecure cipher suite, it should fail.": {
+			config: cert.ServerConfig{GetCertificate: testGetCertificate, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			expErr: true,
+		},
+		"Having an unknown curve, it should fail.": {
+			config: cert.ServerConfig{GetCertificate: testGetCertificate, CurvePreferences: []string{"P224"}},
+			expErr: true,
+		},
+		"Having an invalid minimum version, it should fail.": {
+			config: cert.ServerConfig{GetCertificate: testGetCertificate, MinVersion: "1.0"},
+			expErr: true,
+		},
+		"Having a missing client CA file, it should fail.": {
+			config: cert.ServerConfig{GetCertificate: testGetCertificate, ClientCAFile: "/missing/ca.crt"},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			got, err := cert.NewServerTLSConfig(test.config)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expMinVersion, got.MinVersion)
+			assert.Equal(test.expSuites, got.CipherSuites)
+			assert.Equal(test.expCurves, got.CurvePreferences)
+			assert.Equal(tls.NoClientCert, got.ClientAuth)
+		})
+	}
+}
+
+func TestNewServerTLSConfigClientCA(t *testing.T) {
+	expiry := time.Now().Add(24 * time.Hour)
+	serverCert, serverKey := newTestKeyPair(t, 1, expiry)
+	clientCert, clientKey := newTestKeyPair(t, 2, expiry)
+	otherCert, otherKey := newTestKeyPair(t, 3, expiry)
+
+	tests := map[string]struct {
+		certPEM, keyPEM []byte
+		expErr          bool
+	}{
+		"Having a client certificate signed by the CA, it should be accepted.": {
+			certPEM: clientCert,
+			keyPEM:  clientKey,
+		},
+		"Having a client certificate not signed by the CA, it should be rejected.": {
+			certPEM: otherCert,
+			keyPEM:  otherKey,
+			expErr:  true,
+		},
+		"Having no client certificate, it should be rejected.": {
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			// The self-signed client certificate is its own CA.
+			caFile := filepath.Join(t.TempDir(), "ca.crt")
+			require.NoError(os.WriteFile(caFile, clientCert, 0o600))
+			served, err := tls.X509KeyPair(serverCert, serverKey)
+			require.NoError(err)
+
+			tlsConfig, err := cert.NewServerTLSConfig(cert.ServerConfig{
+				GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &served, nil },
+				ClientCAFile:   caFile,
+			})
+			require.NoError(err)
+
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			srv.TLS = tlsConfig
+			srv.StartTLS()
+			defer srv.Close()
+
+			clientTLS := &tls.Config{InsecureSkipVerify: true} // The test server certificate is self-signed.
+			if test.certPEM != nil {
+				c, err := tls.X509KeyPair(test.certPEM, test.keyPEM)
+				require.NoError(err)
+				clientTLS.Certificates = []tls.Certificate{c}
+			}
+			cli := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+
+			resp, err := cli.Get(srv.URL)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			_ = resp.Body.Close()
+			assert.Equal(http.StatusOK, resp.StatusCode)
+		})
+	}
+}
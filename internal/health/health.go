@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Check is a readiness check, it returns why the component is not ready.
+type Check struct {
+	Name  string
+	Check func() error
+}
+
+// NewReadyHandler returns a handler that responds 200 when all the checks pass, and 503 with the failing
+// checks otherwise.
+func NewReadyHandler(checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		var b strings.Builder
+		ready := true
+		for _, c := range checks {
+			err := c.Check()
+			if err != nil {
+				ready = false
+				fmt.Fprintf(&b, "[-]%s failed: %s\n", c.Name, err)
+				continue
+			}
+			fmt.Fprintf(&b, "[+]%s ok\n", c.Name)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write([]byte(b.String()))
+	})
+}
+
+// Wait waits until all the checks pass, checking them on every interval, or the context is done.
+func Wait(ctx context.Context, interval time.Duration, checks ...Check) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		err := firstFailure(checks)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-t.C:
+		}
+	}
+}
+
+func firstFailure(checks []Check) error {
+	for _, c := range checks {
+		err := c.Check()
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Status is the state of a component set by itself, e.g when its server is listening.
+type Status struct {
+	err atomic.Pointer[error]
+}
+
+// NewStatus returns a status that is not ready with the reason until it's set.
+func NewStatus(reason string) *Status {
+	s := &Status{}
+	s.Set(errors.New(reason))
+	return s
+}
+
+// Set sets why the component is not ready, nil if ready.
+func (s *Status) Set(err error) {
+	s.err.Store(&err)
+}
+
+// Check returns why the component is not ready.
+func (s *Status) Check() error {
+	return *s.err.Load()
+}
+
+// CertificateCheck returns a check that fails while the served certificate is not loaded or not valid.
+func CertificateCheck(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func() error {
+	return func() error {
+		cert, err := getCertificate(nil)
+		if err != nil {
+			return err
+		}
+		if cert == nil || len(cert.Certificate) == 0 {
+			return fmt.Errorf("certificate not loaded")
+		}
+
+		leaf := cert.Leaf
+		if leaf == nil {
+			leaf, err = x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				return fmt.Errorf("could not parse certificate: %w", err)
+			}
+		}
+
+		now := time.Now()
+		switch {
+		case now.Before(leaf.NotBefore):
+			return fmt.Errorf("certificate not valid before %s", leaf.NotBefore.Format(time.RFC3339))
+		case now.After(leaf.NotAfter):
+			return fmt.Errorf("certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+		}
+
+		return nil
+	}
+}
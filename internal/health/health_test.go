@@ -0,0 +1,186 @@
+package health_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/health"
+)
+
+func TestReadyHandler(t *testing.T) {
+	tests := map[string]struct {
+		checks  func() []health.Check
+		expCode int
+		expBody string
+	}{
+		"Having no checks, it should be ready.": {
+			checks:  func() []health.Check { return nil },
+			expCode: http.StatusOK,
+		},
+		"Having all the checks passing, it should be ready.": {
+			checks: func() []health.Check {
+				s := health.NewStatus("not listening")
+				s.Set(nil)
+				return []health.Check{{Name: "server", Check: s.Check}}
+			},
+			expCode: http.StatusOK,
+			expBody: "[+]server ok\n",
+		},
+		"Having a status not set, it should not be ready.": {
+			checks: func() []health.Check {
+				return []health.Check{
+					{Name: "server", Check: health.NewStatus("not listening").Check},
+					{Name: "other", Check: func() error { return nil }},
+				}
+			},
+			expCode: http.StatusServiceUnavailable,
+			expBody: "[-]server failed: not listening\n[+]other ok\n",
+		},
+		"Having a status set with an error, it should not be ready.": {
+			checks: func() []health.Check {
+				s := health.NewStatus("not run")
+				s.Set(fmt.Errorf("self-test failed"))
+				return []health.Check{{Name: "self-test", Check: s.Check}}
+			},
+			expCode: http.StatusServiceUnavailable,
+			expBody: "[-]self-test failed: self-test failed\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			rec := httptest.NewRecorder()
+			health.NewReadyHandler(test.checks()...).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(test.expCode, rec.Code)
+			assert.Equal(test.expBody, rec.Body.String())
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	tests := map[string]struct {
+		status  func() *health.Status
+		timeout time.Duration
+		expErr  bool
+	}{
+		"Having the checks passing, it should return.": {
+			status: func() *health.Status {
+				s := health.NewStatus("not listening")
+				s.Set(nil)
+				return s
+			},
+			timeout: time.Second,
+		},
+		"Having the checks passing later, it should wait for them.": {
+			status: func() *health.Status {
+				s := health.NewStatus("not listening")
+				time.AfterFunc(20*time.Millisecond, func() { s.Set(nil) })
+				return s
+			},
+			timeout: time.Second,
+		},
+		"Having the checks never passing, it should fail when the context is done.": {
+			status:  func() *health.Status { return health.NewStatus("not listening") },
+			timeout: 50 * time.Millisecond,
+			expErr:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+			defer cancel()
+
+			err := health.Wait(ctx, 5*time.Millisecond, health.Check{Name: "server", Check: test.status().Check})
+			if test.expErr {
+				assert.ErrorIs(err, context.DeadlineExceeded)
+				assert.ErrorContains(err, "server failed: not listening")
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
+
+// newTestCertificate returns a self-signed certificate valid between notBefore and notAfter.
+func newTestCertificate(t *testing.T, notBefore, notAfter time.Time) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertificateCheck(t *testing.T) {
+	now := time.Now()
+
+	tests := map[string]struct {
+		cert   func(t *testing.T) (*tls.Certificate, error)
+		expErr bool
+	}{
+		"Having a valid certificate, it should pass.": {
+			cert: func(t *testing.T) (*tls.Certificate, error) {
+				return newTestCertificate(t, now.Add(-time.Hour), now.Add(time.Hour)), nil
+			},
+		},
+		"Having an expired certificate, it should fail.": {
+			cert: func(t *testing.T) (*tls.Certificate, error) {
+				return newTestCertificate(t, now.Add(-2*time.Hour), now.Add(-time.Hour)), nil
+			},
+			expErr: true,
+		},
+		"Having a certificate not valid yet, it should fail.": {
+			cert: func(t *testing.T) (*tls.Certificate, error) {
+				return newTestCertificate(t, now.Add(time.Hour), now.Add(2*time.Hour)), nil
+			},
+			expErr: true,
+		},
+		"Having no certificate loaded, it should fail.": {
+			cert: func(t *testing.T) (*tls.Certificate, error) {
+				return nil, fmt.Errorf("certificate not synced yet")
+			},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			check := health.CertificateCheck(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return test.cert(t) })
+			if test.expErr {
+				assert.Error(check())
+			} else {
+				assert.NoError(check())
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/log"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/policy"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// maxExplainBodySize is the maximum size of the explained manifests.
+const maxExplainBodySize = 3 << 20
+
+// Explanation is the result of running the mutating webhooks on a resource without persisting it.
+type Explanation struct {
+	// Patch is the JSON patch all the webhooks would apply to the resource.
+	Patch json.RawMessage `json:"patch,omitempty"`
+	// Warnings are the warnings all the webhooks would return.
+	Warnings []string `json:"warnings,omitempty"`
+	// Steps are the webhooks that apply to the resource, in the order they run.
+	Steps []ExplanationStep `json:"steps"`
+	// Error is the reason the resource would be rejected.
+	Error string `json:"error,omitempty"`
+}
+
+// ExplanationStep are the decisions of a webhook.
+type ExplanationStep struct {
+	Webhook  string        `json:"webhook"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Trace    *policy.Trace `json:"trace,omitempty"`
+}
+
+type explainStep struct {
+	id      string
+	applies func(obj metav1.Object) bool
+	mutator kwhmutating.Mutator
+}
+
+type explainer struct {
+	steps  []explainStep
+	logger log.Logger
+}
+
+// NewExplain returns a handler that explains the changes the mutating webhooks make to the manifest
+// posted to it, with the same configuration as New. Nothing is persisted.
+func NewExplain(config Config) (http.Handler, error) {
+	h, err := newHandler(config)
+	if err != nil {
+		return nil, err
+	}
+
+	isWorkload := func(obj metav1.Object) bool {
+		_, err := workload.PodSpec(obj)
+		return err == nil
+	}
+	isHPA := func(obj metav1.Object) bool {
+		_, ok := obj.(*autoscalingv2.HorizontalPodAutoscaler)
+		return ok
+	}
+
+	return explainer{
+		steps: []explainStep{
+			{id: "allMark", applies: func(metav1.Object) bool { return true }, mutator: h.allMarkMutator()},
+			{id: "memFix", applies: isWorkload, mutator: h.memFixMutator()},
+			{id: "hpaMemory", applies: isHPA, mutator: h.hpaMemoryMutator()},
+		},
+		logger: h.logger.WithKV(log.KV{"handler": "explain"}),
+	}, nil
+}
+
+func (e explainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "the manifest must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxExplainBodySize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read manifest: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	ar, err := explainReview(body, r.URL.Query().Get("namespace"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	exp, err := e.explain(r.Context(), ar)
+	if err != nil {
+		status = http.StatusUnprocessableEntity
+		exp.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(exp)
+	if err != nil {
+		e.logger.Errorf("could not write explanation: %s", err)
+	}
+}
+
+// explainReview returns the dry run creation review of a YAML or JSON manifest, the manifests without
+// namespace are created on the namespace, `default` if empty.
+func explainReview(manifest []byte, namespace string) (kwhmodel.AdmissionReview, error) {
+	data, err := yaml.YAMLToJSON(manifest)
+	if err != nil {
+		return kwhmodel.AdmissionReview{}, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	u := &unstructured.Unstructured{}
+	err = u.UnmarshalJSON(data)
+	if err != nil {
+		return kwhmodel.AdmissionReview{}, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	if u.GetNamespace() == "" {
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		u.SetNamespace(namespace)
+		data, err = u.MarshalJSON()
+		if err != nil {
+			return kwhmodel.AdmissionReview{}, fmt.Errorf("could not marshal manifest: %w", err)
+		}
+	}
+
+	gvk := metav1.GroupVersionKind(u.GroupVersionKind())
+	return kwhmodel.AdmissionReview{
+		ID:           "explain",
+		Name:         u.GetName(),
+		Namespace:    u.GetNamespace(),
+		Operation:    kwhmodel.OperationCreate,
+		Version:      kwhmodel.AdmissionReviewVersionV1,
+		RequestGVK:   &gvk,
+		NewObjectRaw: data,
+		DryRun:       true,
+		UserInfo:     authenticationv1.UserInfo{Username: "explain"},
+	}, nil
+}
+
+// explain runs the mutators of the webhooks that apply to the resource one after the other, as the API
+// server does, and returns the resulting patch with the decisions taken by each one.
+func (e explainer) explain(ctx context.Context, ar kwhmodel.AdmissionReview) (*Explanation, error) {
+	exp := &Explanation{Steps: []ExplanationStep{}}
+
+	mt := kwhmutating.MutatorFunc(func(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+		for _, s := range e.steps {
+			if !s.applies(obj) {
+				continue
+			}
+
+			stepCtx, trace := policy.WithTrace(ctx)
+			res, err := s.mutator.Mutate(stepCtx, ar, obj)
+			step := ExplanationStep{Webhook: s.id, Trace: trace}
+			if res != nil {
+				step.Warnings = res.Warnings
+			}
+			exp.Steps = append(exp.Steps, step)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", s.id, err)
+			}
+
+			exp.Warnings = append(exp.Warnings, res.Warnings...)
+			if res.MutatedObject != nil {
+				obj = res.MutatedObject
+			}
+		}
+
+		return &kwhmutating.MutatorResult{MutatedObject: obj}, nil
+	})
+
+	wh, err := kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
+		ID:      "explain",
+		Logger:  kubewebhookLogger{Logger: e.logger.WithKV(log.KV{"lib": "kubewebhook"})},
+		Mutator: mt,
+	})
+	if err != nil {
+		return exp, fmt.Errorf("could not create webhook: %w", err)
+	}
+
+	res, err := wh.Review(ctx, ar)
+	if err != nil {
+		return exp, err
+	}
+
+	if mres, ok := res.(*kwhmodel.MutatingAdmissionResponse); ok {
+		exp.Patch = mres.JSONPatchPatch
+	}
+
+	return exp, nil
+}
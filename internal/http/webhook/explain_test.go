@@ -0,0 +1,121 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/http/webhook"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/policy"
+)
+
+func TestExplain(t *testing.T) {
+	deployment := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: web
+          resources:
+            requests:
+              memory: 64Mi
+            limits:
+              memory: 128Mi
+`
+
+	tests := map[string]struct {
+		method      string
+		manifest    string
+		expCode     int
+		expPatch    []map[string]interface{}
+		expWarnings []string
+		expSteps    []string
+		expRule     string
+	}{
+		"Having a deployment manifest, it should explain the patch, warnings and decisions of the webhooks.": {
+			method:   http.MethodPost,
+			manifest: deployment,
+			expCode:  http.StatusOK,
+			expPatch: []map[string]interface{}{
+				{"op": "add", "path": "/metadata/labels", "value": map[string]interface{}{"sized": "true"}},
+				{"op": "replace", "path": "/spec/template/spec/containers/0/resources/requests/memory", "value": "128Mi"},
+			},
+			expWarnings: []string{"Resource marked with custom labels", "webhook changed memory resources to be guaranteed"},
+			expSteps:    []string{"allMark", "memFix"},
+			expRule:     "all",
+		},
+		"Having an invalid manifest, it should fail.": {
+			method:   http.MethodPost,
+			manifest: "{",
+			expCode:  http.StatusBadRequest,
+		},
+		"Having a GET request, it should not be allowed.": {
+			method:  http.MethodGet,
+			expCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			p, err := policy.Parse([]byte(`
+rules:
+  - name: all
+    actions:
+      guaranteeMemory: true
+      marks:
+        sized: "true"
+`))
+			require.NoError(err)
+			store := policy.NewStore(p)
+			marker, err := policy.NewMarker(policy.Config{Source: store})
+			require.NoError(err)
+			fixer, err := policy.NewFixer(policy.Config{Source: store})
+			require.NoError(err)
+			h, err := webhook.NewExplain(webhook.Config{Marker: marker, MemoryFixer: fixer})
+			require.NoError(err)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(test.method, "/explain?namespace=test", strings.NewReader(test.manifest)))
+
+			require.Equal(test.expCode, rec.Code, rec.Body.String())
+			if test.expCode != http.StatusOK {
+				return
+			}
+
+			got := webhook.Explanation{}
+			require.NoError(json.Unmarshal(rec.Body.Bytes(), &got))
+			var gotPatch []map[string]interface{}
+			require.NoError(json.Unmarshal(got.Patch, &gotPatch))
+			// The typed resources are serialized with their empty fields, only the webhooks changes are checked.
+			assert.Subset(gotPatch, test.expPatch)
+			assert.Equal(test.expWarnings, got.Warnings)
+
+			var gotSteps []string
+			for _, s := range got.Steps {
+				gotSteps = append(gotSteps, s.Webhook)
+			}
+			assert.Equal(test.expSteps, gotSteps)
+			require.NotNil(got.Steps[len(got.Steps)-1].Trace)
+			assert.Equal(test.expRule, got.Steps[len(got.Steps)-1].Trace.Rule)
+		})
+	}
+}
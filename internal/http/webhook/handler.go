@@ -4,15 +4,27 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
 	kwhhttp "github.com/slok/kubewebhook/v2/pkg/http"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
 	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
 	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	kwhvalidating "github.com/slok/kubewebhook/v2/pkg/webhook/validating"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/log"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/budget"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/cpu"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/level"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/nodefit"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
 )
 
 // kubewebhookLogger is a small proxy to use our logger with Kubewebhook.
@@ -30,9 +42,26 @@ func (l kubewebhookLogger) SetValuesOnCtx(parent context.Context, values map[str
 	return kwhlog.CtxWithValues(parent, values)
 }
 
-// allmark sets up the webhook handler for marking all kubernetes resources using Kubewebhook library.
-func (h handler) allMark() (http.Handler, error) {
-	mt := kwhmutating.MutatorFunc(func(ctx context.Context, _ *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+// allMarkMutator marks the resources with the custom labels.
+func (h handler) allMarkMutator() kwhmutating.Mutator {
+	return kwhmutating.MutatorFunc(func(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+		// Pods created by controllers don't have the namespace set on the object.
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(ar.Namespace)
+		}
+
+		// The mark templates are rendered with the admission request.
+		admission := mark.Admission{
+			Namespace: ar.Namespace,
+			Name:      ar.Name,
+			Operation: strings.ToUpper(string(ar.Operation)),
+			UserInfo:  ar.UserInfo,
+		}
+		if ar.RequestGVK != nil {
+			admission.Kind = ar.RequestGVK.Kind
+		}
+
+		ctx, warnings := mark.WithWarnings(mark.WithAdmission(ctx, admission))
 		err := h.marker.Mark(ctx, obj)
 		if err != nil {
 			return nil, fmt.Errorf("could not mark the resource: %w", err)
@@ -40,9 +69,14 @@ func (h handler) allMark() (http.Handler, error) {
 
 		return &kwhmutating.MutatorResult{
 			MutatedObject: obj,
-			Warnings:      []string{"Resource marked with custom labels"},
+			Warnings:      append([]string{"Resource marked with custom labels"}, *warnings...),
 		}, nil
 	})
+}
+
+// allmark sets up the webhook handler for marking all kubernetes resources using Kubewebhook library.
+func (h handler) allMark() (http.Handler, error) {
+	mt := h.allMarkMutator()
 
 	logger := kubewebhookLogger{Logger: h.logger.WithKV(log.KV{"lib": "kubewebhook", "webhook": "allMark"})}
 	wh, err := kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
@@ -64,16 +98,52 @@ func (h handler) allMark() (http.Handler, error) {
 	return whHandler, nil
 }
 
-// memFix sets up the webhook handler for marking all kubernetes resources using Kubewebhook library.
-func (h handler) memFix() (http.Handler, error) {
-	mt := kwhmutating.MutatorFunc(func(ctx context.Context, _ *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
-		changed, err := h.memoryFixer.FixMemRequest(ctx, obj)
+// memFixMutator fixes the memory resources of the workloads, in coordination with their VPAs and HPAs.
+func (h handler) memFixMutator() kwhmutating.Mutator {
+	return kwhmutating.MutatorFunc(func(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+		// Pods created by controllers don't have the namespace set on the object.
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(ar.Namespace)
+		}
+
+		// The memory of the workloads managed by a VPA is fixed in coordination with it.
+		vpaRes, err := h.vpaCoordinator.CoordinateMemory(ctx, obj)
+		if err != nil {
+			return nil, fmt.Errorf("could not coordinate the memory with the vertical pod autoscalers: %w", err)
+		}
+		if vpaRes.VPA != "" {
+			warning := fmt.Sprintf("memory resources are managed by VerticalPodAutoscaler %q, webhook didn't change them", vpaRes.VPA)
+			if vpaRes.Changed {
+				warning = fmt.Sprintf("webhook changed memory resources to be guaranteed following VerticalPodAutoscaler %q in %s mode", vpaRes.VPA, vpaRes.Mode)
+			}
+
+			return &kwhmutating.MutatorResult{
+				MutatedObject: obj,
+				Warnings:      []string{warning},
+			}, nil
+		}
+
+		// Keep the original memory requests, the HPAs memory utilization targets are relative to them.
+		var original resource.Quantity
+		if spec, err := workload.PodSpec(obj); err == nil {
+			original = workload.PodRequests(spec)[corev1.ResourceMemory]
+		}
+
+		res, err := h.memoryFixer.FixMemRequest(ctx, obj)
 		if err != nil {
 			return nil, fmt.Errorf("could not fix the resources memory request and limits: %w", err)
 		}
 		var warnings []string
-		if changed {
-			warnings = []string{"webhook changed memory resources to be guaranteed"}
+		if res.Changed {
+			warnings = append([]string{"webhook changed memory resources to be guaranteed"}, res.Warnings...)
+
+			// The HPAs are only annotated and warned about, an error must not block the workload.
+			hpaWarnings, err := h.hpaAdjuster.MemoryRequestsRaised(ctx, obj, original)
+			if err != nil {
+				h.logger.Errorf("could not check the horizontal pod autoscalers memory utilization: %s", err)
+				hpaWarnings = []string{"webhook could not check the memory utilization of the horizontal pod autoscalers"}
+			}
+			warnings = append(warnings, hpaWarnings...)
 		}
 
 		return &kwhmutating.MutatorResult{
@@ -81,6 +151,11 @@ func (h handler) memFix() (http.Handler, error) {
 			Warnings:      warnings,
 		}, nil
 	})
+}
+
+// memFix sets up the webhook handler for marking all kubernetes resources using Kubewebhook library.
+func (h handler) memFix() (http.Handler, error) {
+	mt := h.memFixMutator()
 
 	logger := kubewebhookLogger{Logger: h.logger.WithKV(log.KV{"lib": "kubewebhook", "webhook": "memFix"})}
 	wh, err := kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
@@ -101,3 +176,255 @@ func (h handler) memFix() (http.Handler, error) {
 
 	return whHandler, nil
 }
+
+// hpaMemoryMutator adjusts the HPAs memory utilization targets to the original sizing of their workloads.
+func (h handler) hpaMemoryMutator() kwhmutating.Mutator {
+	return kwhmutating.MutatorFunc(func(ctx context.Context, _ *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+		hpa, ok := obj.(*autoscalingv2.HorizontalPodAutoscaler)
+		if !ok {
+			// Other HPA versions are not supported, don't block them.
+			return &kwhmutating.MutatorResult{}, nil
+		}
+
+		changed, err := h.hpaAdjuster.AdjustHPA(ctx, hpa)
+		if err != nil {
+			return nil, fmt.Errorf("could not adjust the horizontal pod autoscaler memory utilization: %w", err)
+		}
+		var warnings []string
+		if changed {
+			warnings = []string{"webhook adjusted the memory utilization target to the original memory requests"}
+		}
+
+		return &kwhmutating.MutatorResult{
+			MutatedObject: hpa,
+			Warnings:      warnings,
+		}, nil
+	})
+}
+
+// hpaMemory sets up the webhook handler for adjusting the HPAs memory utilization targets to the original
+// sizing of their workloads using Kubewebhook library.
+func (h handler) hpaMemory() (http.Handler, error) {
+	mt := h.hpaMemoryMutator()
+
+	logger := kubewebhookLogger{Logger: h.logger.WithKV(log.KV{"lib": "kubewebhook", "webhook": "hpaMemory"})}
+	wh, err := kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
+		ID:      "hpaMemory",
+		Logger:  logger,
+		Mutator: mt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create webhook: %w", err)
+	}
+	whHandler, err := kwhhttp.HandlerFor(kwhhttp.HandlerConfig{
+		Webhook: kwhwebhook.NewMeasuredWebhook(h.metrics, wh),
+		Logger:  logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create handler from webhook: %w", err)
+	}
+
+	return whHandler, nil
+}
+
+// cpuBounds sets up the webhook handler for validating the CPU resources of kubernetes resources using Kubewebhook library.
+func (h handler) cpuBounds() (http.Handler, error) {
+	vl := kwhvalidating.ValidatorFunc(func(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhvalidating.ValidatorResult, error) {
+		// Pods created by controllers don't have the namespace set on the object.
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(ar.Namespace)
+		}
+
+		res, err := h.cpuValidator.ValidateCPU(ctx, obj)
+		if err != nil {
+			return nil, fmt.Errorf("could not validate the resources cpu requests and limits: %w", err)
+		}
+
+		if len(res.Violations) == 0 {
+			return &kwhvalidating.ValidatorResult{Valid: true}, nil
+		}
+
+		if res.Mode == cpu.ModeWarn {
+			return &kwhvalidating.ValidatorResult{
+				Valid:    true,
+				Warnings: res.Violations,
+			}, nil
+		}
+
+		return &kwhvalidating.ValidatorResult{
+			Valid:   false,
+			Message: strings.Join(res.Violations, ", "),
+		}, nil
+	})
+
+	logger := kubewebhookLogger{Logger: h.logger.WithKV(log.KV{"lib": "kubewebhook", "webhook": "cpuBounds"})}
+	wh, err := kwhvalidating.NewWebhook(kwhvalidating.WebhookConfig{
+		ID:        "cpuBounds",
+		Logger:    logger,
+		Validator: vl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create webhook: %w", err)
+	}
+	whHandler, err := kwhhttp.HandlerFor(kwhhttp.HandlerConfig{
+		Webhook: kwhwebhook.NewMeasuredWebhook(h.metrics, wh),
+		Logger:  logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create handler from webhook: %w", err)
+	}
+
+	return whHandler, nil
+}
+
+// nodeFit sets up the webhook handler for validating the pods of kubernetes resources fit on the cluster nodes using Kubewebhook library.
+func (h handler) nodeFit() (http.Handler, error) {
+	vl := kwhvalidating.ValidatorFunc(func(ctx context.Context, _ *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhvalidating.ValidatorResult, error) {
+		res, err := h.nodeFitChecker.CheckNodeFit(ctx, obj)
+		if err != nil {
+			return nil, fmt.Errorf("could not check the resources fit on the nodes: %w", err)
+		}
+
+		if len(res.Violations) == 0 {
+			return &kwhvalidating.ValidatorResult{Valid: true}, nil
+		}
+
+		if res.Mode == nodefit.ModeWarn {
+			return &kwhvalidating.ValidatorResult{
+				Valid:    true,
+				Warnings: res.Violations,
+			}, nil
+		}
+
+		return &kwhvalidating.ValidatorResult{
+			Valid:   false,
+			Message: strings.Join(res.Violations, ", "),
+		}, nil
+	})
+
+	logger := kubewebhookLogger{Logger: h.logger.WithKV(log.KV{"lib": "kubewebhook", "webhook": "nodeFit"})}
+	wh, err := kwhvalidating.NewWebhook(kwhvalidating.WebhookConfig{
+		ID:        "nodeFit",
+		Logger:    logger,
+		Validator: vl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create webhook: %w", err)
+	}
+	whHandler, err := kwhhttp.HandlerFor(kwhhttp.HandlerConfig{
+		Webhook: kwhwebhook.NewMeasuredWebhook(h.metrics, wh),
+		Logger:  logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create handler from webhook: %w", err)
+	}
+
+	return whHandler, nil
+}
+
+// namespaceBudget sets up the webhook handler for validating the scaled out workloads fit on the namespace budget using Kubewebhook library.
+func (h handler) namespaceBudget() (http.Handler, error) {
+	vl := kwhvalidating.ValidatorFunc(func(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhvalidating.ValidatorResult, error) {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(ar.Namespace)
+		}
+
+		var res *budget.Result
+		var err error
+		if scale, ok := obj.(*autoscalingv1.Scale); ok && ar.RequestGVR != nil {
+			res, err = h.budgetChecker.CheckScale(ctx, ar.RequestGVR.Resource, scale)
+		} else {
+			res, err = h.budgetChecker.CheckBudget(ctx, obj)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not check the namespace budget: %w", err)
+		}
+
+		if len(res.Violations) == 0 {
+			return &kwhvalidating.ValidatorResult{Valid: true}, nil
+		}
+
+		if res.Mode == budget.ModeWarn {
+			return &kwhvalidating.ValidatorResult{
+				Valid:    true,
+				Warnings: res.Violations,
+			}, nil
+		}
+
+		return &kwhvalidating.ValidatorResult{
+			Valid:   false,
+			Message: strings.Join(res.Violations, ", "),
+		}, nil
+	})
+
+	logger := kubewebhookLogger{Logger: h.logger.WithKV(log.KV{"lib": "kubewebhook", "webhook": "namespaceBudget"})}
+	wh, err := kwhvalidating.NewWebhook(kwhvalidating.WebhookConfig{
+		ID:        "namespaceBudget",
+		Logger:    logger,
+		Validator: vl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create webhook: %w", err)
+	}
+	whHandler, err := kwhhttp.HandlerFor(kwhhttp.HandlerConfig{
+		Webhook: kwhwebhook.NewMeasuredWebhook(h.metrics, wh),
+		Logger:  logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create handler from webhook: %w", err)
+	}
+
+	return whHandler, nil
+}
+
+// sizingLevel sets up the webhook handler for validating the resources satisfy the sizing levels of their namespace using Kubewebhook library.
+func (h handler) sizingLevel() (http.Handler, error) {
+	logger := kubewebhookLogger{Logger: h.logger.WithKV(log.KV{"lib": "kubewebhook", "webhook": "sizingLevel"})}
+
+	vl := kwhvalidating.ValidatorFunc(func(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhvalidating.ValidatorResult, error) {
+		// Pods created by controllers don't have the namespace set on the object.
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(ar.Namespace)
+		}
+
+		res, err := h.levelChecker.CheckLevels(ctx, obj)
+		if err != nil {
+			return nil, fmt.Errorf("could not check the namespace sizing levels: %w", err)
+		}
+
+		if audit := res.Violations[level.ModeAudit]; len(audit) > 0 {
+			logger.WithValues(log.KV{"namespace": obj.GetNamespace(), "name": obj.GetName(), "kind": ar.RequestGVK.Kind}).
+				Warningf("audit: %s", strings.Join(audit, ", "))
+		}
+
+		if enforce := res.Violations[level.ModeEnforce]; len(enforce) > 0 {
+			return &kwhvalidating.ValidatorResult{
+				Valid:   false,
+				Message: strings.Join(enforce, ", "),
+			}, nil
+		}
+
+		return &kwhvalidating.ValidatorResult{
+			Valid:    true,
+			Warnings: res.Violations[level.ModeWarn],
+		}, nil
+	})
+
+	wh, err := kwhvalidating.NewWebhook(kwhvalidating.WebhookConfig{
+		ID:        "sizingLevel",
+		Logger:    logger,
+		Validator: vl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create webhook: %w", err)
+	}
+	whHandler, err := kwhhttp.HandlerFor(kwhhttp.HandlerConfig{
+		Webhook: kwhwebhook.NewMeasuredWebhook(h.metrics, wh),
+		Logger:  logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create handler from webhook: %w", err)
+	}
+
+	return whHandler, nil
+}
@@ -0,0 +1,228 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/http/webhook"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mem"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/vpa"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/policy"
+)
+
+// testVPACoordinator is a VPA coordinator that records the namespace of the coordinated workloads.
+type testVPACoordinator struct {
+	namespaces *[]string
+}
+
+func (t testVPACoordinator) CoordinateMemory(_ context.Context, obj metav1.Object) (*vpa.Result, error) {
+	*t.namespaces = append(*t.namespaces, obj.GetNamespace())
+	return &vpa.Result{}, nil
+}
+
+// testHPAAdjuster is an HPA adjuster that returns its error.
+type testHPAAdjuster struct {
+	err error
+}
+
+func (t testHPAAdjuster) MemoryRequestsRaised(_ context.Context, _ metav1.Object, _ resource.Quantity) ([]string, error) {
+	return nil, t.err
+}
+
+func (t testHPAAdjuster) AdjustHPA(_ context.Context, _ *autoscalingv2.HorizontalPodAutoscaler) (bool, error) {
+	return false, t.err
+}
+
+// newTestPod returns a pod of the namespace whose memory request is lower than its limit.
+func newTestPod(namespace string) *corev1.Pod {
+	return &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "web-", Namespace: namespace, Labels: map[string]string{"app": "web"}},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "web",
+				Image: "web",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+				},
+			}},
+		},
+	}
+}
+
+// review sends the object in an AdmissionReview of the namespace to the webhook path and returns the response.
+func review(t *testing.T, h http.Handler, path, namespace string, obj runtime.Object) *admissionv1.AdmissionResponse {
+	t.Helper()
+
+	raw, err := json.Marshal(obj)
+	require.NoError(t, err)
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "test",
+			Kind:      metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+			Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	got := admissionv1.AdmissionReview{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.NotNil(t, got.Response)
+
+	return got.Response
+}
+
+func TestMemFixHPAError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h, err := webhook.New(webhook.Config{
+		Marker:      mark.DummyMarker,
+		MemoryFixer: mem.NewMemRequestFixer(),
+		HPAAdjuster: testHPAAdjuster{err: fmt.Errorf("hpa lister failed")},
+	})
+	require.NoError(err)
+
+	resp := review(t, h, webhook.MemFixPath, "test", newTestPod("test"))
+
+	assert.True(resp.Allowed, "an HPA error should not block the workload")
+	assert.NotEmpty(resp.Patch, "the memory should still be fixed")
+	assert.Contains(resp.Warnings, "webhook could not check the memory utilization of the horizontal pod autoscalers")
+}
+
+func TestMemFixPodWithoutNamespace(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var namespaces []string
+	h, err := webhook.New(webhook.Config{
+		Marker:         mark.DummyMarker,
+		MemoryFixer:    mem.NewMemRequestFixer(),
+		VPACoordinator: testVPACoordinator{namespaces: &namespaces},
+	})
+	require.NoError(err)
+
+	// Pods created by controllers don't have the namespace set on the object.
+	resp := review(t, h, webhook.MemFixPath, "test", newTestPod(""))
+
+	assert.True(resp.Allowed)
+	assert.Equal([]string{"test"}, namespaces, "the VPAs should be looked up in the admission namespace")
+}
+
+func TestAllMarkPodWithoutNamespace(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"env": "production"}}})
+	factory := informers.NewSharedInformerFactory(cli, 0)
+	nsLister := factory.Core().V1().Namespaces().Lister()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	p, err := policy.Parse([]byte(`
+rules:
+  - name: production
+    match:
+      namespaceSelector:
+        matchLabels:
+          env: production
+    actions:
+      marks:
+        env: production
+`))
+	require.NoError(err)
+	marker, err := policy.NewMarker(policy.Config{Source: policy.NewStore(p), NamespaceLister: nsLister})
+	require.NoError(err)
+	h, err := webhook.New(webhook.Config{
+		Marker:      marker,
+		MemoryFixer: mem.DummyFixer,
+	})
+	require.NoError(err)
+
+	// Pods created by controllers don't have the namespace set on the object.
+	resp := review(t, h, webhook.AllMarkPath, "test", newTestPod(""))
+
+	require.True(resp.Allowed, resp.Result)
+	assert.Contains(string(resp.Patch), `{"op":"add","path":"/metadata/labels/env","value":"production"}`, "the namespace labels of the admission namespace should match")
+}
+
+func TestAllMarkPodWithoutNamespaceSizingPolicy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newSizingPolicy := func(kind, namespace, value string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "sizing.bitteeinbit.dev/v1alpha1",
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": "sizing", "uid": kind, "resourceVersion": "1"},
+			"spec": map[string]interface{}{"rules": []interface{}{map[string]interface{}{
+				"name":    "all",
+				"actions": map[string]interface{}{"marks": map[string]interface{}{"policy": value}},
+			}}},
+		}}
+		u.SetNamespace(namespace)
+		return u
+	}
+	cli := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		policy.SizingPolicyGVR:        "SizingPolicyList",
+		policy.ClusterSizingPolicyGVR: "ClusterSizingPolicyList",
+	}, newSizingPolicy("ClusterSizingPolicy", "", "cluster"), newSizingPolicy("SizingPolicy", "test", "namespace"))
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(cli, 0)
+	spLister := factory.ForResource(policy.SizingPolicyGVR).Lister()
+	cspLister := factory.ForResource(policy.ClusterSizingPolicyGVR).Lister()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	source, err := policy.NewCRDSource(policy.CRDSourceConfig{SizingPolicyLister: spLister, ClusterSizingPolicyLister: cspLister, HasSynced: func() bool { return true }})
+	require.NoError(err)
+	marker, err := policy.NewMarker(policy.Config{Source: source})
+	require.NoError(err)
+	h, err := webhook.New(webhook.Config{
+		Marker:      marker,
+		MemoryFixer: mem.DummyFixer,
+	})
+	require.NoError(err)
+
+	// Pods created by controllers don't have the namespace set on the object.
+	resp := review(t, h, webhook.AllMarkPath, "test", newTestPod(""))
+
+	require.True(resp.Allowed, resp.Result)
+	assert.Contains(string(resp.Patch), `{"op":"add","path":"/metadata/labels/policy","value":"namespace"}`, "the SizingPolicy of the admission namespace should be used")
+}
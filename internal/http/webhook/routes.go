@@ -4,18 +4,59 @@ import (
 	"net/http"
 )
 
+// The webhook paths, the webhook configurations must point to them.
+const (
+	AllMarkPath         = "/wh/mutating/allmark"
+	MemFixPath          = "/wh/mutating/memfix"
+	HPAMemoryPath       = "/wh/mutating/hpamemory"
+	CPUBoundsPath       = "/wh/validating/cpubounds"
+	NodeFitPath         = "/wh/validating/nodefit"
+	NamespaceBudgetPath = "/wh/validating/namespacebudget"
+	SizingLevelPath     = "/wh/validating/sizinglevel"
+)
+
 // routes wires the routes to handlers on a specific router.
 func (h handler) routes(router *http.ServeMux) error {
 	allmark, err := h.allMark()
 	if err != nil {
 		return err
 	}
-	router.Handle("/wh/mutating/allmark", allmark)
+	router.Handle(AllMarkPath, allmark)
 
 	memFix, err := h.memFix()
 	if err != nil {
 		return err
 	}
-	router.Handle("/wh/mutating/memfix", memFix)
+	router.Handle(MemFixPath, memFix)
+
+	hpaMemory, err := h.hpaMemory()
+	if err != nil {
+		return err
+	}
+	router.Handle(HPAMemoryPath, hpaMemory)
+
+	cpuBounds, err := h.cpuBounds()
+	if err != nil {
+		return err
+	}
+	router.Handle(CPUBoundsPath, cpuBounds)
+
+	nodeFit, err := h.nodeFit()
+	if err != nil {
+		return err
+	}
+	router.Handle(NodeFitPath, nodeFit)
+
+	namespaceBudget, err := h.namespaceBudget()
+	if err != nil {
+		return err
+	}
+	router.Handle(NamespaceBudgetPath, namespaceBudget)
+
+	sizingLevel, err := h.sizingLevel()
+	if err != nil {
+		return err
+	}
+	router.Handle(SizingLevelPath, sizingLevel)
 	return nil
 }
@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// selfTestNamespace is the namespace of the canned resources, it exists on every cluster.
+const selfTestNamespace = "default"
+
+// SelfTest sends a canned dry-run AdmissionReview to every webhook of the handler, it fails if any of them doesn't
+// respond with the AdmissionReview response of its request. The resources could be denied, only the webhooks
+// responses are checked.
+func SelfTest(ctx context.Context, h http.Handler) error {
+	pod := selfTestPod()
+	deployment := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "self-test", Namespace: selfTestNamespace},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr(int32(1)),
+			Selector: &metav1.LabelSelector{MatchLabels: pod.Labels},
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: pod.Labels}, Spec: pod.Spec},
+		},
+	}
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler"},
+		ObjectMeta: metav1.ObjectMeta{Name: "self-test", Namespace: selfTestNamespace},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "self-test"},
+			MinReplicas:    ptr(int32(1)),
+			MaxReplicas:    2,
+			Metrics: []autoscalingv2.MetricSpec{{
+				Type: autoscalingv2.ResourceMetricSourceType,
+				Resource: &autoscalingv2.ResourceMetricSource{
+					Name:   corev1.ResourceMemory,
+					Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: ptr(int32(80))},
+				},
+			}},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		resource metav1.GroupVersionResource
+		obj      runtime.Object
+	}{
+		{AllMarkPath, metav1.GroupVersionResource{Version: "v1", Resource: "pods"}, pod},
+		{MemFixPath, metav1.GroupVersionResource{Version: "v1", Resource: "pods"}, pod},
+		{HPAMemoryPath, metav1.GroupVersionResource{Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"}, hpa},
+		{CPUBoundsPath, metav1.GroupVersionResource{Version: "v1", Resource: "pods"}, pod},
+		{NodeFitPath, metav1.GroupVersionResource{Version: "v1", Resource: "pods"}, pod},
+		{NamespaceBudgetPath, metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, deployment},
+		{SizingLevelPath, metav1.GroupVersionResource{Version: "v1", Resource: "pods"}, pod},
+	}
+
+	for _, test := range tests {
+		err := selfTestReview(ctx, h, test.path, test.resource, test.obj)
+		if err != nil {
+			return fmt.Errorf("%s: %w", test.path, err)
+		}
+	}
+
+	return nil
+}
+
+func selfTestReview(ctx context.Context, h http.Handler, path string, gvr metav1.GroupVersionResource, obj runtime.Object) error {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("could not marshal resource: %w", err)
+	}
+
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	uid := types.UID("self-test" + path)
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       uid,
+			Kind:      metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+			Resource:  gvr,
+			Name:      "self-test",
+			Namespace: selfTestNamespace,
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: "system:k8s-sizing-webhook:self-test"},
+			Object:    runtime.RawExtension{Raw: raw},
+			DryRun:    ptr(true),
+		},
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		return fmt.Errorf("could not marshal admission review: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d: %s", rec.Code, rec.Body.String())
+	}
+	got := admissionv1.AdmissionReview{}
+	err = json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		return fmt.Errorf("invalid admission review response: %w", err)
+	}
+	if got.Response == nil || got.Response.UID != uid {
+		return fmt.Errorf("admission review response missing or not for the request")
+	}
+
+	return nil
+}
+
+func selfTestPod() *corev1.Pod {
+	resources := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("100m"),
+		corev1.ResourceMemory: resource.MustParse("128Mi"),
+	}
+
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "self-test",
+			Namespace: selfTestNamespace,
+			Labels:    map[string]string{"app": "self-test"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:      "self-test",
+				Image:     "self-test",
+				Resources: corev1.ResourceRequirements{Requests: resources, Limits: resources},
+			}},
+		},
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
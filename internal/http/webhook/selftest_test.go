@@ -0,0 +1,54 @@
+package webhook_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/http/webhook"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mem"
+)
+
+// testMarker is a marker that returns its error.
+type testMarker struct {
+	err error
+}
+
+func (t testMarker) Mark(_ context.Context, _ metav1.Object) error { return t.err }
+
+func TestSelfTest(t *testing.T) {
+	tests := map[string]struct {
+		config webhook.Config
+		expErr string
+	}{
+		"Having working webhooks, it should pass.": {
+			config: webhook.Config{Marker: mark.DummyMarker, MemoryFixer: mem.NewMemRequestFixer()},
+		},
+		"Having a failing mutator, it should fail.": {
+			config: webhook.Config{Marker: testMarker{err: fmt.Errorf("marker failed")}, MemoryFixer: mem.NewMemRequestFixer()},
+			expErr: "/wh/mutating/allmark: unexpected status code 500",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			h, err := webhook.New(test.config)
+			require.NoError(err)
+
+			err = webhook.SelfTest(context.Background(), h)
+			if test.expErr != "" {
+				assert.ErrorContains(err, test.expErr)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
@@ -5,8 +5,14 @@ import (
 	"net/http"
 
 	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/log"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/hpa"
 	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
 	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mem"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/vpa"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/budget"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/cpu"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/level"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/nodefit"
 )
 
 // Config is the handler configuration.
@@ -14,6 +20,12 @@ type Config struct {
 	MetricsRecorder MetricsRecorder
 	Marker          mark.Marker
 	MemoryFixer     mem.Fixer
+	HPAAdjuster     hpa.Adjuster
+	VPACoordinator  vpa.Coordinator
+	CPUValidator    cpu.Validator
+	NodeFitChecker  nodefit.Checker
+	BudgetChecker   budget.Checker
+	LevelChecker    level.Checker
 	Logger          log.Logger
 }
 
@@ -22,6 +34,30 @@ func (c *Config) defaults() error {
 		return fmt.Errorf("marker is required")
 	}
 
+	if c.HPAAdjuster == nil {
+		c.HPAAdjuster = hpa.DummyAdjuster
+	}
+
+	if c.VPACoordinator == nil {
+		c.VPACoordinator = vpa.DummyCoordinator
+	}
+
+	if c.CPUValidator == nil {
+		c.CPUValidator = cpu.DummyValidator
+	}
+
+	if c.NodeFitChecker == nil {
+		c.NodeFitChecker = nodefit.DummyChecker
+	}
+
+	if c.BudgetChecker == nil {
+		c.BudgetChecker = budget.DummyChecker
+	}
+
+	if c.LevelChecker == nil {
+		c.LevelChecker = level.DummyChecker
+	}
+
 	if c.MetricsRecorder == nil {
 		c.MetricsRecorder = dummyMetricsRecorder
 	}
@@ -34,29 +70,28 @@ func (c *Config) defaults() error {
 }
 
 type handler struct {
-	marker      mark.Marker
-	memoryFixer mem.Fixer
-	handler     http.Handler
-	metrics     MetricsRecorder
-	logger      log.Logger
+	marker         mark.Marker
+	memoryFixer    mem.Fixer
+	hpaAdjuster    hpa.Adjuster
+	vpaCoordinator vpa.Coordinator
+	cpuValidator   cpu.Validator
+	nodeFitChecker nodefit.Checker
+	budgetChecker  budget.Checker
+	levelChecker   level.Checker
+	handler        http.Handler
+	metrics        MetricsRecorder
+	logger         log.Logger
 }
 
 // New returns a new webhook handler.
 func New(config Config) (http.Handler, error) {
-	err := config.defaults()
+	h, err := newHandler(config)
 	if err != nil {
-		return nil, fmt.Errorf("handler configuration is not valid: %w", err)
+		return nil, err
 	}
 
 	mux := http.NewServeMux()
-
-	h := handler{
-		handler:     mux,
-		marker:      config.Marker,
-		memoryFixer: config.MemoryFixer,
-		metrics:     config.MetricsRecorder,
-		logger:      config.Logger.WithKV(log.KV{"service": "webhook-handler"}),
-	}
+	h.handler = mux
 
 	// Register all the routes with our router.
 	err = h.routes(mux)
@@ -70,6 +105,26 @@ func New(config Config) (http.Handler, error) {
 	return h, nil
 }
 
+func newHandler(config Config) (handler, error) {
+	err := config.defaults()
+	if err != nil {
+		return handler{}, fmt.Errorf("handler configuration is not valid: %w", err)
+	}
+
+	return handler{
+		marker:         config.Marker,
+		memoryFixer:    config.MemoryFixer,
+		hpaAdjuster:    config.HPAAdjuster,
+		vpaCoordinator: config.VPACoordinator,
+		cpuValidator:   config.CPUValidator,
+		nodeFitChecker: config.NodeFitChecker,
+		budgetChecker:  config.BudgetChecker,
+		levelChecker:   config.LevelChecker,
+		metrics:        config.MetricsRecorder,
+		logger:         config.Logger.WithKV(log.KV{"service": "webhook-handler"}),
+	}, nil
+}
+
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.handler.ServeHTTP(w, r)
 }
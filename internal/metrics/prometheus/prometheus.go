@@ -1,12 +1,18 @@
 package prometheus
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	gohttpmetrics "github.com/slok/go-http-metrics/metrics"
 	gohttpmetricsprometheus "github.com/slok/go-http-metrics/metrics/prometheus"
 	whprometheus "github.com/slok/kubewebhook/v2/pkg/metrics/prometheus"
 
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/cert"
 	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/http/webhook"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/policy"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/level"
 )
 
 // Types used to avoid collisions with the same interface naming.
@@ -17,6 +23,12 @@ type webhookRecorder = whprometheus.Recorder
 type Recorder struct {
 	httpRecorder
 	webhookRecorder
+
+	policyInfo      *prometheus.GaugeVec
+	policyReloads   *prometheus.CounterVec
+	levelViolations *prometheus.CounterVec
+	certExpiry      prometheus.Gauge
+	certReloads     *prometheus.CounterVec
 }
 
 // NewRecorder returns a new Prometheus Recorder.
@@ -24,11 +36,76 @@ func NewRecorder(reg prometheus.Registerer) Recorder {
 	// TODO error,
 	rec, _ := whprometheus.NewRecorder(whprometheus.RecorderConfig{Registry: reg})
 
-	return Recorder{
+	r := Recorder{
 		httpRecorder:    gohttpmetricsprometheus.NewRecorder(gohttpmetricsprometheus.Config{Registry: reg}),
 		webhookRecorder: *rec,
+
+		policyInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: prefix,
+			Subsystem: "policy",
+			Name:      "info",
+			Help:      "The active sizing policy, identified by its hash.",
+		}, []string{"hash"}),
+		policyReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prefix,
+			Subsystem: "policy",
+			Name:      "reloads_total",
+			Help:      "The total number of sizing policy reloads.",
+		}, []string{"success"}),
+		levelViolations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prefix,
+			Subsystem: "sizing_level",
+			Name:      "violations_total",
+			Help:      "The total number of resources violating the sizing level of their namespace.",
+		}, []string{"mode", "level"}),
+		certExpiry: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: prefix,
+			Subsystem: "certificate",
+			Name:      "expiry_timestamp_seconds",
+			Help:      "The expiry time of the served TLS certificate.",
+		}),
+		certReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prefix,
+			Subsystem: "certificate",
+			Name:      "reloads_total",
+			Help:      "The total number of TLS certificate reloads.",
+		}, []string{"success"}),
 	}
+	reg.MustRegister(r.policyInfo, r.policyReloads, r.levelViolations, r.certExpiry, r.certReloads)
+
+	return r
+}
+
+const prefix = "k8s_sizing_webhook"
+
+// SetActivePolicy satisfies policy.MetricsRecorder interface.
+func (r Recorder) SetActivePolicy(hash string) {
+	r.policyInfo.Reset()
+	r.policyInfo.WithLabelValues(hash).Set(1)
+}
+
+// IncPolicyReload satisfies policy.MetricsRecorder interface.
+func (r Recorder) IncPolicyReload(success bool) {
+	r.policyReloads.WithLabelValues(strconv.FormatBool(success)).Inc()
+}
+
+// IncLevelViolation satisfies level.MetricsRecorder interface.
+func (r Recorder) IncLevelViolation(mode, lvl string) {
+	r.levelViolations.WithLabelValues(mode, lvl).Inc()
+}
+
+// SetCertificateExpiry satisfies cert.MetricsRecorder interface.
+func (r Recorder) SetCertificateExpiry(notAfter time.Time) {
+	r.certExpiry.Set(float64(notAfter.Unix()))
+}
+
+// IncCertificateReload satisfies cert.MetricsRecorder interface.
+func (r Recorder) IncCertificateReload(success bool) {
+	r.certReloads.WithLabelValues(strconv.FormatBool(success)).Inc()
 }
 
 // Interface assertion.
 var _ webhook.MetricsRecorder = Recorder{}
+var _ policy.MetricsRecorder = Recorder{}
+var _ level.MetricsRecorder = Recorder{}
+var _ cert.MetricsRecorder = Recorder{}
@@ -0,0 +1,267 @@
+package hpa
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	autoscalingv2listers "k8s.io/client-go/listers/autoscaling/v2"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+const (
+	// OriginalMemoryRequestsAnnotation is the annotation that stores the pod memory requests of a workload
+	// before the webhook raised them.
+	OriginalMemoryRequestsAnnotation = "sizing.bitteeinbit.dev/original-memory-requests"
+	// OriginalMemoryUtilizationAnnotation is the annotation that stores the memory utilization target of
+	// an HPA before the webhook adjusted it.
+	OriginalMemoryUtilizationAnnotation = "sizing.bitteeinbit.dev/original-memory-utilization"
+)
+
+// Adjuster knows how to keep the memory utilization targets of the HorizontalPodAutoscalers in line
+// with the original sizing of their workloads after the memory requests have been raised.
+type Adjuster interface {
+	// MemoryRequestsRaised records the original pod memory requests on the workload and returns warnings
+	// for the HPAs targeting it whose memory utilization target no longer matches the original sizing.
+	MemoryRequestsRaised(ctx context.Context, obj metav1.Object, original resource.Quantity) ([]string, error)
+	// AdjustHPA adjusts the memory utilization target of the HPA to the original sizing of its target workload.
+	AdjustHPA(ctx context.Context, hpa *autoscalingv2.HorizontalPodAutoscaler) (bool, error)
+}
+
+// Config is the configuration of the HPA adjuster.
+type Config struct {
+	// HPALister is used to get the HPAs targeting a workload.
+	HPALister autoscalingv2listers.HorizontalPodAutoscalerLister
+	// DeploymentLister is used to get the deployments targeted by an HPA.
+	DeploymentLister appsv1listers.DeploymentLister
+	// StatefulSetLister is used to get the statefulsets targeted by an HPA.
+	StatefulSetLister appsv1listers.StatefulSetLister
+	// ReplicaSetLister is used to get the replicasets targeted by an HPA.
+	ReplicaSetLister appsv1listers.ReplicaSetLister
+}
+
+func (c *Config) defaults() error {
+	if c.HPALister == nil {
+		return fmt.Errorf("hpa lister is required")
+	}
+
+	if c.DeploymentLister == nil {
+		return fmt.Errorf("deployment lister is required")
+	}
+
+	if c.StatefulSetLister == nil {
+		return fmt.Errorf("statefulset lister is required")
+	}
+
+	if c.ReplicaSetLister == nil {
+		return fmt.Errorf("replicaset lister is required")
+	}
+
+	return nil
+}
+
+// NewHPAAdjuster returns a new HPA adjuster.
+func NewHPAAdjuster(config Config) (Adjuster, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return hpaadjuster{cfg: config}, nil
+}
+
+type hpaadjuster struct {
+	cfg Config
+}
+
+func (h hpaadjuster) MemoryRequestsRaised(_ context.Context, obj metav1.Object, original resource.Quantity) ([]string, error) {
+	var kind string
+	switch obj.(type) {
+	case *appsv1.Deployment:
+		kind = "Deployment"
+	case *appsv1.StatefulSet:
+		kind = "StatefulSet"
+	case *appsv1.ReplicaSet:
+		kind = "ReplicaSet"
+	default:
+		// Only the scalable workloads can be targeted by an HPA.
+		return nil, nil
+	}
+
+	// Without requests the HPA could not calculate the memory utilization before.
+	if original.IsZero() {
+		return nil, nil
+	}
+
+	spec, err := workload.PodSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+	current := workload.PodRequests(spec)[corev1.ResourceMemory]
+	if current.Cmp(original) == 0 {
+		return nil, nil
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[OriginalMemoryRequestsAnnotation] = original.String()
+	obj.SetAnnotations(annotations)
+
+	hpas, err := h.cfg.HPALister.HorizontalPodAutoscalers(obj.GetNamespace()).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("could not list horizontal pod autoscalers: %w", err)
+	}
+
+	var warnings []string
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		if ref.Kind != kind || ref.Name != obj.GetName() {
+			continue
+		}
+
+		target := memoryUtilizationTarget(hpa)
+		if target == nil {
+			continue
+		}
+
+		warnings = append(warnings, fmt.Sprintf("HorizontalPodAutoscaler %q memory utilization target %d%% is relative to the memory requests raised from %s to %s, the equivalent target is %d%%",
+			hpa.Name, *target, original.String(), current.String(), scaleTarget(*target, original, current)))
+	}
+
+	return warnings, nil
+}
+
+func (h hpaadjuster) AdjustHPA(_ context.Context, hpa *autoscalingv2.HorizontalPodAutoscaler) (bool, error) {
+	target := memoryUtilizationTarget(hpa)
+	if target == nil {
+		return false, nil
+	}
+
+	spec, annotations, err := h.targetWorkload(hpa)
+	if err != nil {
+		return false, err
+	}
+	if spec == nil {
+		return false, nil
+	}
+
+	originalReqs, ok := annotations[OriginalMemoryRequestsAnnotation]
+	if !ok {
+		return false, nil
+	}
+	original, err := resource.ParseQuantity(originalReqs)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation: %w", OriginalMemoryRequestsAnnotation, err)
+	}
+	current := workload.PodRequests(spec)[corev1.ResourceMemory]
+	if current.IsZero() || original.IsZero() {
+		return false, nil
+	}
+
+	// If the HPA has been already adjusted and the user didn't change the target, we use the original one,
+	// otherwise the target set by the user is the new original target.
+	originalTarget := *target
+	if v, ok := hpa.Annotations[OriginalMemoryUtilizationAnnotation]; ok {
+		prev, err := strconv.Atoi(v)
+		if err == nil && scaleTarget(int32(prev), original, current) == *target {
+			originalTarget = int32(prev)
+		}
+	}
+
+	adjusted := scaleTarget(originalTarget, original, current)
+	if adjusted == *target && hpa.Annotations[OriginalMemoryUtilizationAnnotation] == strconv.Itoa(int(originalTarget)) {
+		return false, nil
+	}
+
+	*target = adjusted
+	if hpa.Annotations == nil {
+		hpa.Annotations = map[string]string{}
+	}
+	hpa.Annotations[OriginalMemoryUtilizationAnnotation] = strconv.Itoa(int(originalTarget))
+
+	return true, nil
+}
+
+// targetWorkload returns the pod spec and the annotations of the workload targeted by the HPA, if the
+// workload doesn't exist or is not supported the spec will be nil.
+func (h hpaadjuster) targetWorkload(hpa *autoscalingv2.HorizontalPodAutoscaler) (*corev1.PodSpec, map[string]string, error) {
+	ref := hpa.Spec.ScaleTargetRef
+	var obj metav1.Object
+	var err error
+	switch ref.Kind {
+	case "Deployment":
+		obj, err = h.cfg.DeploymentLister.Deployments(hpa.Namespace).Get(ref.Name)
+	case "StatefulSet":
+		obj, err = h.cfg.StatefulSetLister.StatefulSets(hpa.Namespace).Get(ref.Name)
+	case "ReplicaSet":
+		obj, err = h.cfg.ReplicaSetLister.ReplicaSets(hpa.Namespace).Get(ref.Name)
+	default:
+		return nil, nil, nil
+	}
+	if err != nil {
+		// The HPA can be created before its target.
+		if apierrors.IsNotFound(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("could not get %s %s: %w", ref.Kind, ref.Name, err)
+	}
+
+	spec, err := workload.PodSpec(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return spec, obj.GetAnnotations(), nil
+}
+
+// memoryUtilizationTarget returns a pointer to the memory average utilization target of the HPA, nil if it
+// doesn't have one.
+func memoryUtilizationTarget(hpa *autoscalingv2.HorizontalPodAutoscaler) *int32 {
+	for i := range hpa.Spec.Metrics {
+		m := &hpa.Spec.Metrics[i]
+		if m.Type != autoscalingv2.ResourceMetricSourceType || m.Resource == nil {
+			continue
+		}
+
+		if m.Resource.Name == corev1.ResourceMemory && m.Resource.Target.Type == autoscalingv2.UtilizationMetricType && m.Resource.Target.AverageUtilization != nil {
+			return m.Resource.Target.AverageUtilization
+		}
+	}
+
+	return nil
+}
+
+// scaleTarget returns the utilization target relative to the current requests that is equivalent to the
+// target relative to the original requests.
+func scaleTarget(target int32, original, current resource.Quantity) int32 {
+	scaled := math.Round(float64(target) * float64(original.Value()) / float64(current.Value()))
+	if scaled < 1 {
+		return 1
+	}
+	return int32(scaled)
+}
+
+// DummyAdjuster is an adjuster that doesn't do anything.
+var DummyAdjuster Adjuster = dummyAdjuster(0)
+
+type dummyAdjuster int
+
+func (dummyAdjuster) MemoryRequestsRaised(_ context.Context, _ metav1.Object, _ resource.Quantity) ([]string, error) {
+	return nil, nil
+}
+
+func (dummyAdjuster) AdjustHPA(_ context.Context, _ *autoscalingv2.HorizontalPodAutoscaler) (bool, error) {
+	return false, nil
+}
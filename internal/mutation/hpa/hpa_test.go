@@ -0,0 +1,196 @@
+package hpa_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/hpa"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func newDeployment(mem string, annotations map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test", Annotations: annotations},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "busybox",
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(mem)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newHPA(target int32, annotations map[string]string) *autoscalingv2.HorizontalPodAutoscaler {
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test", Annotations: annotations},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: "web"},
+			MaxReplicas:    10,
+			Metrics: []autoscalingv2.MetricSpec{
+				{
+					Type: autoscalingv2.ResourceMetricSourceType,
+					Resource: &autoscalingv2.ResourceMetricSource{
+						Name: corev1.ResourceMemory,
+						Target: autoscalingv2.MetricTarget{
+							Type:               autoscalingv2.UtilizationMetricType,
+							AverageUtilization: int32Ptr(target),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newAdjuster(ctx context.Context, t *testing.T, objs ...runtime.Object) hpa.Adjuster {
+	cli := fake.NewSimpleClientset(objs...)
+	factory := informers.NewSharedInformerFactory(cli, 0)
+	cfg := hpa.Config{
+		HPALister:         factory.Autoscaling().V2().HorizontalPodAutoscalers().Lister(),
+		DeploymentLister:  factory.Apps().V1().Deployments().Lister(),
+		StatefulSetLister: factory.Apps().V1().StatefulSets().Lister(),
+		ReplicaSetLister:  factory.Apps().V1().ReplicaSets().Lister(),
+	}
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	a, err := hpa.NewHPAAdjuster(cfg)
+	require.NoError(t, err)
+
+	return a
+}
+
+func TestHPAAdjusterMemoryRequestsRaised(t *testing.T) {
+	tests := map[string]struct {
+		objs           []runtime.Object
+		obj            metav1.Object
+		original       string
+		expWarnings    []string
+		expAnnotations map[string]string
+	}{
+		"Having a deployment with an HPA targeting memory, it should warn.": {
+			objs:        []runtime.Object{newHPA(80, nil)},
+			obj:         newDeployment("1Gi", nil),
+			original:    "512Mi",
+			expWarnings: []string{`HorizontalPodAutoscaler "web" memory utilization target 80% is relative to the memory requests raised from 512Mi to 1Gi, the equivalent target is 40%`},
+			expAnnotations: map[string]string{
+				hpa.OriginalMemoryRequestsAnnotation: "512Mi",
+			},
+		},
+		"Having a deployment without HPA, it should only record the original requests.": {
+			obj:      newDeployment("1Gi", nil),
+			original: "512Mi",
+			expAnnotations: map[string]string{
+				hpa.OriginalMemoryRequestsAnnotation: "512Mi",
+			},
+		},
+		"Having a deployment without original requests, it should be ignored.": {
+			objs:     []runtime.Object{newHPA(80, nil)},
+			obj:      newDeployment("1Gi", nil),
+			original: "0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			a := newAdjuster(ctx, t, test.objs...)
+
+			warnings, err := a.MemoryRequestsRaised(ctx, test.obj, resource.MustParse(test.original))
+			require.NoError(err)
+
+			assert.Equal(test.expWarnings, warnings)
+			assert.Equal(test.expAnnotations, test.obj.GetAnnotations())
+		})
+	}
+}
+
+func TestHPAAdjusterAdjustHPA(t *testing.T) {
+	raised := map[string]string{hpa.OriginalMemoryRequestsAnnotation: "512Mi"}
+
+	tests := map[string]struct {
+		objs           []runtime.Object
+		hpa            *autoscalingv2.HorizontalPodAutoscaler
+		expChanged     bool
+		expTarget      int32
+		expAnnotations map[string]string
+	}{
+		"Having an HPA targeting a raised deployment, the target should be adjusted.": {
+			objs:           []runtime.Object{newDeployment("1Gi", raised)},
+			hpa:            newHPA(80, nil),
+			expChanged:     true,
+			expTarget:      40,
+			expAnnotations: map[string]string{hpa.OriginalMemoryUtilizationAnnotation: "80"},
+		},
+		"Having an already adjusted HPA, it should not be adjusted again.": {
+			objs:           []runtime.Object{newDeployment("1Gi", raised)},
+			hpa:            newHPA(40, map[string]string{hpa.OriginalMemoryUtilizationAnnotation: "80"}),
+			expChanged:     false,
+			expTarget:      40,
+			expAnnotations: map[string]string{hpa.OriginalMemoryUtilizationAnnotation: "80"},
+		},
+		"Having an adjusted HPA whose target has been changed by the user, the new target should be adjusted.": {
+			objs:           []runtime.Object{newDeployment("1Gi", raised)},
+			hpa:            newHPA(60, map[string]string{hpa.OriginalMemoryUtilizationAnnotation: "80"}),
+			expChanged:     true,
+			expTarget:      30,
+			expAnnotations: map[string]string{hpa.OriginalMemoryUtilizationAnnotation: "60"},
+		},
+		"Having an HPA targeting a not raised deployment, it should not be adjusted.": {
+			objs:       []runtime.Object{newDeployment("1Gi", nil)},
+			hpa:        newHPA(80, nil),
+			expChanged: false,
+			expTarget:  80,
+		},
+		"Having an HPA targeting a missing deployment, it should not be adjusted.": {
+			hpa:        newHPA(80, nil),
+			expChanged: false,
+			expTarget:  80,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			a := newAdjuster(ctx, t, test.objs...)
+
+			changed, err := a.AdjustHPA(ctx, test.hpa)
+			require.NoError(err)
+
+			assert.Equal(test.expChanged, changed)
+			assert.Equal(test.expTarget, *test.hpa.Spec.Metrics[0].Resource.Target.AverageUtilization)
+			assert.Equal(test.expAnnotations, test.hpa.Annotations)
+		})
+	}
+}
@@ -20,20 +20,70 @@ type labelmarker struct {
 	marks map[string]string
 }
 
-func (l labelmarker) Mark(_ context.Context, obj metav1.Object) error {
+func (l labelmarker) Mark(ctx context.Context, obj metav1.Object) error {
 	labels := obj.GetLabels()
 	if labels == nil {
 		labels = map[string]string{}
 	}
 
+	rec := recorderFrom(ctx)
 	for k, v := range l.marks {
 		labels[k] = v
+		if rec != nil {
+			rec.labels[k] = v
+		}
 	}
 
 	obj.SetLabels(labels)
 	return nil
 }
 
+// NewAnnotationMarker returns a new marker that will mark with annotations.
+func NewAnnotationMarker(marks map[string]string) Marker {
+	return annotationmarker{marks: marks}
+}
+
+type annotationmarker struct {
+	marks map[string]string
+}
+
+func (a annotationmarker) Mark(ctx context.Context, obj metav1.Object) error {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	rec := recorderFrom(ctx)
+	for k, v := range a.marks {
+		annotations[k] = v
+		if rec != nil {
+			rec.annotations[k] = v
+		}
+	}
+
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// Compose returns a marker that marks the resources with all the markers in order, so all the marks are set in the
+// same admission.
+func Compose(markers ...Marker) Marker {
+	return composedmarker(markers)
+}
+
+type composedmarker []Marker
+
+func (c composedmarker) Mark(ctx context.Context, obj metav1.Object) error {
+	for _, m := range c {
+		err := m.Mark(ctx, obj)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // DummyMarker is a marker that doesn't do anything.
 var DummyMarker Marker = dummyMaker(0)
 
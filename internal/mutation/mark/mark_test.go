@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -80,3 +81,215 @@ func TestLabelMarkerMark(t *testing.T) {
 		})
 	}
 }
+
+func TestAnnotationMarkerMark(t *testing.T) {
+	tests := map[string]struct {
+		marks  map[string]string
+		obj    metav1.Object
+		expObj metav1.Object
+	}{
+		"Having a pod, the annotations should be mutated.": {
+			marks: map[string]string{
+				"cluster-autoscaler.kubernetes.io/safe-to-evict": "true",
+				"owner": "team-a@example.com",
+			},
+			obj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Annotations: map[string]string{
+						"owner": "someone@example.com",
+						"other": "value",
+					},
+				},
+			},
+			expObj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Annotations: map[string]string{
+						"cluster-autoscaler.kubernetes.io/safe-to-evict": "true",
+						"owner": "team-a@example.com",
+						"other": "value",
+					},
+				},
+			},
+		},
+
+		"Having a service without annotations, the annotations should be set.": {
+			marks: map[string]string{
+				"cost-center": "1234",
+			},
+			obj: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+			},
+			expObj: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Annotations: map[string]string{"cost-center": "1234"},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			m := mark.NewAnnotationMarker(test.marks)
+
+			err := m.Mark(context.TODO(), test.obj)
+			require.NoError(err)
+
+			assert.Equal(test.expObj, test.obj)
+		})
+	}
+}
+
+func TestComposeMark(t *testing.T) {
+	tests := map[string]struct {
+		markers []mark.Marker
+		obj     metav1.Object
+		expObj  metav1.Object
+	}{
+		"Having a label and an annotation marker, both kinds of marks should be set.": {
+			markers: []mark.Marker{
+				mark.NewLabelMarker(map[string]string{"team": "a"}),
+				mark.NewAnnotationMarker(map[string]string{"owner": "team-a@example.com"}),
+			},
+			obj: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expObj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Labels:      map[string]string{"team": "a"},
+					Annotations: map[string]string{"owner": "team-a@example.com"},
+				},
+			},
+		},
+
+		"Having several markers setting the same mark, the last one should win.": {
+			markers: []mark.Marker{
+				mark.NewLabelMarker(map[string]string{"team": "a"}),
+				mark.NewLabelMarker(map[string]string{"team": "b"}),
+			},
+			obj: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expObj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "test",
+					Labels: map[string]string{"team": "b"},
+				},
+			},
+		},
+
+		"Having no markers, the resource should be left untouched.": {
+			obj:    &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expObj: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			m := mark.Compose(test.markers...)
+
+			err := m.Mark(context.TODO(), test.obj)
+			require.NoError(err)
+
+			assert.Equal(test.expObj, test.obj)
+		})
+	}
+}
+
+func TestTemplateMarkerMark(t *testing.T) {
+	admission := mark.Admission{
+		Namespace: "team-a",
+		Name:      "web",
+		Kind:      "Deployment",
+		Operation: "CREATE",
+		UserInfo:  authenticationv1.UserInfo{Username: "system:serviceaccount:team-a:deployer"},
+	}
+
+	tests := map[string]struct {
+		labels         map[string]string
+		annotations    map[string]string
+		expErr         bool
+		expLabels      map[string]string
+		expAnnotations map[string]string
+	}{
+		"Having static marks, they should be set as they are.": {
+			labels:         map[string]string{"team": "a"},
+			annotations:    map[string]string{"owner": "team-a@example.com"},
+			expLabels:      map[string]string{"team": "a"},
+			expAnnotations: map[string]string{"owner": "team-a@example.com"},
+		},
+		"Having templated marks, they should be rendered with the admission request.": {
+			labels:         map[string]string{"namespace": "{{ .Namespace }}", "operation": "{{ .Operation }}"},
+			annotations:    map[string]string{"created-by": "{{ .UserInfo.Username }} ({{ .Kind }} {{ .Name }})"},
+			expLabels:      map[string]string{"namespace": "team-a", "operation": "CREATE"},
+			expAnnotations: map[string]string{"created-by": "system:serviceaccount:team-a:deployer (Deployment web)"},
+		},
+		"Having a templated label rendering an invalid value, it should be sanitized.": {
+			labels:    map[string]string{"created-by": "{{ .UserInfo.Username }}", "long": "{{ .Namespace }}-{{ .Name }}-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.b"},
+			expLabels: map[string]string{"created-by": "system-serviceaccount-team-a-deployer", "long": "team-a-web-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+		},
+		"Having an invalid template, it should fail.": {
+			labels: map[string]string{"namespace": "{{ .Namespace "},
+			expErr: true,
+		},
+		"Having a template with an unknown field, it should fail.": {
+			annotations: map[string]string{"owner": "{{ .Owner }}"},
+			expErr:      true,
+		},
+		"Having an invalid static label value, it should fail.": {
+			labels: map[string]string{"owner": "team-a@example.com"},
+			expErr: true,
+		},
+		"Having an invalid mark key, it should fail.": {
+			annotations: map[string]string{"owner/of/this": "team-a"},
+			expErr:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			labelMarker, err := mark.NewLabelTemplateMarker(test.labels)
+			if err == nil {
+				var annotationMarker mark.Marker
+				annotationMarker, err = mark.NewAnnotationTemplateMarker(test.annotations)
+				labelMarker = mark.Compose(labelMarker, annotationMarker)
+			}
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			obj := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+			err = labelMarker.Mark(mark.WithAdmission(context.TODO(), admission), obj)
+			require.NoError(err)
+
+			assert.Equal(test.expLabels, obj.Labels)
+			assert.Equal(test.expAnnotations, obj.Annotations)
+		})
+	}
+}
+
+func TestTemplateMarkerMarkDate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	m, err := mark.NewLabelTemplateMarker(map[string]string{"created": "{{ now | date }}"})
+	require.NoError(err)
+
+	obj := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+	err = m.Mark(context.TODO(), obj)
+	require.NoError(err)
+
+	assert.Regexp(`^\d{4}-\d{2}-\d{2}$`, obj.Labels["created"])
+}
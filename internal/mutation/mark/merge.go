@@ -0,0 +1,202 @@
+package mark
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MergeStrategy is how a mark is merged with the existing label or annotation of the resource.
+type MergeStrategy string
+
+const (
+	// MergeOverwrite sets the mark value, overwriting the existing one.
+	MergeOverwrite MergeStrategy = "overwrite"
+	// MergeKeepExisting keeps the existing value, the mark is only set when missing.
+	MergeKeepExisting MergeStrategy = "keep-existing"
+	// MergeDenyOnDiffer denies the resources whose existing value differs from the mark.
+	MergeDenyOnDiffer MergeStrategy = "deny-on-differ"
+)
+
+func (s MergeStrategy) valid() bool {
+	return s == MergeOverwrite || s == MergeKeepExisting || s == MergeDenyOnDiffer
+}
+
+// Warnings are the marking decisions (e.g an existing label kept), returned as admission warnings.
+type Warnings []string
+
+type warningsKey struct{}
+
+// WithWarnings returns a context that records on the returned warnings the decisions of the markers
+// called with it.
+func WithWarnings(ctx context.Context) (context.Context, *Warnings) {
+	w := new(Warnings)
+	return context.WithValue(ctx, warningsKey{}, w), w
+}
+
+func warn(ctx context.Context, format string, args ...any) {
+	if w, ok := ctx.Value(warningsKey{}).(*Warnings); ok {
+		*w = append(*w, fmt.Sprintf(format, args...))
+	}
+}
+
+// MergeConfig is the configuration of the merge marker.
+type MergeConfig struct {
+	// Marker is the marker whose marks are merged.
+	Marker Marker
+	// Strategy is the merge strategy of the marks without one on Strategies, by default `overwrite`.
+	Strategy MergeStrategy
+	// Strategies are the merge strategies by label or annotation key.
+	Strategies map[string]MergeStrategy
+	// ForbiddenLabels are the label keys, or prefixes ending with `*` (e.g `sizing.bitteeinbit.dev/*`), removed
+	// from the resources unless set by the marker.
+	ForbiddenLabels []string
+}
+
+func (c *MergeConfig) defaults() error {
+	if c.Marker == nil {
+		return fmt.Errorf("marker is required")
+	}
+
+	if c.Strategy == "" {
+		c.Strategy = MergeOverwrite
+	}
+
+	if !c.Strategy.valid() {
+		return fmt.Errorf("invalid merge strategy %q, must be %q, %q or %q", c.Strategy, MergeOverwrite, MergeKeepExisting, MergeDenyOnDiffer)
+	}
+
+	for k, s := range c.Strategies {
+		if !s.valid() {
+			return fmt.Errorf("invalid %q merge strategy %q, must be %q, %q or %q", k, s, MergeOverwrite, MergeKeepExisting, MergeDenyOnDiffer)
+		}
+	}
+
+	for _, l := range c.ForbiddenLabels {
+		if strings.TrimSuffix(l, "*") == "" {
+			return fmt.Errorf("invalid forbidden label %q", l)
+		}
+	}
+
+	return nil
+}
+
+// NewMergeMarker returns a new marker that will merge the marks of the marker with the existing labels and
+// annotations using their merge strategies, and remove the forbidden labels from them and their pod template. The
+// decisions are recorded as warnings.
+func NewMergeMarker(config MergeConfig) (Marker, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return mergemarker{cfg: config}, nil
+}
+
+type mergemarker struct {
+	cfg MergeConfig
+}
+
+func (m mergemarker) Mark(ctx context.Context, obj metav1.Object) error {
+	existingLabels := maps.Clone(obj.GetLabels())
+	existingAnnotations := maps.Clone(obj.GetAnnotations())
+
+	markCtx, rec := withRecorder(ctx)
+	err := m.cfg.Marker.Mark(markCtx, obj)
+	if err != nil {
+		return err
+	}
+
+	labels := obj.GetLabels()
+	err = m.merge(ctx, "label", labels, existingLabels, rec.labels)
+	if err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	err = m.merge(ctx, "annotation", annotations, existingAnnotations, rec.annotations)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		if _, ok := rec.labels[k]; ok || !m.forbidden(k) {
+			continue
+		}
+		delete(labels, k)
+		warn(ctx, "forbidden label %q removed", k)
+	}
+
+	// The pods created from the workload would have them too, except the selector ones that must match the pods.
+	meta, selectorKeys, err := podTemplate(ctx, obj)
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		for _, k := range slices.Sorted(maps.Keys(meta.Labels)) {
+			if _, ok := rec.labels[k]; ok || selectorKeys[k] || !m.forbidden(k) {
+				continue
+			}
+			delete(meta.Labels, k)
+			warn(ctx, "forbidden pod template label %q removed", k)
+		}
+	}
+
+	// The outer markers (e.g the pod template marker) see the merged marks.
+	if outer := recorderFrom(ctx); outer != nil {
+		maps.Copy(outer.labels, rec.labels)
+		maps.Copy(outer.annotations, rec.annotations)
+	}
+
+	return nil
+}
+
+// merge applies the merge strategies of the marks to the marked values, the marks are updated with the merged values.
+func (m mergemarker) merge(ctx context.Context, kind string, values, existing, marks map[string]string) error {
+	for _, k := range slices.Sorted(maps.Keys(marks)) {
+		old, ok := existing[k]
+		if !ok || old == marks[k] {
+			continue
+		}
+
+		strategy, ok := m.cfg.Strategies[k]
+		if !ok {
+			strategy = m.cfg.Strategy
+		}
+
+		v, err := mergeMark(ctx, strategy, kind, k, old, marks[k])
+		if err != nil {
+			return err
+		}
+		values[k] = v
+		marks[k] = v
+	}
+
+	return nil
+}
+
+// mergeMark returns the value of a mark that differs from the existing value, using the merge strategy.
+func mergeMark(ctx context.Context, strategy MergeStrategy, kind, key, old, mark string) (string, error) {
+	switch strategy {
+	case MergeKeepExisting:
+		warn(ctx, "%s %q kept as %q instead of %q", kind, key, old, mark)
+		return old, nil
+	case MergeDenyOnDiffer:
+		return "", fmt.Errorf("%s %q is %q, it must be %q", kind, key, old, mark)
+	default:
+		warn(ctx, "%s %q overwritten from %q to %q", kind, key, old, mark)
+		return mark, nil
+	}
+}
+
+func (m mergemarker) forbidden(key string) bool {
+	return slices.ContainsFunc(m.cfg.ForbiddenLabels, func(f string) bool {
+		if prefix, ok := strings.CutSuffix(f, "*"); ok {
+			return strings.HasPrefix(key, prefix)
+		}
+		return key == f
+	})
+}
@@ -0,0 +1,228 @@
+package mark_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
+)
+
+func TestMergeMarkerMark(t *testing.T) {
+	marker := mark.Compose(
+		mark.NewLabelMarker(map[string]string{"team": "payments", "tier": "web"}),
+		mark.NewAnnotationMarker(map[string]string{"owner": "payments@example.com"}),
+	)
+
+	tests := map[string]struct {
+		config         mark.MergeConfig
+		obj            *corev1.Pod
+		expErr         bool
+		expLabels      map[string]string
+		expAnnotations map[string]string
+		expWarnings    mark.Warnings
+	}{
+		"Having the default strategy, the existing values should be overwritten.": {
+			config: mark.MergeConfig{Marker: marker},
+			obj: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Labels:      map[string]string{"team": "search", "tier": "web"},
+				Annotations: map[string]string{"owner": "search@example.com"},
+			}},
+			expLabels:      map[string]string{"team": "payments", "tier": "web"},
+			expAnnotations: map[string]string{"owner": "payments@example.com"},
+			expWarnings: mark.Warnings{
+				`label "team" overwritten from "search" to "payments"`,
+				`annotation "owner" overwritten from "search@example.com" to "payments@example.com"`,
+			},
+		},
+
+		"Having the keep existing strategy, the existing values should be kept.": {
+			config: mark.MergeConfig{Marker: marker, Strategy: mark.MergeKeepExisting},
+			obj: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Labels:      map[string]string{"team": "search"},
+				Annotations: map[string]string{"owner": "search@example.com"},
+			}},
+			expLabels:      map[string]string{"team": "search", "tier": "web"},
+			expAnnotations: map[string]string{"owner": "search@example.com"},
+			expWarnings: mark.Warnings{
+				`label "team" kept as "search" instead of "payments"`,
+				`annotation "owner" kept as "search@example.com" instead of "payments@example.com"`,
+			},
+		},
+
+		"Having a strategy for a mark, it should be used for that mark.": {
+			config: mark.MergeConfig{
+				Marker:     marker,
+				Strategy:   mark.MergeKeepExisting,
+				Strategies: map[string]mark.MergeStrategy{"team": mark.MergeOverwrite},
+			},
+			obj: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{"team": "search", "tier": "db"},
+			}},
+			expLabels:      map[string]string{"team": "payments", "tier": "db"},
+			expAnnotations: map[string]string{"owner": "payments@example.com"},
+			expWarnings: mark.Warnings{
+				`label "team" overwritten from "search" to "payments"`,
+				`label "tier" kept as "db" instead of "web"`,
+			},
+		},
+
+		"Having the deny on differ strategy and a different value, it should fail.": {
+			config: mark.MergeConfig{Marker: marker, Strategies: map[string]mark.MergeStrategy{"team": mark.MergeDenyOnDiffer}},
+			obj:    &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "search"}}},
+			expErr: true,
+		},
+
+		"Having the deny on differ strategy and the same value, it should be marked.": {
+			config:         mark.MergeConfig{Marker: marker, Strategy: mark.MergeDenyOnDiffer},
+			obj:            &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "payments"}}},
+			expLabels:      map[string]string{"team": "payments", "tier": "web"},
+			expAnnotations: map[string]string{"owner": "payments@example.com"},
+		},
+
+		"Having forbidden labels, they should be removed unless set by the marker.": {
+			config: mark.MergeConfig{
+				Marker:          mark.NewLabelMarker(map[string]string{"sizing.bitteeinbit.dev/class": "small"}),
+				ForbiddenLabels: []string{"node-role", "sizing.bitteeinbit.dev/*"},
+			},
+			obj: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+				"node-role":                      "master",
+				"node-role.kubernetes.io/worker": "",
+				"sizing.bitteeinbit.dev/level":   "gold",
+			}}},
+			expLabels: map[string]string{
+				"node-role.kubernetes.io/worker": "",
+				"sizing.bitteeinbit.dev/class":   "small",
+			},
+			expWarnings: mark.Warnings{
+				`forbidden label "node-role" removed`,
+				`forbidden label "sizing.bitteeinbit.dev/level" removed`,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			m, err := mark.NewMergeMarker(test.config)
+			require.NoError(err)
+
+			ctx, warnings := mark.WithWarnings(context.Background())
+			err = m.Mark(ctx, test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expLabels, test.obj.Labels)
+			assert.Equal(test.expAnnotations, test.obj.Annotations)
+			assert.Equal(test.expWarnings, *warnings)
+		})
+	}
+}
+
+func TestMergeMarkerMarkPodTemplate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	m, err := mark.NewMergeMarker(mark.MergeConfig{
+		Marker:   mark.NewLabelMarker(map[string]string{"team": "payments"}),
+		Strategy: mark.MergeKeepExisting,
+	})
+	require.NoError(err)
+
+	obj := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "search"}}}
+	err = mark.NewPodTemplateMarker(m).Mark(context.Background(), obj)
+	require.NoError(err)
+
+	// The pod template has the merged value.
+	assert.Equal(map[string]string{"team": "search"}, obj.Spec.Template.Labels)
+}
+
+func TestMergeMarkerMarkForbiddenPodTemplateLabels(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	m, err := mark.NewMergeMarker(mark.MergeConfig{
+		Marker:          mark.NewLabelMarker(map[string]string{"sizing.bitteeinbit.dev/class": "small"}),
+		ForbiddenLabels: []string{"node-role", "sizing.bitteeinbit.dev/*"},
+	})
+	require.NoError(err)
+
+	obj := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web", "node-role": "web"}},
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+				"app":                          "web",
+				"node-role":                    "web",
+				"sizing.bitteeinbit.dev/class": "large",
+				"sizing.bitteeinbit.dev/level": "gold",
+			}}},
+		},
+	}
+	ctx, warnings := mark.WithWarnings(context.Background())
+	err = m.Mark(ctx, obj)
+	require.NoError(err)
+
+	// The selector labels must match the pods, and the marker ones are propagated by the pod template marker.
+	assert.Equal(map[string]string{
+		"app":                          "web",
+		"node-role":                    "web",
+		"sizing.bitteeinbit.dev/class": "large",
+	}, obj.Spec.Template.Labels)
+	assert.Equal(mark.Warnings{`forbidden pod template label "sizing.bitteeinbit.dev/level" removed`}, *warnings)
+}
+
+func TestNewMergeMarker(t *testing.T) {
+	tests := map[string]struct {
+		config mark.MergeConfig
+		expErr bool
+	}{
+		"Having a valid configuration, it should not fail.": {
+			config: mark.MergeConfig{
+				Marker:          mark.DummyMarker,
+				Strategy:        mark.MergeKeepExisting,
+				Strategies:      map[string]mark.MergeStrategy{"team": mark.MergeDenyOnDiffer},
+				ForbiddenLabels: []string{"node-role", "sizing.bitteeinbit.dev/*"},
+			},
+		},
+		"Having an invalid strategy, it should fail.": {
+			config: mark.MergeConfig{Marker: mark.DummyMarker, Strategy: "merge"},
+			expErr: true,
+		},
+		"Having an invalid mark strategy, it should fail.": {
+			config: mark.MergeConfig{Marker: mark.DummyMarker, Strategies: map[string]mark.MergeStrategy{"team": "merge"}},
+			expErr: true,
+		},
+		"Having an empty forbidden label prefix, it should fail.": {
+			config: mark.MergeConfig{Marker: mark.DummyMarker, ForbiddenLabels: []string{"*"}},
+			expErr: true,
+		},
+		"Having no marker, it should fail.": {
+			config: mark.MergeConfig{},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := mark.NewMergeMarker(test.config)
+			if test.expErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package mark
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+// NamespaceLabelsConfig is the configuration of the namespace labels marker.
+type NamespaceLabelsConfig struct {
+	// Labels are the keys of the namespace labels set on the resources.
+	Labels []string
+	// Strategy is how the namespace labels are merged with the existing resource labels, by default `overwrite`.
+	Strategy MergeStrategy
+	// NamespaceLister is used to get the namespace labels.
+	NamespaceLister corev1listers.NamespaceLister
+}
+
+func (c *NamespaceLabelsConfig) defaults() error {
+	if c.NamespaceLister == nil {
+		return fmt.Errorf("namespace lister is required")
+	}
+
+	if len(c.Labels) == 0 {
+		return fmt.Errorf("labels are required")
+	}
+
+	if c.Strategy == "" {
+		c.Strategy = MergeOverwrite
+	}
+
+	if !c.Strategy.valid() {
+		return fmt.Errorf("invalid merge strategy %q, must be %q, %q or %q", c.Strategy, MergeOverwrite, MergeKeepExisting, MergeDenyOnDiffer)
+	}
+
+	return nil
+}
+
+// NewNamespaceLabelMarker returns a new marker that will mark the resources, and the pod templates of the
+// workloads, with the labels of their namespace. The labels of the workload pod selector are not set on the
+// pod template.
+func NewNamespaceLabelMarker(config NamespaceLabelsConfig) (Marker, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return namespacelabelmarker{cfg: config}, nil
+}
+
+type namespacelabelmarker struct {
+	cfg NamespaceLabelsConfig
+}
+
+func (n namespacelabelmarker) Mark(ctx context.Context, obj metav1.Object) error {
+	// Pods created by controllers don't have the namespace set on the object.
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = admissionFrom(ctx).Namespace
+	}
+	if namespace == "" {
+		// Cluster scoped resource.
+		return nil
+	}
+
+	ns, err := n.cfg.NamespaceLister.Get(namespace)
+	if err != nil {
+		return fmt.Errorf("could not get %s namespace: %w", namespace, err)
+	}
+
+	marks := map[string]string{}
+	for _, k := range n.cfg.Labels {
+		if v, ok := ns.Labels[k]; ok {
+			marks[k] = v
+		}
+	}
+	if len(marks) == 0 {
+		return nil
+	}
+
+	labels, err := n.merge(ctx, "label", obj.GetLabels(), marks, nil)
+	if err != nil {
+		return err
+	}
+	obj.SetLabels(labels)
+
+	meta, selectorKeys, err := podTemplate(ctx, obj)
+	if err != nil || meta == nil {
+		return err
+	}
+	meta.Labels, err = n.merge(ctx, "pod template label", meta.Labels, marks, selectorKeys)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// merge sets the marks on the labels, except the skipped keys, using the merge strategy.
+func (n namespacelabelmarker) merge(ctx context.Context, kind string, labels, marks map[string]string, skip map[string]bool) (map[string]string, error) {
+	// In the configuration order, so the warnings are stable.
+	for _, k := range n.cfg.Labels {
+		v, ok := marks[k]
+		if !ok || skip[k] {
+			continue
+		}
+
+		if old, ok := labels[k]; ok && old != v {
+			var err error
+			v, err = mergeMark(ctx, n.cfg.Strategy, kind, k, old, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[k] = v
+	}
+
+	return labels, nil
+}
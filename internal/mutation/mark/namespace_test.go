@@ -0,0 +1,153 @@
+package mark_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
+)
+
+func TestNamespaceLabelMarkerMark(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "shop",
+		Labels: map[string]string{"cost-center": "1234", "team": "payments", "env": "prod"},
+	}}
+
+	tests := map[string]struct {
+		config      mark.NamespaceLabelsConfig
+		namespace   string
+		obj         metav1.Object
+		expErr      bool
+		expObj      metav1.Object
+		expWarnings mark.Warnings
+	}{
+		"Having a resource, it should have the allowed namespace labels.": {
+			config: mark.NamespaceLabelsConfig{Labels: []string{"cost-center", "team", "owner"}},
+			obj:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "shop"}},
+			expObj: &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "shop",
+				Labels:    map[string]string{"cost-center": "1234", "team": "payments"},
+			}},
+		},
+
+		"Having a pod without namespace, it should use the admission namespace.": {
+			config:    mark.NamespaceLabelsConfig{Labels: []string{"team"}},
+			namespace: "shop",
+			obj:       &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expObj:    &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "payments"}}},
+		},
+
+		"Having a cluster scoped resource, it should not be marked.": {
+			config: mark.NamespaceLabelsConfig{Labels: []string{"team"}},
+			obj:    &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+			expObj: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		},
+
+		"Having a deployment, its pod template should have the namespace labels except the selector ones.": {
+			config: mark.NamespaceLabelsConfig{Labels: []string{"cost-center", "team"}},
+			obj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "shop"},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "search"}},
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "search"}}},
+				},
+			},
+			expObj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "shop",
+					Labels:    map[string]string{"cost-center": "1234", "team": "payments"},
+				},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "search"}},
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "search", "cost-center": "1234"}}},
+				},
+			},
+		},
+
+		"Having the keep existing strategy, the existing labels should be kept.": {
+			config: mark.NamespaceLabelsConfig{Labels: []string{"cost-center", "team"}, Strategy: mark.MergeKeepExisting},
+			obj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "shop", Labels: map[string]string{"team": "search"}},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "search"}}},
+				},
+			},
+			expObj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "shop",
+					Labels:    map[string]string{"cost-center": "1234", "team": "search"},
+				},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "search", "cost-center": "1234"}}},
+				},
+			},
+			expWarnings: mark.Warnings{
+				`label "team" kept as "search" instead of "payments"`,
+				`pod template label "team" kept as "search" instead of "payments"`,
+			},
+		},
+
+		"Having the overwrite strategy, the existing labels should be overwritten.": {
+			config: mark.NamespaceLabelsConfig{Labels: []string{"team"}},
+			obj:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "shop", Labels: map[string]string{"team": "search"}}},
+			expObj: &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "shop",
+				Labels:    map[string]string{"team": "payments"},
+			}},
+			expWarnings: mark.Warnings{`label "team" overwritten from "search" to "payments"`},
+		},
+
+		"Having the deny on differ strategy and a different label, it should fail.": {
+			config: mark.NamespaceLabelsConfig{Labels: []string{"team"}, Strategy: mark.MergeDenyOnDiffer},
+			obj:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "shop", Labels: map[string]string{"team": "search"}}},
+			expErr: true,
+		},
+
+		"Having a missing namespace, it should fail.": {
+			config: mark.NamespaceLabelsConfig{Labels: []string{"team"}},
+			obj:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "missing"}},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(namespace), 0)
+			test.config.NamespaceLister = factory.Core().V1().Namespaces().Lister()
+			factory.Start(ctx.Done())
+			factory.WaitForCacheSync(ctx.Done())
+
+			m, err := mark.NewNamespaceLabelMarker(test.config)
+			require.NoError(err)
+
+			ctx, warnings := mark.WithWarnings(mark.WithAdmission(ctx, mark.Admission{Namespace: test.namespace}))
+			err = m.Mark(ctx, test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expObj, test.obj)
+			assert.Equal(test.expWarnings, *warnings)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package mark
+
+import (
+	"context"
+	"maps"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// recorder has the marks set by the label and annotation markers called with its context, whatever marker
+// calls them (e.g the rules or policy markers).
+type recorder struct {
+	labels      map[string]string
+	annotations map[string]string
+}
+
+type recorderKey struct{}
+
+func withRecorder(ctx context.Context) (context.Context, *recorder) {
+	r := &recorder{labels: map[string]string{}, annotations: map[string]string{}}
+	return context.WithValue(ctx, recorderKey{}, r), r
+}
+
+func recorderFrom(ctx context.Context) *recorder {
+	r, _ := ctx.Value(recorderKey{}).(*recorder)
+	return r
+}
+
+// NewPodTemplateMarker returns a new marker that will mark the resources with the marker and, in case of a
+// workload, also its pod template with the same marks, so the pods created from it have them. The labels of
+// the workload pod selector are not propagated: the selectors are immutable and must match the pod template.
+// The updated jobs are not propagated either, their pod template is immutable.
+func NewPodTemplateMarker(m Marker) Marker {
+	return podtemplatemarker{marker: m}
+}
+
+type podtemplatemarker struct {
+	marker Marker
+}
+
+func (p podtemplatemarker) Mark(ctx context.Context, obj metav1.Object) error {
+	ctx, rec := withRecorder(ctx)
+	err := p.marker.Mark(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	meta, selectorKeys, err := podTemplate(ctx, obj)
+	if err != nil || meta == nil {
+		return err
+	}
+
+	labels := maps.Clone(rec.labels)
+	for k := range selectorKeys {
+		delete(labels, k)
+	}
+
+	meta.Labels = propagate(meta.Labels, labels)
+	meta.Annotations = propagate(meta.Annotations, rec.annotations)
+
+	return nil
+}
+
+// podTemplate returns the pod template metadata of a workload, nil if it has none or it can't be changed, and the
+// label keys of the workload pod selector, these must not be changed on the pod template.
+func podTemplate(ctx context.Context, obj metav1.Object) (*metav1.ObjectMeta, map[string]bool, error) {
+	if _, ok := obj.(*corev1.Pod); ok {
+		return nil, nil, nil
+	}
+	meta, err := workload.PodTemplateMeta(obj)
+	if err != nil {
+		// Not a workload, there is no pod template.
+		return nil, nil, nil
+	}
+	if _, ok := obj.(*batchv1.Job); ok && admissionFrom(ctx).Operation == "UPDATE" {
+		return nil, nil, nil
+	}
+
+	selector, err := workload.PodSelector(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := map[string]bool{}
+	if selector != nil {
+		for k := range selector.MatchLabels {
+			keys[k] = true
+		}
+		for _, req := range selector.MatchExpressions {
+			keys[req.Key] = true
+		}
+	}
+
+	return meta, keys, nil
+}
+
+func propagate(template, marks map[string]string) map[string]string {
+	if len(marks) == 0 {
+		return template
+	}
+	if template == nil {
+		template = map[string]string{}
+	}
+	maps.Copy(template, marks)
+
+	return template
+}
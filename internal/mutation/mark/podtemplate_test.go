@@ -0,0 +1,144 @@
+package mark_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
+)
+
+func TestPodTemplateMarkerMark(t *testing.T) {
+	tests := map[string]struct {
+		marker    mark.Marker
+		operation string
+		obj       metav1.Object
+		expObj    metav1.Object
+	}{
+		"Having a deployment, its pod template should be marked too.": {
+			marker: mark.Compose(
+				mark.NewLabelMarker(map[string]string{"team": "payments"}),
+				mark.NewAnnotationMarker(map[string]string{"owner": "payments@example.com"}),
+			),
+			obj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test"}}},
+				},
+			},
+			expObj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Labels:      map[string]string{"team": "payments"},
+					Annotations: map[string]string{"owner": "payments@example.com"},
+				},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+						Labels:      map[string]string{"app": "test", "team": "payments"},
+						Annotations: map[string]string{"owner": "payments@example.com"},
+					}},
+				},
+			},
+		},
+
+		"Having a deployment already marked, its pod template should be marked.": {
+			marker: mark.NewLabelMarker(map[string]string{"team": "payments"}),
+			obj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "payments"}},
+			},
+			expObj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "payments"}},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "payments"}}},
+				},
+			},
+		},
+
+		"Having a deployment with marks on its selector, the selector labels should not be propagated.": {
+			marker: mark.NewLabelMarker(map[string]string{"app": "other", "tier": "backend", "team": "payments"}),
+			obj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels:      map[string]string{"app": "test"},
+						MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpExists}},
+					},
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test", "tier": "web"}}},
+				},
+			},
+			expObj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"app": "other", "tier": "backend", "team": "payments"}},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels:      map[string]string{"app": "test"},
+						MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpExists}},
+					},
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test", "tier": "web", "team": "payments"}}},
+				},
+			},
+		},
+
+		"Having a cronjob, its job pod template should be marked too.": {
+			marker: mark.NewLabelMarker(map[string]string{"team": "payments"}),
+			obj:    &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expObj: &batchv1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "payments"}},
+				Spec: batchv1.CronJobSpec{
+					JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+						Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "payments"}}},
+					}},
+				},
+			},
+		},
+
+		"Having a job created, its pod template should be marked too.": {
+			marker:    mark.NewLabelMarker(map[string]string{"team": "payments"}),
+			operation: "CREATE",
+			obj:       &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expObj: &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "payments"}},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "payments"}}},
+				},
+			},
+		},
+
+		"Having a job updated, its immutable pod template should not be marked.": {
+			marker:    mark.NewLabelMarker(map[string]string{"team": "payments"}),
+			operation: "UPDATE",
+			obj:       &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expObj:    &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "payments"}}},
+		},
+
+		"Having a service, only the service should be marked.": {
+			marker: mark.NewLabelMarker(map[string]string{"team": "payments"}),
+			obj:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expObj: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "payments"}}},
+		},
+
+		"Having a marker without marks, the pod template should not be changed.": {
+			marker: mark.DummyMarker,
+			obj:    &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expObj: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx := mark.WithAdmission(context.Background(), mark.Admission{Operation: test.operation})
+			err := mark.NewPodTemplateMarker(test.marker).Mark(ctx, test.obj)
+			require.NoError(err)
+
+			assert.Equal(test.expObj, test.obj)
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package mark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Rule marks the resources matching its criteria with its labels and annotations, empty criteria match
+// everything. The values are templates, like the label and annotation template markers ones.
+type Rule struct {
+	// Kinds are the kinds of the resources (e.g `Deployment`).
+	Kinds []string `json:"kinds,omitempty"`
+	// Namespaces are the namespaces names, or `path.Match` patterns (e.g `prod-*`), of the resources.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects the resources by the labels of their namespace.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// ObjectSelector selects the resources by their labels.
+	ObjectSelector *metav1.LabelSelector `json:"objectSelector,omitempty"`
+	// Labels are the labels set on the matching resources.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are the annotations set on the matching resources.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ParseRule parses a YAML or JSON marking rule, e.g
+// `{"namespaces": ["prod-*"], "objectSelector": {"matchLabels": {"team": "payments"}}, "labels": {"pci": "true"}}`.
+func ParseRule(data []byte) (Rule, error) {
+	r := Rule{}
+	err := yaml.UnmarshalStrict(data, &r)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid marking rule: %w", err)
+	}
+
+	return r, nil
+}
+
+// RulesConfig is the configuration of the rules marker.
+type RulesConfig struct {
+	// Rules are the marking rules, all the matching ones are applied in order.
+	Rules []Rule
+	// NamespaceLister is used to get the namespace labels, required if a rule has a namespace selector.
+	NamespaceLister corev1listers.NamespaceLister
+}
+
+func (c *RulesConfig) defaults() error {
+	if c.NamespaceLister == nil && RulesNeedNamespaceLabels(c.Rules) {
+		return fmt.Errorf("namespace lister is required by the namespace selectors")
+	}
+
+	return nil
+}
+
+// RulesNeedNamespaceLabels returns true if any rule selects the resources by their namespace labels.
+func RulesNeedNamespaceLabels(rules []Rule) bool {
+	return slices.ContainsFunc(rules, func(r Rule) bool { return r.NamespaceSelector != nil })
+}
+
+type compiledRule struct {
+	Rule
+	namespaceSelector labels.Selector
+	objectSelector    labels.Selector
+	marker            Marker
+}
+
+// NewRulesMarker returns a new marker that will mark the resources with the labels and annotations of the
+// rules they match.
+func NewRulesMarker(config RulesConfig) (Marker, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	var errs []error
+	rules := make([]compiledRule, 0, len(config.Rules))
+	for i, r := range config.Rules {
+		cr, err := compileRule(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d]: %w", i, err))
+			continue
+		}
+		rules = append(rules, cr)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid marking rules: %w", err)
+	}
+
+	return rulesmarker{rules: rules, namespaceLister: config.NamespaceLister}, nil
+}
+
+func compileRule(r Rule) (compiledRule, error) {
+	if len(r.Labels) == 0 && len(r.Annotations) == 0 {
+		return compiledRule{}, fmt.Errorf("labels or annotations are required")
+	}
+
+	for _, ns := range r.Namespaces {
+		if _, err := path.Match(ns, ""); ns == "" || err != nil {
+			return compiledRule{}, fmt.Errorf("invalid namespace pattern %q", ns)
+		}
+	}
+
+	cr := compiledRule{Rule: r}
+	var err error
+	if r.NamespaceSelector != nil {
+		cr.namespaceSelector, err = metav1.LabelSelectorAsSelector(r.NamespaceSelector)
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("namespaceSelector: %w", err)
+		}
+	}
+	if r.ObjectSelector != nil {
+		cr.objectSelector, err = metav1.LabelSelectorAsSelector(r.ObjectSelector)
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("objectSelector: %w", err)
+		}
+	}
+
+	labelMarker, err := NewLabelTemplateMarker(r.Labels)
+	if err != nil {
+		return compiledRule{}, err
+	}
+	annotationMarker, err := NewAnnotationTemplateMarker(r.Annotations)
+	if err != nil {
+		return compiledRule{}, err
+	}
+	cr.marker = Compose(labelMarker, annotationMarker)
+
+	return cr, nil
+}
+
+type rulesmarker struct {
+	rules           []compiledRule
+	namespaceLister corev1listers.NamespaceLister
+}
+
+func (r rulesmarker) Mark(ctx context.Context, obj metav1.Object) error {
+	a := admissionFrom(ctx)
+
+	// Pods created by controllers don't have the namespace set on the object.
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = a.Namespace
+	}
+
+	var nsLabels labels.Set
+	nsLoaded := false
+	for _, rule := range r.rules {
+		if len(rule.Kinds) > 0 && !slices.Contains(rule.Kinds, a.Kind) {
+			continue
+		}
+
+		if len(rule.Namespaces) > 0 && !slices.ContainsFunc(rule.Namespaces, func(pattern string) bool {
+			ok, _ := path.Match(pattern, namespace)
+			return ok
+		}) {
+			continue
+		}
+
+		if rule.objectSelector != nil && !rule.objectSelector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+
+		if rule.namespaceSelector != nil {
+			if namespace == "" {
+				continue
+			}
+			if !nsLoaded {
+				ns, err := r.namespaceLister.Get(namespace)
+				if err != nil {
+					return fmt.Errorf("could not get %s namespace: %w", namespace, err)
+				}
+				nsLabels, nsLoaded = ns.Labels, true
+			}
+			if !rule.namespaceSelector.Matches(nsLabels) {
+				continue
+			}
+		}
+
+		err := rule.marker.Mark(ctx, obj)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
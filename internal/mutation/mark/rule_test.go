@@ -0,0 +1,219 @@
+package mark_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := map[string]struct {
+		rule    string
+		expRule mark.Rule
+		expErr  bool
+	}{
+		"Having a JSON rule, it should be parsed.": {
+			rule: `{"kinds": ["Deployment"], "namespaces": ["prod-*"], "objectSelector": {"matchLabels": {"team": "payments"}}, "labels": {"pci": "true"}}`,
+			expRule: mark.Rule{
+				Kinds:          []string{"Deployment"},
+				Namespaces:     []string{"prod-*"},
+				ObjectSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+				Labels:         map[string]string{"pci": "true"},
+			},
+		},
+		"Having a YAML rule, it should be parsed.": {
+			rule: "namespaceSelector:\n  matchLabels:\n    env: prod\nannotations:\n  owner: payments@example.com\n",
+			expRule: mark.Rule{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+				Annotations:       map[string]string{"owner": "payments@example.com"},
+			},
+		},
+		"Having an unknown field, it should fail.": {
+			rule:   `{"kind": "Deployment", "labels": {"pci": "true"}}`,
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			r, err := mark.ParseRule([]byte(test.rule))
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expRule, r)
+		})
+	}
+}
+
+func TestRulesMarkerMark(t *testing.T) {
+	pci := mark.Rule{
+		Kinds:          []string{"Deployment"},
+		Namespaces:     []string{"prod-*"},
+		ObjectSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+		Labels:         map[string]string{"pci": "true"},
+	}
+	prodNamespaces := mark.Rule{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+		Annotations:       map[string]string{"owner": "{{ .Namespace }}@example.com"},
+	}
+
+	tests := map[string]struct {
+		rules          []mark.Rule
+		namespace      *corev1.Namespace
+		kind           string
+		obj            *corev1.Pod
+		expErr         bool
+		expLabels      map[string]string
+		expAnnotations map[string]string
+	}{
+		"Having a resource matching all the rule criteria, it should be marked.": {
+			rules:     []mark.Rule{pci},
+			kind:      "Deployment",
+			obj:       &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "prod-eu", Labels: map[string]string{"team": "payments"}}},
+			expLabels: map[string]string{"team": "payments", "pci": "true"},
+		},
+		"Having a resource of other kind, it should not be marked.": {
+			rules:     []mark.Rule{pci},
+			kind:      "Service",
+			obj:       &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "prod-eu", Labels: map[string]string{"team": "payments"}}},
+			expLabels: map[string]string{"team": "payments"},
+		},
+		"Having a resource on other namespace, it should not be marked.": {
+			rules:     []mark.Rule{pci},
+			kind:      "Deployment",
+			obj:       &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "dev", Labels: map[string]string{"team": "payments"}}},
+			expLabels: map[string]string{"team": "payments"},
+		},
+		"Having a resource without the rule labels, it should not be marked.": {
+			rules:     []mark.Rule{pci},
+			kind:      "Deployment",
+			obj:       &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "prod-eu", Labels: map[string]string{"team": "search"}}},
+			expLabels: map[string]string{"team": "search"},
+		},
+		"Having a resource on a namespace matching the namespace selector, it should be marked.": {
+			rules:          []mark.Rule{pci, prodNamespaces},
+			namespace:      &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop", Labels: map[string]string{"env": "prod"}}},
+			kind:           "Pod",
+			obj:            &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "shop"}},
+			expAnnotations: map[string]string{"owner": "shop@example.com"},
+		},
+		"Having a resource on a namespace not matching the namespace selector, it should not be marked.": {
+			rules:     []mark.Rule{prodNamespaces},
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop", Labels: map[string]string{"env": "dev"}}},
+			kind:      "Pod",
+			obj:       &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "shop"}},
+		},
+		"Having a missing namespace with a namespace selector, it should fail.": {
+			rules:  []mark.Rule{prodNamespaces},
+			kind:   "Pod",
+			obj:    &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "shop"}},
+			expErr: true,
+		},
+		"Having several matching rules, all of them should be applied in order.": {
+			rules: []mark.Rule{
+				{Labels: map[string]string{"tier": "default", "managed": "true"}},
+				{Kinds: []string{"Pod"}, Labels: map[string]string{"tier": "pod"}},
+			},
+			kind:      "Pod",
+			obj:       &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "dev"}},
+			expLabels: map[string]string{"tier": "pod", "managed": "true"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cli := fake.NewSimpleClientset()
+			if test.namespace != nil {
+				cli = fake.NewSimpleClientset(test.namespace)
+			}
+			factory := informers.NewSharedInformerFactory(cli, 0)
+			nsLister := factory.Core().V1().Namespaces().Lister()
+			factory.Start(ctx.Done())
+			factory.WaitForCacheSync(ctx.Done())
+
+			m, err := mark.NewRulesMarker(mark.RulesConfig{Rules: test.rules, NamespaceLister: nsLister})
+			require.NoError(err)
+
+			ctx = mark.WithAdmission(ctx, mark.Admission{Namespace: test.obj.Namespace, Kind: test.kind})
+			err = m.Mark(ctx, test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expLabels, test.obj.Labels)
+			assert.Equal(test.expAnnotations, test.obj.Annotations)
+		})
+	}
+}
+
+func TestNewRulesMarker(t *testing.T) {
+	tests := map[string]struct {
+		config mark.RulesConfig
+		expErr bool
+	}{
+		"Having valid rules, it should not fail.": {
+			config: mark.RulesConfig{Rules: []mark.Rule{{Namespaces: []string{"prod-*"}, Labels: map[string]string{"pci": "true"}}}},
+		},
+		"Having a rule without marks, it should fail.": {
+			config: mark.RulesConfig{Rules: []mark.Rule{{Namespaces: []string{"prod-*"}}}},
+			expErr: true,
+		},
+		"Having an invalid namespace pattern, it should fail.": {
+			config: mark.RulesConfig{Rules: []mark.Rule{{Namespaces: []string{"prod-["}, Labels: map[string]string{"pci": "true"}}}},
+			expErr: true,
+		},
+		"Having an invalid object selector, it should fail.": {
+			config: mark.RulesConfig{Rules: []mark.Rule{{
+				ObjectSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Maybe"}}},
+				Labels:         map[string]string{"pci": "true"},
+			}}},
+			expErr: true,
+		},
+		"Having an invalid mark template, it should fail.": {
+			config: mark.RulesConfig{Rules: []mark.Rule{{Labels: map[string]string{"owner": "{{ .Owner }}"}}}},
+			expErr: true,
+		},
+		"Having a namespace selector without namespace lister, it should fail.": {
+			config: mark.RulesConfig{Rules: []mark.Rule{{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+				Labels:            map[string]string{"pci": "true"},
+			}}},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := mark.NewRulesMarker(test.config)
+			if test.expErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package mark
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Admission is the admission request of the marked resource, the mark templates are rendered with it
+// (e.g `{{ .Namespace }}` or `{{ .UserInfo.Username }}`). The operation is the Kubernetes one (e.g `CREATE`).
+type Admission struct {
+	Namespace string
+	Name      string
+	Kind      string
+	Operation string
+	UserInfo  authenticationv1.UserInfo
+}
+
+type admissionKey struct{}
+
+// WithAdmission returns a context with the admission request the mark templates are rendered with.
+func WithAdmission(ctx context.Context, a Admission) context.Context {
+	return context.WithValue(ctx, admissionKey{}, a)
+}
+
+func admissionFrom(ctx context.Context) Admission {
+	a, _ := ctx.Value(admissionKey{}).(Admission)
+	return a
+}
+
+// templateFuncs are the functions of the mark templates, e.g `{{ now | date }}`.
+var templateFuncs = template.FuncMap{
+	"now":  func() time.Time { return time.Now().UTC() },
+	"date": func(t time.Time) string { return t.Format(time.DateOnly) },
+}
+
+// exampleAdmission is used to check the templates render at startup.
+var exampleAdmission = Admission{
+	Namespace: "default",
+	Name:      "example",
+	Kind:      "Pod",
+	Operation: "CREATE",
+	UserInfo:  authenticationv1.UserInfo{Username: "system:serviceaccount:default:example"},
+}
+
+// NewLabelTemplateMarker returns a new marker that will mark with labels whose values are templates rendered with
+// the admission request, the rendered values are sanitized to be valid label values.
+func NewLabelTemplateMarker(marks map[string]string) (Marker, error) {
+	tpls, err := parseTemplates(marks, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return templatemarker{marks: tpls, labels: true}, nil
+}
+
+// NewAnnotationTemplateMarker returns a new marker that will mark with annotations whose values are templates
+// rendered with the admission request.
+func NewAnnotationTemplateMarker(marks map[string]string) (Marker, error) {
+	tpls, err := parseTemplates(marks, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return templatemarker{marks: tpls}, nil
+}
+
+// parseTemplates parses and checks the templates of the marks, the static label values must be valid label values.
+func parseTemplates(marks map[string]string, labels bool) (map[string]*template.Template, error) {
+	tpls := make(map[string]*template.Template, len(marks))
+	for k, v := range marks {
+		if msgs := validation.IsQualifiedName(k); len(msgs) > 0 {
+			return nil, fmt.Errorf("invalid mark key %q: %s", k, strings.Join(msgs, ", "))
+		}
+
+		tpl, err := template.New(k).Funcs(templateFuncs).Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q mark template: %w", k, err)
+		}
+		err = tpl.Execute(&strings.Builder{}, exampleAdmission)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q mark template: %w", k, err)
+		}
+
+		if labels && !strings.Contains(v, "{{") {
+			if msgs := validation.IsValidLabelValue(v); len(msgs) > 0 {
+				return nil, fmt.Errorf("invalid %q mark value %q: %s", k, v, strings.Join(msgs, ", "))
+			}
+		}
+
+		tpls[k] = tpl
+	}
+
+	return tpls, nil
+}
+
+type templatemarker struct {
+	marks  map[string]*template.Template
+	labels bool
+}
+
+func (t templatemarker) Mark(ctx context.Context, obj metav1.Object) error {
+	if len(t.marks) == 0 {
+		return nil
+	}
+
+	a := admissionFrom(ctx)
+
+	marks := make(map[string]string, len(t.marks))
+	for k, tpl := range t.marks {
+		var b strings.Builder
+		err := tpl.Execute(&b, a)
+		if err != nil {
+			return fmt.Errorf("could not render %q mark: %w", k, err)
+		}
+
+		v := b.String()
+		if t.labels {
+			v = sanitizeLabelValue(v)
+		}
+		marks[k] = v
+	}
+
+	if t.labels {
+		return NewLabelMarker(marks).Mark(ctx, obj)
+	}
+	return NewAnnotationMarker(marks).Mark(ctx, obj)
+}
+
+var (
+	invalidLabelValueChars = regexp.MustCompile(`[^-A-Za-z0-9_.]+`)
+	labelValueTrim         = "-_."
+)
+
+// sanitizeLabelValue returns a valid label value: the invalid characters are replaced with `-` (e.g
+// `system:serviceaccount:default:example` is `system-serviceaccount-default-example`), and it's truncated to
+// the maximum length and trimmed to start and end with an alphanumeric character.
+func sanitizeLabelValue(v string) string {
+	v = invalidLabelValueChars.ReplaceAllString(v, "-")
+	v = strings.Trim(v, labelValueTrim)
+	if len(v) > validation.LabelValueMaxLength {
+		v = strings.TrimRight(v[:validation.LabelValueMaxLength], labelValueTrim)
+	}
+
+	return v
+}
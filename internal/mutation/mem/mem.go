@@ -17,9 +17,17 @@ func ErrNotSupported(obj metav1.Object) error {
 	return fmt.Errorf("object %s is not supported", reflect.TypeOf(obj))
 }
 
+// Result is the result of a memory fix.
+type Result struct {
+	// Changed is true if the resource has been changed.
+	Changed bool
+	// Warnings explain the changes, e.g the sizing profile used.
+	Warnings []string
+}
+
 // Fixer knows how to mark Kubernetes resources.
 type Fixer interface {
-	FixMemRequest(ctx context.Context, obj metav1.Object) (bool, error)
+	FixMemRequest(ctx context.Context, obj metav1.Object) (*Result, error)
 }
 
 // NewMemRequestFixer returns a new marker that will mark with labels.
@@ -29,33 +37,46 @@ func NewMemRequestFixer() Fixer {
 
 type memrequestfixer struct{}
 
+// GuaranteeMemory makes the memory of the container guaranteed, the limit is used as request and if
+// only the request is set, it's used as limit. It returns true if the container has been changed.
+func GuaranteeMemory(c *corev1.Container) bool {
+	if c.Resources.Limits == nil && c.Resources.Requests == nil {
+		return false
+	}
+
+	if c.Resources.Limits == nil {
+		c.Resources.Limits = corev1.ResourceList{}
+	}
+	if c.Resources.Requests == nil {
+		c.Resources.Requests = corev1.ResourceList{}
+	}
+
+	changed := false
+	if c.Resources.Limits.Memory().Value() != 0 && c.Resources.Limits.Memory().Value() != c.Resources.Requests.Memory().Value() {
+		c.Resources.Requests[corev1.ResourceMemory] = c.Resources.Limits[corev1.ResourceMemory]
+		changed = true
+	}
+	if c.Resources.Limits.Memory().Value() == 0 && c.Resources.Requests.Memory().Value() != 0 {
+		c.Resources.Limits[corev1.ResourceMemory] = c.Resources.Requests[corev1.ResourceMemory]
+		changed = true
+	}
+
+	return changed
+}
+
 func (m memrequestfixer) fixContainers(containers []corev1.Container) ([]corev1.Container, bool) {
 	returned := make([]corev1.Container, 0, len(containers))
 	changed := false
 	for _, c := range containers {
-		if c.Resources.Limits != nil || c.Resources.Requests != nil {
-			if c.Resources.Limits == nil {
-				c.Resources.Limits = corev1.ResourceList{}
-			}
-			if c.Resources.Requests == nil {
-				c.Resources.Requests = corev1.ResourceList{}
-			}
-
-			if c.Resources.Limits.Memory().Value() != 0 && c.Resources.Limits.Memory().Value() != c.Resources.Requests.Memory().Value() {
-				c.Resources.Requests[corev1.ResourceMemory] = c.Resources.Limits[corev1.ResourceMemory]
-				changed = true
-			}
-			if c.Resources.Limits.Memory().Value() == 0 && c.Resources.Requests.Memory().Value() != 0 {
-				c.Resources.Limits[corev1.ResourceMemory] = c.Resources.Requests[corev1.ResourceMemory]
-				changed = true
-			}
+		if GuaranteeMemory(&c) {
+			changed = true
 		}
 		returned = append(returned, c)
 	}
 	return returned, changed
 }
 
-func (m memrequestfixer) FixMemRequest(_ context.Context, obj metav1.Object) (bool, error) {
+func (m memrequestfixer) FixMemRequest(_ context.Context, obj metav1.Object) (*Result, error) {
 	var changed bool
 	switch o := obj.(type) {
 	case *corev1.Pod:
@@ -75,9 +96,9 @@ func (m memrequestfixer) FixMemRequest(_ context.Context, obj metav1.Object) (bo
 	case *batchv1.Job:
 		o.Spec.Template.Spec.Containers, changed = m.fixContainers(o.Spec.Template.Spec.Containers)
 	default:
-		return false, ErrNotSupported(obj)
+		return nil, ErrNotSupported(obj)
 	}
-	return changed, nil
+	return &Result{Changed: changed}, nil
 }
 
 // DummyFixer is a marker that doesn't do anything.
@@ -85,4 +106,6 @@ var DummyFixer Fixer = dummyMaker(0)
 
 type dummyMaker int
 
-func (dummyMaker) FixMemRequest(_ context.Context, _ metav1.Object) (bool, error) { return false, nil }
+func (dummyMaker) FixMemRequest(_ context.Context, _ metav1.Object) (*Result, error) {
+	return &Result{}, nil
+}
@@ -710,11 +710,11 @@ func TestMemRequestFixer(t *testing.T) {
 			assert := assert.New(t)
 			require := require.New(t)
 
-			changed, err := m.FixMemRequest(context.TODO(), test.obj)
+			res, err := m.FixMemRequest(context.TODO(), test.obj)
 			if test.err == nil {
 				require.NoError(err)
 				assert.Equal(test.expObj, test.obj)
-				assert.Equal(test.changed, changed)
+				assert.Equal(test.changed, res.Changed)
 			} else {
 				assert.EqualError(err, test.err.Error())
 			}
@@ -0,0 +1,314 @@
+package vpa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// GroupVersionResource is the VerticalPodAutoscaler resource, it's a CRD so it's watched with the dynamic client.
+var GroupVersionResource = schema.GroupVersionResource{
+	Group:    "autoscaling.k8s.io",
+	Version:  "v1",
+	Resource: "verticalpodautoscalers",
+}
+
+// Mode is how the memory of the workloads managed by a VerticalPodAutoscaler is fixed.
+type Mode string
+
+const (
+	// ModeSkip leaves the memory resources untouched so the VPA admission controller owns them.
+	ModeSkip Mode = "skip"
+	// ModeRecommendation sets the memory requests and limits to the VPA recommendation target.
+	ModeRecommendation Mode = "recommendation"
+	// ModeEnforce sets the memory limits to the requests, these are the values set by the VPA.
+	ModeEnforce Mode = "enforce"
+)
+
+// Result is the result of coordinating with the VPAs.
+type Result struct {
+	// VPA is the name of the VerticalPodAutoscaler managing the workload, empty if not managed.
+	VPA string
+	// Mode is how the memory has been fixed.
+	Mode Mode
+	// Changed is true when the memory resources have been changed.
+	Changed bool
+}
+
+// Coordinator knows how to fix the memory of Kubernetes resources managed by a VerticalPodAutoscaler.
+type Coordinator interface {
+	// CoordinateMemory fixes the memory resources of a workload managed by a VPA in `Auto`, `Recreate`
+	// or `Initial` update mode. If the workload is not managed the result VPA will be empty and the
+	// workload will be left untouched.
+	CoordinateMemory(ctx context.Context, obj metav1.Object) (*Result, error)
+}
+
+// Config is the configuration of the VPA coordinator.
+type Config struct {
+	// VPALister is used to get the VPAs of the namespace, normally backed by a dynamic informer cache.
+	VPALister cache.GenericLister
+	// Mode is how the memory of the managed workloads is fixed, by default ModeSkip.
+	Mode Mode
+}
+
+func (c *Config) defaults() error {
+	if c.VPALister == nil {
+		return fmt.Errorf("vpa lister is required")
+	}
+
+	if c.Mode == "" {
+		c.Mode = ModeSkip
+	}
+
+	if c.Mode != ModeSkip && c.Mode != ModeRecommendation && c.Mode != ModeEnforce {
+		return fmt.Errorf("invalid mode %q, must be %q, %q or %q", c.Mode, ModeSkip, ModeRecommendation, ModeEnforce)
+	}
+
+	return nil
+}
+
+// NewVPACoordinator returns a new coordinator that will look for the VPAs targeting the workloads.
+func NewVPACoordinator(config Config) (Coordinator, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return vpacoordinator{cfg: config}, nil
+}
+
+type vpacoordinator struct {
+	cfg Config
+}
+
+// verticalPodAutoscaler is the part of the VerticalPodAutoscaler CRD used by the coordinator, this avoids
+// depending on the autoscaler module.
+type verticalPodAutoscaler struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec struct {
+		TargetRef    *autoscalingv1.CrossVersionObjectReference `json:"targetRef,omitempty"`
+		UpdatePolicy *struct {
+			UpdateMode *string `json:"updateMode,omitempty"`
+		} `json:"updatePolicy,omitempty"`
+	} `json:"spec"`
+
+	Status struct {
+		Recommendation *struct {
+			ContainerRecommendations []struct {
+				ContainerName string              `json:"containerName"`
+				Target        corev1.ResourceList `json:"target"`
+			} `json:"containerRecommendations,omitempty"`
+		} `json:"recommendation,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+// managing returns true if the VPA sets the pod resources on admission.
+func (v verticalPodAutoscaler) managing() bool {
+	// Auto is the default update mode.
+	if v.Spec.UpdatePolicy == nil || v.Spec.UpdatePolicy.UpdateMode == nil {
+		return true
+	}
+
+	switch *v.Spec.UpdatePolicy.UpdateMode {
+	case "Auto", "Recreate", "Initial":
+		return true
+	}
+
+	return false
+}
+
+type ref struct {
+	kind string
+	name string
+}
+
+func (v vpacoordinator) CoordinateMemory(_ context.Context, obj metav1.Object) (*Result, error) {
+	spec, err := workload.PodSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	vpa, err := v.managingVPA(obj)
+	if err != nil {
+		return nil, err
+	}
+	if vpa == nil {
+		return &Result{}, nil
+	}
+
+	res := &Result{VPA: vpa.Name, Mode: v.cfg.Mode}
+	switch v.cfg.Mode {
+	case ModeRecommendation:
+		res.Changed = applyRecommendation(spec.Containers, vpa)
+	case ModeEnforce:
+		res.Changed = limitsToRequests(spec.Containers)
+	}
+
+	return res, nil
+}
+
+// managingVPA returns the VPA managing the workload, nil if there is none.
+func (v vpacoordinator) managingVPA(obj metav1.Object) (*verticalPodAutoscaler, error) {
+	refs := targetRefs(obj)
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	// An empty namespace would list the VPAs of all the namespaces, the admission namespace must be set.
+	if obj.GetNamespace() == "" {
+		return nil, fmt.Errorf("the workload namespace is required")
+	}
+
+	objs, err := v.cfg.VPALister.ByNamespace(obj.GetNamespace()).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("could not list vertical pod autoscalers: %w", err)
+	}
+
+	for _, o := range objs {
+		u, ok := o.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("vertical pod autoscaler %T is not unstructured", o)
+		}
+
+		vpa := &verticalPodAutoscaler{}
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), vpa)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert %s vertical pod autoscaler: %w", u.GetName(), err)
+		}
+
+		if vpa.Spec.TargetRef == nil || !vpa.managing() {
+			continue
+		}
+
+		for _, r := range refs {
+			if vpa.Spec.TargetRef.Kind == r.kind && vpa.Spec.TargetRef.Name == r.name {
+				return vpa, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// targetRefs returns the references a VPA could use to target the workload.
+func targetRefs(obj metav1.Object) []ref {
+	name := obj.GetName()
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return podControllerRefs(o)
+	case *appsv1.Deployment:
+		return []ref{{kind: "Deployment", name: name}}
+	case *appsv1.ReplicaSet:
+		return []ref{{kind: "ReplicaSet", name: name}}
+	case *appsv1.DaemonSet:
+		return []ref{{kind: "DaemonSet", name: name}}
+	case *appsv1.StatefulSet:
+		return []ref{{kind: "StatefulSet", name: name}}
+	case *batchv1.CronJob, *batchv1beta1.CronJob:
+		return []ref{{kind: "CronJob", name: name}}
+	case *batchv1.Job:
+		return []ref{{kind: "Job", name: name}}
+	}
+
+	return nil
+}
+
+// podControllerRefs returns the references of the pod controller, the deployment of a replicaset is
+// obtained from the replicaset name and the pod template hash.
+func podControllerRefs(pod *corev1.Pod) []ref {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil
+	}
+
+	refs := []ref{{kind: owner.Kind, name: owner.Name}}
+	if hash, ok := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok && owner.Kind == "ReplicaSet" {
+		if deployment, ok := strings.CutSuffix(owner.Name, "-"+hash); ok {
+			refs = append(refs, ref{kind: "Deployment", name: deployment})
+		}
+	}
+
+	return refs
+}
+
+// applyRecommendation sets the memory requests and limits of the containers to the VPA target.
+func applyRecommendation(containers []corev1.Container, vpa *verticalPodAutoscaler) bool {
+	if vpa.Status.Recommendation == nil {
+		return false
+	}
+
+	changed := false
+	for _, rec := range vpa.Status.Recommendation.ContainerRecommendations {
+		target, ok := rec.Target[corev1.ResourceMemory]
+		if !ok {
+			continue
+		}
+
+		for i := range containers {
+			c := &containers[i]
+			if c.Name != rec.ContainerName {
+				continue
+			}
+
+			if c.Resources.Requests == nil {
+				c.Resources.Requests = corev1.ResourceList{}
+			}
+			if c.Resources.Limits == nil {
+				c.Resources.Limits = corev1.ResourceList{}
+			}
+
+			if c.Resources.Requests.Memory().Cmp(target) != 0 || c.Resources.Limits.Memory().Cmp(target) != 0 {
+				c.Resources.Requests[corev1.ResourceMemory] = target
+				c.Resources.Limits[corev1.ResourceMemory] = target
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// limitsToRequests sets the memory limits of the containers to their requests, the VPA keeps the limit to
+// request proportion so the memory stays guaranteed when the VPA changes the requests.
+func limitsToRequests(containers []corev1.Container) bool {
+	changed := false
+	for i := range containers {
+		c := &containers[i]
+		req := c.Resources.Requests.Memory()
+		if req.IsZero() || c.Resources.Limits.Memory().Cmp(*req) == 0 {
+			continue
+		}
+
+		if c.Resources.Limits == nil {
+			c.Resources.Limits = corev1.ResourceList{}
+		}
+		c.Resources.Limits[corev1.ResourceMemory] = *req
+		changed = true
+	}
+
+	return changed
+}
+
+// DummyCoordinator is a coordinator that doesn't do anything, no workload is managed by a VPA.
+var DummyCoordinator Coordinator = dummyCoordinator(0)
+
+type dummyCoordinator int
+
+func (dummyCoordinator) CoordinateMemory(_ context.Context, _ metav1.Object) (*Result, error) {
+	return &Result{}, nil
+}
@@ -0,0 +1,195 @@
+package vpa_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/vpa"
+)
+
+func newVPA(kind, name, updateMode, recommendedMem string) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"targetRef": map[string]interface{}{"apiVersion": "apps/v1", "kind": kind, "name": name},
+	}
+	if updateMode != "" {
+		spec["updatePolicy"] = map[string]interface{}{"updateMode": updateMode}
+	}
+
+	obj := map[string]interface{}{
+		"apiVersion": "autoscaling.k8s.io/v1",
+		"kind":       "VerticalPodAutoscaler",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "test"},
+		"spec":       spec,
+	}
+	if recommendedMem != "" {
+		obj["status"] = map[string]interface{}{
+			"recommendation": map[string]interface{}{
+				"containerRecommendations": []interface{}{
+					map[string]interface{}{"containerName": "test", "target": map[string]interface{}{"memory": recommendedMem}},
+				},
+			},
+		}
+	}
+
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func newResources(req, limit string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(req)},
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(limit)},
+	}
+}
+
+func newDeployment(res corev1.ResourceRequirements) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "test", Image: "busybox", Resources: res}},
+				},
+			},
+		},
+	}
+}
+
+func newPod(res corev1.ResourceRequirements) *corev1.Pod {
+	isController := true
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "web-5d8f9c7b4-",
+			Namespace:    "test",
+			Labels:       map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5d8f9c7b4"},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d8f9c7b4", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "test", Image: "busybox", Resources: res}},
+		},
+	}
+}
+
+func TestVPACoordinatorCoordinateMemory(t *testing.T) {
+	tests := map[string]struct {
+		mode         vpa.Mode
+		vpas         []*unstructured.Unstructured
+		obj          metav1.Object
+		expResult    *vpa.Result
+		expResources corev1.ResourceRequirements
+		expErr       bool
+	}{
+		"Having no VPA, it should not be managed.": {
+			mode:         vpa.ModeEnforce,
+			obj:          newDeployment(newResources("512Mi", "1Gi")),
+			expResult:    &vpa.Result{},
+			expResources: newResources("512Mi", "1Gi"),
+		},
+		"Having a VPA in Off mode, it should not be managed.": {
+			mode:         vpa.ModeEnforce,
+			vpas:         []*unstructured.Unstructured{newVPA("Deployment", "web", "Off", "")},
+			obj:          newDeployment(newResources("512Mi", "1Gi")),
+			expResult:    &vpa.Result{},
+			expResources: newResources("512Mi", "1Gi"),
+		},
+		"Having a VPA targeting other workload, it should not be managed.": {
+			mode:         vpa.ModeEnforce,
+			vpas:         []*unstructured.Unstructured{newVPA("StatefulSet", "web", "", "")},
+			obj:          newDeployment(newResources("512Mi", "1Gi")),
+			expResult:    &vpa.Result{},
+			expResources: newResources("512Mi", "1Gi"),
+		},
+		"Having a VPA in skip mode, the workload should be left untouched.": {
+			mode:         vpa.ModeSkip,
+			vpas:         []*unstructured.Unstructured{newVPA("Deployment", "web", "Auto", "")},
+			obj:          newDeployment(newResources("512Mi", "1Gi")),
+			expResult:    &vpa.Result{VPA: "web", Mode: vpa.ModeSkip},
+			expResources: newResources("512Mi", "1Gi"),
+		},
+		"Having a VPA in enforce mode, the limit should be set to the request.": {
+			mode:         vpa.ModeEnforce,
+			vpas:         []*unstructured.Unstructured{newVPA("Deployment", "web", "Initial", "")},
+			obj:          newDeployment(newResources("512Mi", "1Gi")),
+			expResult:    &vpa.Result{VPA: "web", Mode: vpa.ModeEnforce, Changed: true},
+			expResources: newResources("512Mi", "512Mi"),
+		},
+		"Having a VPA in recommendation mode, the request and limit should be set to the recommendation.": {
+			mode:         vpa.ModeRecommendation,
+			vpas:         []*unstructured.Unstructured{newVPA("Deployment", "web", "", "768Mi")},
+			obj:          newDeployment(newResources("512Mi", "1Gi")),
+			expResult:    &vpa.Result{VPA: "web", Mode: vpa.ModeRecommendation, Changed: true},
+			expResources: newResources("768Mi", "768Mi"),
+		},
+		"Having a VPA in recommendation mode without recommendation, the workload should be left untouched.": {
+			mode:         vpa.ModeRecommendation,
+			vpas:         []*unstructured.Unstructured{newVPA("Deployment", "web", "", "")},
+			obj:          newDeployment(newResources("512Mi", "1Gi")),
+			expResult:    &vpa.Result{VPA: "web", Mode: vpa.ModeRecommendation},
+			expResources: newResources("512Mi", "1Gi"),
+		},
+		"Having a pod of a deployment targeted by a VPA, it should be managed.": {
+			mode:         vpa.ModeEnforce,
+			vpas:         []*unstructured.Unstructured{newVPA("Deployment", "web", "Auto", "")},
+			obj:          newPod(newResources("600Mi", "1Gi")),
+			expResult:    &vpa.Result{VPA: "web", Mode: vpa.ModeEnforce, Changed: true},
+			expResources: newResources("600Mi", "600Mi"),
+		},
+		"Having a pod without namespace, it should fail instead of using the VPAs of other namespaces.": {
+			mode: vpa.ModeEnforce,
+			vpas: []*unstructured.Unstructured{newVPA("Deployment", "web", "Auto", "")},
+			obj: func() metav1.Object {
+				pod := newPod(newResources("600Mi", "1Gi"))
+				pod.Namespace = ""
+				return pod
+			}(),
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, v := range test.vpas {
+				require.NoError(indexer.Add(v))
+			}
+
+			c, err := vpa.NewVPACoordinator(vpa.Config{
+				VPALister: cache.NewGenericLister(indexer, vpa.GroupVersionResource.GroupResource()),
+				Mode:      test.mode,
+			})
+			require.NoError(err)
+
+			res, err := c.CoordinateMemory(context.TODO(), test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expResult, res)
+
+			var gotResources corev1.ResourceRequirements
+			switch o := test.obj.(type) {
+			case *appsv1.Deployment:
+				gotResources = o.Spec.Template.Spec.Containers[0].Resources
+			case *corev1.Pod:
+				gotResources = o.Spec.Containers[0].Resources
+			}
+			assert.True(gotResources.Requests.Memory().Equal(*test.expResources.Requests.Memory()), "requests: %s", gotResources.Requests.Memory())
+			assert.True(gotResources.Limits.Memory().Equal(*test.expResources.Limits.Memory()), "limits: %s", gotResources.Limits.Memory())
+		})
+	}
+}
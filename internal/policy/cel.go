@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// celCostLimit is the maximum runtime cost of an expression evaluation, the same limit Kubernetes applies
+// to a single validation expression.
+const celCostLimit uint64 = 1000000
+
+// celEnvs are the environments of the expressions: the object one only has the resource (`object`), the
+// container one also has the container (`container`) and its resources (`requests` and `limits`).
+var celEnvs = sync.OnceValues(func() (envs struct{ object, container *cel.Env }, err error) {
+	envs.object, err = cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+	)
+	if err != nil {
+		return envs, err
+	}
+
+	envs.container, err = envs.object.Extend(
+		cel.Variable("container", cel.DynType),
+		cel.Variable("requests", cel.MapType(cel.StringType, cel.DoubleType)),
+		cel.Variable("limits", cel.MapType(cel.StringType, cel.DoubleType)),
+	)
+	return envs, err
+})
+
+// compileCEL compiles an expression, checking its output is one of the types.
+func compileCEL(env *cel.Env, expr string, outputs ...*cel.Type) (cel.Program, error) {
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+
+	valid := false
+	for _, t := range outputs {
+		if ast.OutputType().IsEquivalentType(t) || ast.OutputType().IsEquivalentType(cel.DynType) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		names := make([]string, 0, len(outputs))
+		for _, t := range outputs {
+			names = append(names, t.String())
+		}
+		return nil, fmt.Errorf("expression returns %s, must return %s", ast.OutputType(), strings.Join(names, " or "))
+	}
+
+	return env.Program(ast, cel.CostLimit(celCostLimit))
+}
+
+// errCELNoSuchKey is returned when an expression uses a missing key, e.g a label or resource the resource
+// doesn't have.
+var errCELNoSuchKey = errors.New("no such key")
+
+func evalCEL(prg cel.Program, vars map[string]interface{}) (interface{}, error) {
+	out, _, err := prg.Eval(vars)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "no such key") {
+			return nil, fmt.Errorf("%w: %s", errCELNoSuchKey, strings.TrimPrefix(err.Error(), "no such key: "))
+		}
+		return nil, err
+	}
+
+	return out.Value(), nil
+}
+
+// celVars are the variables of the expressions evaluated on a resource, the resource is only converted once.
+// The evaluations are recorded on the trace, if any.
+type celVars struct {
+	obj    metav1.Object
+	object map[string]interface{}
+	trace  *Trace
+}
+
+func newCELVars(obj metav1.Object) *celVars {
+	return &celVars{obj: obj}
+}
+
+func newTracedCELVars(ctx context.Context, obj metav1.Object) *celVars {
+	return &celVars{obj: obj, trace: traceFrom(ctx)}
+}
+
+func (v *celVars) forObject() (map[string]interface{}, error) {
+	if v.object == nil {
+		object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(v.obj)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert resource: %w", err)
+		}
+		v.object = object
+	}
+
+	return map[string]interface{}{"object": v.object}, nil
+}
+
+func (v *celVars) forContainer(c *corev1.Container) (map[string]interface{}, error) {
+	vars, err := v.forObject()
+	if err != nil {
+		return nil, err
+	}
+
+	container, err := runtime.DefaultUnstructuredConverter.ToUnstructured(c)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert container: %w", err)
+	}
+
+	vars["container"] = container
+	vars["requests"] = resourceValues(c.Resources.Requests)
+	vars["limits"] = resourceValues(c.Resources.Limits)
+
+	return vars, nil
+}
+
+// resourceValues returns the resources as numbers, the CPU in cores and the rest in their units (e.g bytes).
+func resourceValues(rl corev1.ResourceList) map[string]float64 {
+	values := make(map[string]float64, len(rl))
+	for rName, q := range rl {
+		values[string(rName)] = q.AsApproximateFloat64()
+	}
+
+	return values
+}
+
+// resourceQuantity returns the quantity of a computed value: a number in the resourceValues units or a
+// quantity string (e.g `512Mi`).
+func resourceQuantity(rName corev1.ResourceName, value interface{}) (resource.Quantity, error) {
+	var v float64
+	switch value := value.(type) {
+	case string:
+		return resource.ParseQuantity(value)
+	case float64:
+		v = value
+	case int64:
+		v = float64(value)
+	case uint64:
+		v = float64(value)
+	default:
+		return resource.Quantity{}, fmt.Errorf("unexpected %T value", value)
+	}
+
+	if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return resource.Quantity{}, fmt.Errorf("invalid %v value", v)
+	}
+
+	var q *resource.Quantity
+	switch rName {
+	case corev1.ResourceCPU:
+		q = resource.NewMilliQuantity(int64(math.Round(v*1000)), resource.DecimalSI)
+	case corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
+		q = resource.NewQuantity(int64(math.Round(v)), resource.BinarySI)
+	default:
+		q = resource.NewQuantity(int64(math.Round(v)), resource.DecimalSI)
+	}
+
+	// Parse the canonical form, so the computed quantities are the same as the parsed ones.
+	return resource.ParseQuantity(q.String())
+}
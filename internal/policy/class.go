@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mem"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// ClassAnnotation is the annotation of the workloads, or their pod templates, with their sizing class (e.g `m`).
+const ClassAnnotation = "sizing.bitteeinbit.dev/class"
+
+// Explicit is how a class handles the container resources set explicitly.
+type Explicit string
+
+const (
+	// ExplicitKeep keeps the explicit container resources, the class only sets the missing ones.
+	ExplicitKeep Explicit = "keep"
+	// ExplicitReject rejects the resources with explicit container resources different from the class ones.
+	ExplicitReject Explicit = "reject"
+)
+
+// Class are the predefined container resources of the workloads annotated with the class, e.g the `s`, `m`,
+// `l` and `xl` t-shirt sizes.
+type Class struct {
+	// Resources are the requests and limits of the containers.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Containers are the requests and limits of specific containers by name, they replace the resources.
+	Containers map[string]corev1.ResourceRequirements `json:"containers,omitempty"`
+	// Explicit is how the container resources set explicitly are handled, by default ExplicitKeep.
+	Explicit Explicit `json:"explicit,omitempty"`
+}
+
+func (c *Class) compile(field string) []error {
+	var errs []error
+
+	switch c.Explicit {
+	case "":
+		c.Explicit = ExplicitKeep
+	case ExplicitKeep, ExplicitReject:
+	default:
+		errs = append(errs, fmt.Errorf("%s.explicit: invalid value %q, must be %q or %q", field, c.Explicit, ExplicitKeep, ExplicitReject))
+	}
+
+	if len(c.Resources.Requests) == 0 && len(c.Resources.Limits) == 0 && len(c.Containers) == 0 {
+		errs = append(errs, fmt.Errorf("%s: resources or containers are required", field))
+	}
+
+	errs = append(errs, validateRequirements(field+".resources", c.Resources)...)
+	for name, res := range c.Containers {
+		errs = append(errs, validateRequirements(fmt.Sprintf("%s.containers[%s]", field, name), res)...)
+	}
+
+	return errs
+}
+
+func validateRequirements(field string, res corev1.ResourceRequirements) []error {
+	var errs []error
+	for rName, request := range res.Requests {
+		limit, ok := res.Limits[rName]
+		if ok && request.Cmp(limit) > 0 {
+			errs = append(errs, fmt.Errorf("%s: %s request %s is greater than the limit %s", field, rName, request.String(), limit.String()))
+		}
+	}
+
+	return errs
+}
+
+// className returns the sizing class annotated on the pod template or, if missing, on the workload.
+func className(obj metav1.Object) string {
+	if meta, err := workload.PodTemplateMeta(obj); err == nil {
+		if name, ok := meta.Annotations[ClassAnnotation]; ok {
+			return name
+		}
+	}
+
+	return obj.GetAnnotations()[ClassAnnotation]
+}
+
+// class returns the first class with the name in the policies precedence order.
+func class(policies []*Policy, name string) *Class {
+	for _, p := range policies {
+		if c, ok := p.Classes[name]; ok {
+			return &c
+		}
+	}
+
+	return nil
+}
+
+// expandClass sets the container resources of the resource sizing class and guarantees their memory, the
+// resources without class are left untouched.
+func expandClass(obj metav1.Object, spec *corev1.PodSpec, policies []*Policy) (bool, error) {
+	name := className(obj)
+	if name == "" {
+		return false, nil
+	}
+
+	c := class(policies, name)
+	if c == nil {
+		return false, fmt.Errorf("unknown sizing class %q", name)
+	}
+
+	changed := false
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		res := c.Resources
+		if cres, ok := c.Containers[container.Name]; ok {
+			res = cres
+		}
+
+		// The request and limit of an explicit resource are kept together, e.g a class limit lower than the
+		// explicit request would lower it when guaranteeing the memory.
+		explicit := map[corev1.ResourceName]bool{}
+		if c.Explicit == ExplicitKeep {
+			for rName := range container.Resources.Requests {
+				explicit[rName] = true
+			}
+			for rName := range container.Resources.Limits {
+				explicit[rName] = true
+			}
+		}
+
+		original := container.Resources.DeepCopy()
+		var err error
+		container.Resources.Requests, err = expandResources(name, c, container.Name, "request", container.Resources.Requests, res.Requests, explicit)
+		if err != nil {
+			return false, err
+		}
+		container.Resources.Limits, err = expandResources(name, c, container.Name, "limit", container.Resources.Limits, res.Limits, explicit)
+		if err != nil {
+			return false, err
+		}
+		mem.GuaranteeMemory(container)
+
+		if !equality.Semantic.DeepEqual(*original, container.Resources) {
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+func expandResources(name string, c *Class, container, kind string, rl, class corev1.ResourceList, explicit map[corev1.ResourceName]bool) (corev1.ResourceList, error) {
+	for rName, q := range class {
+		current, ok := rl[rName]
+		if !ok {
+			if explicit[rName] {
+				continue
+			}
+			if rl == nil {
+				rl = corev1.ResourceList{}
+			}
+			rl[rName] = q
+			continue
+		}
+
+		if current.Cmp(q) != 0 && c.Explicit == ExplicitReject {
+			return nil, fmt.Errorf("container %q %s %s %s is explicit, the %q sizing class doesn't allow it", container, rName, kind, current.String(), name)
+		}
+	}
+
+	return rl, nil
+}
@@ -0,0 +1,188 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/log"
+)
+
+var (
+	// SizingPolicyGVR is the resource of the namespaced policies, they only apply to their namespace.
+	SizingPolicyGVR = schema.GroupVersionResource{Group: "sizing.bitteeinbit.dev", Version: "v1alpha1", Resource: "sizingpolicies"}
+	// ClusterSizingPolicyGVR is the resource of the cluster policies, they apply to all the namespaces.
+	ClusterSizingPolicyGVR = schema.GroupVersionResource{Group: "sizing.bitteeinbit.dev", Version: "v1alpha1", Resource: "clustersizingpolicies"}
+)
+
+// CRDSourceConfig is the configuration of the SizingPolicy and ClusterSizingPolicy source.
+type CRDSourceConfig struct {
+	// SizingPolicyLister lists the SizingPolicy resources.
+	SizingPolicyLister cache.GenericLister
+	// ClusterSizingPolicyLister lists the ClusterSizingPolicy resources.
+	ClusterSizingPolicyLister cache.GenericLister
+	// HasSynced returns true once the listers caches are synced, until then the source is not ready.
+	HasSynced cache.InformerSynced
+	// Logger logs the invalid policies.
+	Logger log.Logger
+}
+
+func (c *CRDSourceConfig) defaults() error {
+	if c.SizingPolicyLister == nil {
+		return fmt.Errorf("SizingPolicy lister is required")
+	}
+
+	if c.ClusterSizingPolicyLister == nil {
+		return fmt.Errorf("ClusterSizingPolicy lister is required")
+	}
+
+	if c.HasSynced == nil {
+		return fmt.Errorf("has synced is required")
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	return nil
+}
+
+// NewCRDSource returns a source with the SizingPolicy resources of the namespace followed by the
+// ClusterSizingPolicy resources, each of them sorted by name. The invalid policies are logged and ignored.
+func NewCRDSource(config CRDSourceConfig) (Source, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return &crdSource{
+		cfg:      config,
+		logger:   config.Logger.WithKV(log.KV{"svc": "policy.CRDSource"}),
+		compiled: map[types.UID]compiledPolicy{},
+	}, nil
+}
+
+type crdSource struct {
+	cfg    CRDSourceConfig
+	logger log.Logger
+	mu     sync.Mutex
+	// compiled caches the policies by resource version, so they are only parsed once.
+	compiled map[types.UID]compiledPolicy
+}
+
+type compiledPolicy struct {
+	resourceVersion string
+	policy          *Policy
+}
+
+func (c *crdSource) Policies(namespace string) ([]*Policy, error) {
+	var policies []*Policy
+
+	// Cluster scoped resources don't have namespaced policies.
+	if namespace != "" {
+		objs, err := c.cfg.SizingPolicyLister.ByNamespace(namespace).List(labels.Everything())
+		if err != nil {
+			return nil, fmt.Errorf("could not list SizingPolicies: %w", err)
+		}
+		policies = append(policies, c.compile(objs, true)...)
+	}
+
+	objs, err := c.cfg.ClusterSizingPolicyLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("could not list ClusterSizingPolicies: %w", err)
+	}
+	policies = append(policies, c.compile(objs, false)...)
+
+	return policies, nil
+}
+
+func (c *crdSource) Ready() error {
+	if !c.cfg.HasSynced() {
+		return fmt.Errorf("SizingPolicy and ClusterSizingPolicy resources not synced")
+	}
+
+	return nil
+}
+
+func (c *crdSource) compile(objs []runtime.Object, namespaced bool) []*Policy {
+	metas := make([]metav1.Object, 0, len(objs))
+	for _, obj := range objs {
+		if m, ok := obj.(metav1.Object); ok {
+			metas = append(metas, m)
+		}
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].GetName() < metas[j].GetName() })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var policies []*Policy
+	for _, m := range metas {
+		cp, ok := c.compiled[m.GetUID()]
+		if !ok || cp.resourceVersion != m.GetResourceVersion() {
+			p, err := parseCR(m, namespaced)
+			if err != nil {
+				c.logger.WithKV(log.KV{"policy": crName(m, namespaced)}).Errorf("ignoring invalid policy: %s", err)
+			}
+			cp = compiledPolicy{resourceVersion: m.GetResourceVersion(), policy: p}
+			c.compiled[m.GetUID()] = cp
+		}
+
+		if cp.policy != nil {
+			policies = append(policies, cp.policy)
+		}
+	}
+
+	return policies
+}
+
+func crName(m metav1.Object, namespaced bool) string {
+	if namespaced {
+		return fmt.Sprintf("SizingPolicy %s/%s", m.GetNamespace(), m.GetName())
+	}
+	return fmt.Sprintf("ClusterSizingPolicy %s", m.GetName())
+}
+
+// parseCR parses the policy on the spec of a SizingPolicy or ClusterSizingPolicy resource.
+func parseCR(m metav1.Object, namespaced bool) (*Policy, error) {
+	u, ok := m.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T", m)
+	}
+
+	spec, _, err := unstructured.NestedMap(u.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal spec: %w", err)
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	p.name = crName(m, namespaced)
+
+	// A namespaced policy only applies to its namespace, selecting other namespaces would be misleading.
+	if namespaced {
+		for i, r := range p.Rules {
+			if len(r.Match.Namespaces) > 0 || r.Match.NamespaceSelector != nil {
+				return nil, fmt.Errorf("invalid policy: rules[%d](%s).match: namespaces and namespaceSelector can't be used on a SizingPolicy", i, r.Name)
+			}
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,233 @@
+package policy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/policy"
+)
+
+func newSizingPolicy(kind, ns, name string, rules ...interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "sizing.bitteeinbit.dev/v1alpha1",
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"uid":             ns + "/" + name,
+			"resourceVersion": "1",
+		},
+		"spec": map[string]interface{}{"rules": rules},
+	}}
+	if ns != "" {
+		u.SetNamespace(ns)
+	}
+	return u
+}
+
+func markRule(name, value string) interface{} {
+	return map[string]interface{}{
+		"name":    name,
+		"actions": map[string]interface{}{"marks": map[string]interface{}{"policy": value}},
+	}
+}
+
+func newCRDSource(t *testing.T, ctx context.Context, objs ...runtime.Object) policy.Source {
+	cli := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		policy.SizingPolicyGVR:        "SizingPolicyList",
+		policy.ClusterSizingPolicyGVR: "ClusterSizingPolicyList",
+	}, objs...)
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(cli, 0)
+	spInformer := factory.ForResource(policy.SizingPolicyGVR)
+	cspInformer := factory.ForResource(policy.ClusterSizingPolicyGVR)
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	s, err := policy.NewCRDSource(policy.CRDSourceConfig{
+		SizingPolicyLister:        spInformer.Lister(),
+		ClusterSizingPolicyLister: cspInformer.Lister(),
+		HasSynced: func() bool {
+			return spInformer.Informer().HasSynced() && cspInformer.Informer().HasSynced()
+		},
+	})
+	require.NoError(t, err)
+	return s
+}
+
+func TestCRDSource(t *testing.T) {
+	tests := map[string]struct {
+		objs      []runtime.Object
+		file      string
+		obj       metav1.Object
+		expLabels map[string]string
+	}{
+		"Having no policies, the resource should not be marked.": {
+			obj: newPolicyDeployment(),
+		},
+		"Having a ClusterSizingPolicy, the resource should be marked.": {
+			objs: []runtime.Object{
+				newSizingPolicy("ClusterSizingPolicy", "", "base", markRule("all", "cluster")),
+			},
+			obj:       newPolicyDeployment(),
+			expLabels: map[string]string{"policy": "cluster"},
+		},
+		"Having a SizingPolicy on the namespace, it should take precedence over the ClusterSizingPolicy.": {
+			objs: []runtime.Object{
+				newSizingPolicy("ClusterSizingPolicy", "", "base", markRule("all", "cluster")),
+				newSizingPolicy("SizingPolicy", "test", "team", markRule("all", "namespace")),
+			},
+			obj:       newPolicyDeployment(),
+			expLabels: map[string]string{"policy": "namespace"},
+		},
+		"Having a SizingPolicy on other namespace, it should be ignored.": {
+			objs: []runtime.Object{
+				newSizingPolicy("SizingPolicy", "other", "team", markRule("all", "namespace")),
+			},
+			obj: newPolicyDeployment(),
+		},
+		"Having a ClusterSizingPolicy and a policy file, the ClusterSizingPolicy should take precedence.": {
+			objs: []runtime.Object{
+				newSizingPolicy("ClusterSizingPolicy", "", "base", markRule("all", "cluster")),
+			},
+			file: `
+rules:
+  - name: all
+    actions:
+      marks:
+        policy: file
+`,
+			obj:       newPolicyDeployment(),
+			expLabels: map[string]string{"policy": "cluster"},
+		},
+		"Having multiple ClusterSizingPolicies, they should be applied by name.": {
+			objs: []runtime.Object{
+				newSizingPolicy("ClusterSizingPolicy", "", "b", markRule("all", "b")),
+				newSizingPolicy("ClusterSizingPolicy", "", "a", markRule("all", "a")),
+			},
+			obj:       newPolicyDeployment(),
+			expLabels: map[string]string{"policy": "a"},
+		},
+		"Having an invalid policy, it should be ignored.": {
+			objs: []runtime.Object{
+				newSizingPolicy("ClusterSizingPolicy", "", "a", map[string]interface{}{"name": "invalid"}),
+				newSizingPolicy("ClusterSizingPolicy", "", "b", markRule("all", "b")),
+			},
+			obj:       newPolicyDeployment(),
+			expLabels: map[string]string{"policy": "b"},
+		},
+		"Having a SizingPolicy selecting namespaces, it should be ignored.": {
+			objs: []runtime.Object{
+				newSizingPolicy("SizingPolicy", "test", "team", map[string]interface{}{
+					"name":    "all",
+					"match":   map[string]interface{}{"namespaces": []interface{}{"test"}},
+					"actions": map[string]interface{}{"marks": map[string]interface{}{"policy": "namespace"}},
+				}),
+			},
+			obj: newPolicyDeployment(),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			source := newCRDSource(t, ctx, test.objs...)
+			if test.file != "" {
+				source = policy.Sources(source, mustStore(t, test.file))
+			}
+
+			m, err := policy.NewMarker(policy.Config{Source: source})
+			require.NoError(err)
+
+			err = m.Mark(ctx, test.obj)
+			require.NoError(err)
+
+			assert.Equal(test.expLabels, test.obj.GetLabels())
+		})
+	}
+}
+
+func TestCRDSourceCache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := newCRDSource(t, ctx, newSizingPolicy("ClusterSizingPolicy", "", "base", markRule("all", "v1")))
+
+	ps, err := source.Policies("test")
+	require.NoError(err)
+	require.Len(ps, 1)
+	first := ps[0]
+
+	// The same resource version should return the same compiled policy.
+	ps, err = source.Policies("test")
+	require.NoError(err)
+	require.Len(ps, 1)
+	assert.Same(first, ps[0])
+}
+
+func TestCRDSourceReady(t *testing.T) {
+	tests := map[string]struct {
+		synced bool
+		file   bool
+		expErr bool
+	}{
+		"Having the policy resources synced, it should be ready.": {
+			synced: true,
+		},
+		"Having the policy resources not synced, it should not be ready.": {
+			expErr: true,
+		},
+		"Having the policy resources not synced and a policy file, it should not be ready.": {
+			file:   true,
+			expErr: true,
+		},
+		"Having the policy resources synced and a policy file, it should be ready.": {
+			synced: true,
+			file:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			cli := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				policy.SizingPolicyGVR:        "SizingPolicyList",
+				policy.ClusterSizingPolicyGVR: "ClusterSizingPolicyList",
+			})
+			factory := dynamicinformer.NewDynamicSharedInformerFactory(cli, 0)
+			source, err := policy.NewCRDSource(policy.CRDSourceConfig{
+				SizingPolicyLister:        factory.ForResource(policy.SizingPolicyGVR).Lister(),
+				ClusterSizingPolicyLister: factory.ForResource(policy.ClusterSizingPolicyGVR).Lister(),
+				HasSynced:                 func() bool { return test.synced },
+			})
+			require.NoError(err)
+			if test.file {
+				source = policy.Sources(source, mustStore(t, "rules: []"))
+			}
+
+			err = source.Ready()
+			if test.expErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mark"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/mutation/mem"
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// Config is the configuration of the policy mutators.
+type Config struct {
+	// Source has the policies applied to the resources.
+	Source Source
+	// NamespaceLister is used to get the namespace labels, required if the policies need them.
+	NamespaceLister corev1listers.NamespaceLister
+}
+
+func (c *Config) defaults() error {
+	if c.Source == nil {
+		return fmt.Errorf("policy source is required")
+	}
+
+	return nil
+}
+
+type mutator struct {
+	cfg Config
+}
+
+func newMutator(config Config) (mutator, error) {
+	err := config.defaults()
+	if err != nil {
+		return mutator{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return mutator{cfg: config}, nil
+}
+
+// policies returns the policies of the resource, they can be replaced at any moment so the same ones must
+// be used for the whole resource.
+func (m mutator) policies(obj metav1.Object) ([]*Policy, error) {
+	policies, err := m.cfg.Source.Policies(obj.GetNamespace())
+	if err != nil {
+		return nil, fmt.Errorf("could not get policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+// match returns the first policy rule matching the resource, nil if none matches.
+func (m mutator) match(policies []*Policy, obj metav1.Object, vars *celVars) (*Rule, error) {
+	// Cluster scoped resources don't have a namespace, they don't match the namespace selectors.
+	var nsLabels labels.Set
+	if obj.GetNamespace() != "" && slices.ContainsFunc(policies, (*Policy).NeedsNamespaceLabels) {
+		if m.cfg.NamespaceLister == nil {
+			return nil, fmt.Errorf("namespace lister is required by the policy namespace selectors")
+		}
+
+		ns, err := m.cfg.NamespaceLister.Get(obj.GetNamespace())
+		if err != nil {
+			return nil, fmt.Errorf("could not get %s namespace: %w", obj.GetNamespace(), err)
+		}
+		nsLabels = ns.Labels
+	}
+
+	for _, p := range policies {
+		r, err := p.match(obj, nsLabels, vars)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			vars.trace.rule(p, r)
+			return r, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// NewMarker returns a new marker that will mark the resources with the marks of the matching policy rule.
+func NewMarker(config Config) (mark.Marker, error) {
+	m, err := newMutator(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return policymarker{mutator: m}, nil
+}
+
+type policymarker struct {
+	mutator
+}
+
+func (p policymarker) Mark(ctx context.Context, obj metav1.Object) error {
+	policies, err := p.policies(obj)
+	if err != nil {
+		return err
+	}
+
+	r, err := p.match(policies, obj, newTracedCELVars(ctx, obj))
+	if err != nil {
+		return err
+	}
+	if r == nil || len(r.Actions.Marks) == 0 {
+		return nil
+	}
+
+	return mark.NewLabelMarker(r.Actions.Marks).Mark(ctx, obj)
+}
+
+// NewFixer returns a new fixer that will expand the sizing class of the resource, apply the most specific
+// sizing profile of every container and then apply the resource actions of the matching policy rule to the
+// containers: first the defaults, then the computed values, then the bounds and finally the guaranteed memory.
+func NewFixer(config Config) (mem.Fixer, error) {
+	m, err := newMutator(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return policyfixer{mutator: m}, nil
+}
+
+type policyfixer struct {
+	mutator
+}
+
+func (p policyfixer) FixMemRequest(ctx context.Context, obj metav1.Object) (*mem.Result, error) {
+	spec, err := workload.PodSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := p.policies(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sizing class is expanded first, so the profiles and the rules apply to the class resources.
+	trace := traceFrom(ctx)
+	res := &mem.Result{}
+	res.Changed, err = expandClass(obj, spec, policies)
+	if err != nil {
+		return nil, err
+	}
+	if name := className(obj); name != "" {
+		trace.class(name)
+	}
+
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		pr := profile(policies, c)
+		if pr == nil {
+			continue
+		}
+
+		original := c.Resources.DeepCopy()
+		err := pr.apply(c)
+		if err != nil {
+			return nil, err
+		}
+		changed := !equality.Semantic.DeepEqual(*original, c.Resources)
+		trace.profile(c.Name, pr.Name, changed)
+		if changed {
+			res.Changed = true
+			res.Warnings = append(res.Warnings, fmt.Sprintf("container %q sized with the %q profile", c.Name, pr.Name))
+		}
+	}
+
+	// The expressions see the resource before the rule actions, it's converted while matching or right after.
+	vars := newTracedCELVars(ctx, obj)
+	r, err := p.match(policies, obj, vars)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return res, nil
+	}
+	if len(r.computed) > 0 {
+		if _, err := vars.forObject(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		ok, err := r.matchesContainer(c, vars)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		original := c.Resources.DeepCopy()
+		applyDefaults(c, r.Actions.Defaults)
+		err = r.compute(c, vars)
+		if err != nil {
+			return nil, err
+		}
+		applyBounds(c, r.Actions.Bounds)
+		if r.Actions.GuaranteeMemory {
+			mem.GuaranteeMemory(c)
+		}
+
+		if !equality.Semantic.DeepEqual(*original, c.Resources) {
+			res.Changed = true
+		}
+	}
+
+	return res, nil
+}
+
+// applyDefaults sets the default requests and limits missing on the container.
+func applyDefaults(c *corev1.Container, defaults *corev1.ResourceRequirements) {
+	if defaults == nil {
+		return
+	}
+
+	c.Resources.Requests = withDefaults(c.Resources.Requests, defaults.Requests)
+	c.Resources.Limits = withDefaults(c.Resources.Limits, defaults.Limits)
+}
+
+func withDefaults(rl, defaults corev1.ResourceList) corev1.ResourceList {
+	for rName, q := range defaults {
+		if _, ok := rl[rName]; ok {
+			continue
+		}
+		if rl == nil {
+			rl = corev1.ResourceList{}
+		}
+		rl[rName] = q
+	}
+
+	return rl
+}
+
+// applyBounds clamps the container requests and limits to the bounds.
+func applyBounds(c *corev1.Container, bounds *Bounds) {
+	if bounds == nil {
+		return
+	}
+
+	clamp(c.Resources.Requests, bounds)
+	clamp(c.Resources.Limits, bounds)
+}
+
+func clamp(rl corev1.ResourceList, bounds *Bounds) {
+	for rName, q := range rl {
+		if minQ, ok := bounds.Min[rName]; ok && q.Cmp(minQ) < 0 {
+			rl[rName] = minQ
+		}
+		if maxQ, ok := bounds.Max[rName]; ok && q.Cmp(maxQ) > 0 {
+			rl[rName] = maxQ
+		}
+	}
+}
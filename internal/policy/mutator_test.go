@@ -0,0 +1,627 @@
+package policy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/policy"
+)
+
+func mustStore(t *testing.T, s string) *policy.Store {
+	p, err := policy.Parse([]byte(s))
+	require.NoError(t, err)
+	return policy.NewStore(p)
+}
+
+func newContainer(name string, requests, limits corev1.ResourceList) corev1.Container {
+	return corev1.Container{
+		Name:      name,
+		Image:     "busybox",
+		Resources: corev1.ResourceRequirements{Requests: requests, Limits: limits},
+	}
+}
+
+func newPolicyDeployment(containers ...corev1.Container) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: containers}},
+		},
+	}
+}
+
+func TestPolicyFixer(t *testing.T) {
+	rl := func(cpu, mem string) corev1.ResourceList {
+		l := corev1.ResourceList{}
+		if cpu != "" {
+			l[corev1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if mem != "" {
+			l[corev1.ResourceMemory] = resource.MustParse(mem)
+		}
+		return l
+	}
+
+	tests := map[string]struct {
+		policy        string
+		obj           *appsv1.Deployment
+		expChanged    bool
+		expContainers []corev1.Container
+	}{
+		"Having no matching rule, the resource should be left untouched.": {
+			policy: `
+rules:
+  - name: other
+    match:
+      namespaces: ["other"]
+    actions:
+      guaranteeMemory: true
+`,
+			obj:           newPolicyDeployment(newContainer("app", rl("", "128Mi"), rl("", "256Mi"))),
+			expContainers: []corev1.Container{newContainer("app", rl("", "128Mi"), rl("", "256Mi"))},
+		},
+		"Having a rule guaranteeing memory, the request should be the limit.": {
+			policy: `
+rules:
+  - name: all
+    actions:
+      guaranteeMemory: true
+`,
+			obj:           newPolicyDeployment(newContainer("app", rl("", "128Mi"), rl("", "256Mi"))),
+			expChanged:    true,
+			expContainers: []corev1.Container{newContainer("app", rl("", "256Mi"), rl("", "256Mi"))},
+		},
+		"Having a rule with defaults, only the missing resources should be set.": {
+			policy: `
+rules:
+  - name: all
+    actions:
+      defaults:
+        requests:
+          cpu: 100m
+          memory: 64Mi
+`,
+			obj:           newPolicyDeployment(newContainer("app", rl("", "128Mi"), nil)),
+			expChanged:    true,
+			expContainers: []corev1.Container{newContainer("app", rl("100m", "128Mi"), nil)},
+		},
+		"Having a rule with bounds, the resources should be clamped.": {
+			policy: `
+rules:
+  - name: all
+    actions:
+      bounds:
+        min:
+          cpu: 100m
+        max:
+          cpu: "1"
+`,
+			obj:           newPolicyDeployment(newContainer("app", rl("10m", ""), rl("4", ""))),
+			expChanged:    true,
+			expContainers: []corev1.Container{newContainer("app", rl("100m", ""), rl("1", ""))},
+		},
+		"Having a rule for some containers, only those containers should be changed.": {
+			policy: `
+rules:
+  - name: sidecars
+    match:
+      containers: ["istio-*"]
+    actions:
+      defaults:
+        requests:
+          memory: 64Mi
+      guaranteeMemory: true
+`,
+			obj: newPolicyDeployment(
+				newContainer("app", nil, nil),
+				newContainer("istio-proxy", nil, nil),
+			),
+			expChanged: true,
+			expContainers: []corev1.Container{
+				newContainer("app", nil, nil),
+				newContainer("istio-proxy", rl("", "64Mi"), rl("", "64Mi")),
+			},
+		},
+		"Having a rule with computed values, they should be set before the bounds.": {
+			policy: `
+rules:
+  - name: all
+    actions:
+      compute:
+        requests.memory: "limits.memory * 0.5"
+        requests.cpu: "limits.cpu / 4.0"
+      bounds:
+        min:
+          memory: 300Mi
+`,
+			obj:           newPolicyDeployment(newContainer("app", nil, rl("2", "512Mi"))),
+			expChanged:    true,
+			expContainers: []corev1.Container{newContainer("app", rl("500m", "300Mi"), rl("2", "512Mi"))},
+		},
+		"Having a computed value using a missing resource, it should be skipped.": {
+			policy: `
+rules:
+  - name: all
+    actions:
+      compute:
+        requests.memory: "limits.memory * 0.5"
+`,
+			obj:           newPolicyDeployment(newContainer("app", rl("100m", ""), nil)),
+			expContainers: []corev1.Container{newContainer("app", rl("100m", ""), nil)},
+		},
+		"Having a rule with conditions, only the matching containers should be changed.": {
+			policy: `
+rules:
+  - name: ml-batch
+    match:
+      condition: "object.metadata.labels['tier'] == 'batch'"
+      containerCondition: "container.name.startsWith('ml-')"
+    actions:
+      compute:
+        requests.memory: "'1Gi'"
+`,
+			obj: func() *appsv1.Deployment {
+				d := newPolicyDeployment(newContainer("app", nil, nil), newContainer("ml-train", nil, nil))
+				d.Labels = map[string]string{"tier": "batch"}
+				return d
+			}(),
+			expChanged: true,
+			expContainers: []corev1.Container{
+				newContainer("app", nil, nil),
+				newContainer("ml-train", rl("", "1Gi"), nil),
+			},
+		},
+		"Having a condition on a missing label, the rule should not match.": {
+			policy: `
+rules:
+  - name: ml-batch
+    match:
+      condition: "object.metadata.labels['tier'] == 'batch'"
+    actions:
+      guaranteeMemory: true
+`,
+			obj:           newPolicyDeployment(newContainer("app", rl("", "128Mi"), rl("", "256Mi"))),
+			expContainers: []corev1.Container{newContainer("app", rl("", "128Mi"), rl("", "256Mi"))},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			f, err := policy.NewFixer(policy.Config{Source: mustStore(t, test.policy)})
+			require.NoError(err)
+
+			res, err := f.FixMemRequest(context.TODO(), test.obj)
+			require.NoError(err)
+
+			assert.Equal(test.expChanged, res.Changed)
+			assert.Equal(test.expContainers, test.obj.Spec.Template.Spec.Containers)
+		})
+	}
+}
+
+func TestPolicyMarker(t *testing.T) {
+	tests := map[string]struct {
+		policy    string
+		namespace *corev1.Namespace
+		obj       metav1.Object
+		expLabels map[string]string
+	}{
+		"Having a matching rule with marks, the resource should be marked.": {
+			policy: `
+rules:
+  - name: all
+    actions:
+      marks:
+        sized: "true"
+`,
+			obj:       &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test", Labels: map[string]string{"app": "web"}}},
+			expLabels: map[string]string{"app": "web", "sized": "true"},
+		},
+		"Having a matching rule on the namespace labels, the resource should be marked.": {
+			policy: `
+rules:
+  - name: production
+    match:
+      namespaceSelector:
+        matchLabels:
+          env: production
+    actions:
+      marks:
+        env: production
+`,
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"env": "production"}}},
+			obj:       newPolicyDeployment(),
+			expLabels: map[string]string{"env": "production"},
+		},
+		"Having a cluster scoped resource, it should not match the namespace selectors.": {
+			policy: `
+rules:
+  - name: production
+    match:
+      namespaceSelector:
+        matchLabels:
+          env: production
+    actions:
+      marks:
+        env: production
+  - name: all
+    actions:
+      marks:
+        sized: "true"
+`,
+			obj:       &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expLabels: map[string]string{"sized": "true"},
+		},
+		"Having the first matching rule without marks, the resource should not be marked.": {
+			policy: `
+rules:
+  - name: deployments
+    match:
+      kinds: ["Deployment"]
+    actions:
+      guaranteeMemory: true
+  - name: all
+    actions:
+      marks:
+        sized: "true"
+`,
+			obj: newPolicyDeployment(),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cli := fake.NewSimpleClientset()
+			if test.namespace != nil {
+				cli = fake.NewSimpleClientset(test.namespace)
+			}
+			factory := informers.NewSharedInformerFactory(cli, 0)
+			nsLister := factory.Core().V1().Namespaces().Lister()
+			factory.Start(ctx.Done())
+			factory.WaitForCacheSync(ctx.Done())
+
+			m, err := policy.NewMarker(policy.Config{Source: mustStore(t, test.policy), NamespaceLister: nsLister})
+			require.NoError(err)
+
+			err = m.Mark(ctx, test.obj)
+			require.NoError(err)
+
+			assert.Equal(test.expLabels, test.obj.GetLabels())
+		})
+	}
+}
+
+func TestPolicyFixerClasses(t *testing.T) {
+	rl := func(cpu, mem string) corev1.ResourceList {
+		l := corev1.ResourceList{}
+		if cpu != "" {
+			l[corev1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if mem != "" {
+			l[corev1.ResourceMemory] = resource.MustParse(mem)
+		}
+		return l
+	}
+
+	classes := `
+classes:
+  m:
+    resources:
+      requests:
+        cpu: 250m
+        memory: 256Mi
+      limits:
+        memory: 512Mi
+    containers:
+      istio-proxy:
+        requests:
+          cpu: 50m
+          memory: 64Mi
+  s:
+    resources:
+      requests:
+        memory: 128Mi
+      limits:
+        memory: 192Mi
+  strict:
+    explicit: reject
+    resources:
+      requests:
+        memory: 256Mi
+rules:
+  - name: all
+    actions:
+      bounds:
+        max:
+          memory: 384Mi
+`
+
+	withClass := func(class string, onTemplate bool, containers ...corev1.Container) *appsv1.Deployment {
+		d := newPolicyDeployment(containers...)
+		annotations := map[string]string{"sizing.bitteeinbit.dev/class": class}
+		if onTemplate {
+			d.Spec.Template.Annotations = annotations
+		} else {
+			d.Annotations = annotations
+		}
+		return d
+	}
+
+	tests := map[string]struct {
+		obj           *appsv1.Deployment
+		expChanged    bool
+		expContainers []corev1.Container
+		expErr        bool
+	}{
+		"Having no class, the class resources should not be set.": {
+			obj:           newPolicyDeployment(newContainer("app", rl("", "128Mi"), nil)),
+			expContainers: []corev1.Container{newContainer("app", rl("", "128Mi"), nil)},
+		},
+		"Having a class on the template, the class resources should be expanded, guaranteed and then the rules applied.": {
+			obj:        withClass("m", true, newContainer("app", nil, nil), newContainer("istio-proxy", nil, nil)),
+			expChanged: true,
+			expContainers: []corev1.Container{
+				newContainer("app", rl("250m", "384Mi"), rl("", "384Mi")),
+				newContainer("istio-proxy", rl("50m", "64Mi"), rl("", "64Mi")),
+			},
+		},
+		"Having a class on the workload, the explicit resources should win.": {
+			obj:           withClass("m", false, newContainer("app", rl("1", ""), nil)),
+			expChanged:    true,
+			expContainers: []corev1.Container{newContainer("app", rl("1", "384Mi"), rl("", "384Mi"))},
+		},
+		"Having a class on the workload and an explicit request above the class limit, the explicit request should be kept.": {
+			obj:           withClass("s", false, newContainer("app", rl("", "320Mi"), nil)),
+			expChanged:    true,
+			expContainers: []corev1.Container{newContainer("app", rl("", "320Mi"), rl("", "320Mi"))},
+		},
+		"Having a class on the workload and an explicit limit, the class request should not be set.": {
+			obj:           withClass("s", false, newContainer("app", nil, rl("", "320Mi"))),
+			expChanged:    true,
+			expContainers: []corev1.Container{newContainer("app", rl("", "320Mi"), rl("", "320Mi"))},
+		},
+		"Having a class rejecting explicit resources and the same resources, it should be valid.": {
+			obj:           withClass("strict", true, newContainer("app", rl("", "256Mi"), nil)),
+			expChanged:    true,
+			expContainers: []corev1.Container{newContainer("app", rl("", "256Mi"), rl("", "256Mi"))},
+		},
+		"Having a class rejecting explicit resources and other resources, it should fail.": {
+			obj:    withClass("strict", true, newContainer("app", rl("", "1Gi"), nil)),
+			expErr: true,
+		},
+		"Having an unknown class, it should fail.": {
+			obj:    withClass("xxl", true, newContainer("app", nil, nil)),
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			f, err := policy.NewFixer(policy.Config{Source: mustStore(t, classes)})
+			require.NoError(err)
+
+			res, err := f.FixMemRequest(context.TODO(), test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expChanged, res.Changed)
+			assert.Equal(test.expContainers, test.obj.Spec.Template.Spec.Containers)
+		})
+	}
+}
+
+func TestPolicyFixerProfiles(t *testing.T) {
+	rl := func(cpu, mem string) corev1.ResourceList {
+		l := corev1.ResourceList{}
+		if cpu != "" {
+			l[corev1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if mem != "" {
+			l[corev1.ResourceMemory] = resource.MustParse(mem)
+		}
+		return l
+	}
+	withImage := func(c corev1.Container, image string) corev1.Container {
+		c.Image = image
+		return c
+	}
+
+	profiles := `
+profiles:
+  - name: redis
+    image: "redis:*"
+    defaults:
+      requests:
+        memory: 1Gi
+    limitRatios:
+      memory: 1
+  - name: redis-cache
+    image: "redis:*"
+    container: cache
+    defaults:
+      requests:
+        memory: 512Mi
+  - name: envoy
+    imageRegex: "^envoyproxy/.*"
+    min:
+      memory: 256Mi
+    limitRatios:
+      cpu: 4
+  - name: envoy-pattern
+    image: "envoyproxy/*"
+    defaults:
+      requests:
+        memory: 128Mi
+  - name: envoy-prefix
+    image: "envoy*"
+    defaults:
+      requests:
+        memory: 128Mi
+  - name: any
+    image: "*"
+    defaults:
+      requests:
+        cpu: 10m
+rules: []
+`
+
+	tests := map[string]struct {
+		containers    []corev1.Container
+		expChanged    bool
+		expContainers []corev1.Container
+		expWarnings   []string
+	}{
+		"Having a container without matching profile, it should be left untouched.": {
+			containers:    []corev1.Container{withImage(newContainer("app", rl("100m", ""), nil), "ghcr.io/app")},
+			expContainers: []corev1.Container{withImage(newContainer("app", rl("100m", ""), nil), "ghcr.io/app")},
+		},
+		"Having an image matching a profile, its defaults and ratios should be applied.": {
+			containers:    []corev1.Container{withImage(newContainer("redis", nil, nil), "redis:7")},
+			expChanged:    true,
+			expContainers: []corev1.Container{withImage(newContainer("redis", rl("", "1Gi"), rl("", "1Gi")), "redis:7")},
+			expWarnings:   []string{`container "redis" sized with the "redis" profile`},
+		},
+		"Having several matching profiles, the one with the container name should win.": {
+			containers:    []corev1.Container{withImage(newContainer("cache", nil, nil), "redis:7")},
+			expChanged:    true,
+			expContainers: []corev1.Container{withImage(newContainer("cache", rl("", "512Mi"), nil), "redis:7")},
+			expWarnings:   []string{`container "cache" sized with the "redis-cache" profile`},
+		},
+		"Having an image matching a regex profile, its minimums and ratios should be applied.": {
+			containers:    []corev1.Container{withImage(newContainer("proxy", rl("100m", "64Mi"), rl("1", "")), "envoyproxy/envoy:v1.30")},
+			expChanged:    true,
+			expContainers: []corev1.Container{withImage(newContainer("proxy", rl("100m", "256Mi"), rl("400m", "")), "envoyproxy/envoy:v1.30")},
+			expWarnings:   []string{`container "proxy" sized with the "envoy" profile`},
+		},
+		"Having an anchored regex profile and a pattern profile with the same literal prefix, the first one should win.": {
+			containers:    []corev1.Container{withImage(newContainer("proxy", rl("", "64Mi"), nil), "envoyproxy/ratelimit")},
+			expChanged:    true,
+			expContainers: []corev1.Container{withImage(newContainer("proxy", rl("", "256Mi"), nil), "envoyproxy/ratelimit")},
+			expWarnings:   []string{`container "proxy" sized with the "envoy" profile`},
+		},
+		"Having a profile that doesn't change the container, it should not be warned.": {
+			containers:    []corev1.Container{withImage(newContainer("app", rl("100m", ""), nil), "busybox")},
+			expContainers: []corev1.Container{withImage(newContainer("app", rl("100m", ""), nil), "busybox")},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			f, err := policy.NewFixer(policy.Config{Source: mustStore(t, profiles)})
+			require.NoError(err)
+
+			obj := newPolicyDeployment(test.containers...)
+			res, err := f.FixMemRequest(context.TODO(), obj)
+			require.NoError(err)
+
+			assert.Equal(test.expChanged, res.Changed)
+			assert.Equal(test.expWarnings, res.Warnings)
+			assert.Equal(test.expContainers, obj.Spec.Template.Spec.Containers)
+		})
+	}
+}
+
+func TestPolicyFixerTrace(t *testing.T) {
+	pol := `
+profiles:
+  - name: busybox
+    image: busybox
+    defaults:
+      limits:
+        memory: 1Gi
+rules:
+  - name: other
+    match:
+      condition: "object.metadata.name == 'other'"
+    actions:
+      guaranteeMemory: true
+  - name: web
+    match:
+      containerCondition: "container.name == 'app'"
+    actions:
+      compute:
+        requests.memory: "limits.memory * 0.5"
+        requests.cpu: "requests.cpu"
+`
+
+	tests := map[string]struct {
+		trace    bool
+		expTrace *policy.Trace
+	}{
+		"Having no trace on the context, the resource should be fixed without recording the decisions.": {},
+		"Having a trace on the context, the profiles, conditions, rule and computed values should be recorded.": {
+			trace: true,
+			expTrace: &policy.Trace{
+				Profiles: []policy.ProfileDecision{
+					{Container: "app", Profile: "busybox", Changed: true},
+					{Container: "sidecar", Profile: "busybox", Changed: true},
+				},
+				Conditions: []policy.ConditionDecision{
+					{Rule: "other", Expression: "object.metadata.name == 'other'", Result: false},
+					{Rule: "web", Container: "app", Expression: "container.name == 'app'", Result: true},
+					{Rule: "web", Container: "app", Expression: "container.name == 'app'", Result: true},
+					{Rule: "web", Container: "sidecar", Expression: "container.name == 'app'", Result: false},
+				},
+				Policy: "",
+				Rule:   "web",
+				Computed: []policy.ComputedDecision{
+					{Rule: "web", Container: "app", Field: "requests.cpu", Expression: "requests.cpu", Error: "no such key: cpu"},
+					{Rule: "web", Container: "app", Field: "requests.memory", Expression: "limits.memory * 0.5", Value: "512Mi"},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			store := mustStore(t, pol)
+			f, err := policy.NewFixer(policy.Config{Source: store})
+			require.NoError(err)
+
+			ctx := context.TODO()
+			var trace *policy.Trace
+			if test.trace {
+				ctx, trace = policy.WithTrace(ctx)
+				test.expTrace.Policy = store.Policy().Name()
+			}
+
+			obj := newPolicyDeployment(newContainer("app", nil, nil), newContainer("sidecar", nil, nil))
+			res, err := f.FixMemRequest(ctx, obj)
+			require.NoError(err)
+
+			assert.True(res.Changed)
+			assert.Equal("512Mi", obj.Spec.Template.Spec.Containers[0].Resources.Requests.Memory().String())
+			assert.Equal(test.expTrace, trace)
+		})
+	}
+}
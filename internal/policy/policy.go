@@ -0,0 +1,472 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// Policy is an ordered list of sizing rules, the first rule matching a resource is the one applied.
+type Policy struct {
+	// Classes are the sizing classes by name, the workloads select them with the class annotation.
+	Classes map[string]Class `json:"classes,omitempty"`
+	// Profiles are the sizing profiles of the container images.
+	Profiles []Profile `json:"profiles,omitempty"`
+	Rules    []Rule    `json:"rules"`
+
+	name                 string
+	hash                 string
+	needsNamespaceLabels bool
+}
+
+// Rule applies its actions to the resources matching its criteria.
+type Rule struct {
+	// Name identifies the rule, it must be unique.
+	Name    string  `json:"name"`
+	Match   Match   `json:"match,omitempty"`
+	Actions Actions `json:"actions"`
+
+	namespaceSelector  labels.Selector
+	objectSelector     labels.Selector
+	condition          cel.Program
+	containerCondition cel.Program
+	computed           []computedValue
+}
+
+// computedValue is a container resource computed by an expression.
+type computedValue struct {
+	field    string
+	limits   bool
+	resource corev1.ResourceName
+	program  cel.Program
+}
+
+// Match are the criteria a resource must meet to apply a rule, empty criteria match everything.
+type Match struct {
+	// Namespaces are the namespaces of the resources.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects the resources by the labels of their namespace.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Kinds are the workload kinds of the resources (e.g `Deployment`).
+	Kinds []string `json:"kinds,omitempty"`
+	// ObjectSelector selects the resources by their labels.
+	ObjectSelector *metav1.LabelSelector `json:"objectSelector,omitempty"`
+	// Containers are the container names, or `path.Match` patterns (e.g `istio-*`), the resource actions
+	// apply to. A resource without any of these containers doesn't match.
+	Containers []string `json:"containers,omitempty"`
+	// Condition is a CEL expression on the resource (`object`) that must be true.
+	Condition string `json:"condition,omitempty"`
+	// ContainerCondition is a CEL expression on the resource (`object`), the container (`container`) and
+	// its resources (`requests` and `limits`), the resource actions apply to the containers where it's true.
+	// A resource without any of these containers doesn't match.
+	ContainerCondition string `json:"containerCondition,omitempty"`
+}
+
+// Actions are the changes applied to the matching resources.
+type Actions struct {
+	// GuaranteeMemory sets the memory requests equal to the limits.
+	GuaranteeMemory bool `json:"guaranteeMemory,omitempty"`
+	// Defaults are the requests and limits set on the containers that don't have them.
+	Defaults *corev1.ResourceRequirements `json:"defaults,omitempty"`
+	// Compute are the container requests and limits (e.g `requests.memory`) set to the result of a CEL
+	// expression, with the same variables as the container condition (e.g `limits.memory * 0.9`).
+	Compute map[string]string `json:"compute,omitempty"`
+	// Bounds are the minimum and maximum the container requests and limits are clamped to.
+	Bounds *Bounds `json:"bounds,omitempty"`
+	// Marks are the labels set on the resources.
+	Marks map[string]string `json:"marks,omitempty"`
+}
+
+// Bounds are the minimum and maximum of the container resources.
+type Bounds struct {
+	Min corev1.ResourceList `json:"min,omitempty"`
+	Max corev1.ResourceList `json:"max,omitempty"`
+}
+
+// Load loads a policy from a YAML file.
+func Load(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read policy file: %w", err)
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	p.name = file
+
+	return p, nil
+}
+
+// Parse parses and validates a YAML policy, all the validation errors are returned at once.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	err := yaml.UnmarshalStrict(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	err = p.compile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	p.hash = hash(data)
+
+	return p, nil
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Hash returns the hash of the policy source, it identifies the active policy.
+func (p *Policy) Hash() string {
+	return p.hash
+}
+
+// Name returns where the policy comes from (e.g its file), its hash if unknown.
+func (p *Policy) Name() string {
+	if p.name == "" {
+		return p.hash
+	}
+	return p.name
+}
+
+// compile validates the policy and prepares its rules for matching.
+func (p *Policy) compile() error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(p.Classes)) {
+		c := p.Classes[name]
+		field := fmt.Sprintf("classes[%s]", name)
+		if name == "" {
+			errs = append(errs, fmt.Errorf("%s: name required", field))
+		}
+		errs = append(errs, c.compile(field)...)
+		p.Classes[name] = c
+	}
+
+	profiles := map[string]bool{}
+	for i := range p.Profiles {
+		pr := &p.Profiles[i]
+		field := fmt.Sprintf("profiles[%d]", i)
+		if pr.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name: required", field))
+		} else {
+			field = fmt.Sprintf("profiles[%d](%s)", i, pr.Name)
+			if profiles[pr.Name] {
+				errs = append(errs, fmt.Errorf("%s.name: duplicated", field))
+			}
+			profiles[pr.Name] = true
+		}
+		errs = append(errs, pr.compile(field)...)
+	}
+
+	names := map[string]bool{}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		field := fmt.Sprintf("rules[%d]", i)
+
+		if r.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name: required", field))
+		} else {
+			field = fmt.Sprintf("rules[%d](%s)", i, r.Name)
+			if names[r.Name] {
+				errs = append(errs, fmt.Errorf("%s.name: duplicated", field))
+			}
+			names[r.Name] = true
+		}
+
+		errs = append(errs, r.compile(field)...)
+		if r.namespaceSelector != nil {
+			p.needsNamespaceLabels = true
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Rule) compile(field string) []error {
+	var errs []error
+
+	for i, k := range r.Match.Kinds {
+		if !slices.Contains(workload.Kinds, k) {
+			errs = append(errs, fmt.Errorf("%s.match.kinds[%d]: unknown kind %q, must be one of %s", field, i, k, strings.Join(workload.Kinds, ", ")))
+		}
+	}
+
+	for i, c := range r.Match.Containers {
+		if _, err := path.Match(c, ""); c == "" || err != nil {
+			errs = append(errs, fmt.Errorf("%s.match.containers[%d]: invalid container name pattern %q", field, i, c))
+		}
+	}
+
+	if r.Match.NamespaceSelector != nil {
+		s, err := metav1.LabelSelectorAsSelector(r.Match.NamespaceSelector)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.match.namespaceSelector: %w", field, err))
+		}
+		r.namespaceSelector = s
+	}
+
+	if r.Match.ObjectSelector != nil {
+		s, err := metav1.LabelSelectorAsSelector(r.Match.ObjectSelector)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.match.objectSelector: %w", field, err))
+		}
+		r.objectSelector = s
+	}
+
+	errs = append(errs, r.compileCEL(field)...)
+
+	a := r.Actions
+	if !a.GuaranteeMemory && a.Defaults == nil && len(a.Compute) == 0 && a.Bounds == nil && len(a.Marks) == 0 {
+		errs = append(errs, fmt.Errorf("%s.actions: at least one action is required", field))
+	}
+
+	if a.Bounds != nil {
+		for rName, minQ := range a.Bounds.Min {
+			maxQ, ok := a.Bounds.Max[rName]
+			if ok && minQ.Cmp(maxQ) > 0 {
+				errs = append(errs, fmt.Errorf("%s.actions.bounds: %s minimum %s is greater than the maximum %s", field, rName, minQ.String(), maxQ.String()))
+			}
+		}
+	}
+
+	for k, v := range a.Marks {
+		for _, msg := range validation.IsQualifiedName(k) {
+			errs = append(errs, fmt.Errorf("%s.actions.marks: invalid label key %q: %s", field, k, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(v) {
+			errs = append(errs, fmt.Errorf("%s.actions.marks: invalid label value %q: %s", field, v, msg))
+		}
+	}
+
+	return errs
+}
+
+func (r *Rule) compileCEL(field string) []error {
+	envs, err := celEnvs()
+	if err != nil {
+		return []error{fmt.Errorf("could not create CEL environment: %w", err)}
+	}
+
+	var errs []error
+	if r.Match.Condition != "" {
+		r.condition, err = compileCEL(envs.object, r.Match.Condition, cel.BoolType)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.match.condition: %w", field, err))
+		}
+	}
+
+	if r.Match.ContainerCondition != "" {
+		r.containerCondition, err = compileCEL(envs.container, r.Match.ContainerCondition, cel.BoolType)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.match.containerCondition: %w", field, err))
+		}
+	}
+
+	r.computed = nil
+	for _, key := range slices.Sorted(maps.Keys(r.Actions.Compute)) {
+		kind, rName, _ := strings.Cut(key, ".")
+		if (kind != "requests" && kind != "limits") || rName == "" {
+			errs = append(errs, fmt.Errorf("%s.actions.compute: invalid key %q, must be requests.<resource> or limits.<resource>", field, key))
+			continue
+		}
+
+		prg, err := compileCEL(envs.container, r.Actions.Compute[key], cel.DoubleType, cel.IntType, cel.StringType)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.actions.compute[%s]: %w", field, key, err))
+			continue
+		}
+		r.computed = append(r.computed, computedValue{
+			field:    key,
+			limits:   kind == "limits",
+			resource: corev1.ResourceName(rName),
+			program:  prg,
+		})
+	}
+
+	return errs
+}
+
+// NeedsNamespaceLabels returns true if any rule selects the resources by their namespace labels.
+func (p *Policy) NeedsNamespaceLabels() bool {
+	return p.needsNamespaceLabels
+}
+
+// Match returns the first rule matching the resource, nil if no rule matches. The namespace labels are
+// only used when NeedsNamespaceLabels is true. The conditions using a missing key (e.g a label the resource
+// doesn't have) are false, other evaluation errors (e.g exceeding the cost limit) are returned.
+func (p *Policy) Match(obj metav1.Object, namespaceLabels labels.Set) (*Rule, error) {
+	return p.match(obj, namespaceLabels, newCELVars(obj))
+}
+
+func (p *Policy) match(obj metav1.Object, namespaceLabels labels.Set, vars *celVars) (*Rule, error) {
+	// Not all the marked resources are workloads, these only match the rules without workload criteria.
+	kind, _ := workload.Kind(obj)
+	var containers []corev1.Container
+	if spec, err := workload.PodSpec(obj); err == nil {
+		containers = spec.Containers
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		m := r.Match
+
+		if len(m.Namespaces) > 0 && !slices.Contains(m.Namespaces, obj.GetNamespace()) {
+			continue
+		}
+
+		if r.namespaceSelector != nil && (obj.GetNamespace() == "" || !r.namespaceSelector.Matches(namespaceLabels)) {
+			continue
+		}
+
+		if len(m.Kinds) > 0 && !slices.Contains(m.Kinds, kind) {
+			continue
+		}
+
+		if r.objectSelector != nil && !r.objectSelector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+
+		if r.condition != nil {
+			vs, err := vars.forObject()
+			if err != nil {
+				return nil, err
+			}
+			ok, err := evalCondition(r.condition, vs)
+			vars.trace.condition(r, "", m.Condition, ok, err)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s condition: %w", r.Name, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if len(m.Containers) > 0 || r.containerCondition != nil {
+			matched := false
+			for i := range containers {
+				ok, err := r.matchesContainer(&containers[i], vars)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		return r, nil
+	}
+
+	return nil, nil
+}
+
+// MatchesContainer returns true if the rule actions apply to the container of the resource.
+func (r *Rule) MatchesContainer(obj metav1.Object, c *corev1.Container) (bool, error) {
+	return r.matchesContainer(c, newCELVars(obj))
+}
+
+func (r *Rule) matchesContainer(c *corev1.Container, vars *celVars) (bool, error) {
+	if len(r.Match.Containers) > 0 && !slices.ContainsFunc(r.Match.Containers, func(pattern string) bool {
+		ok, _ := path.Match(pattern, c.Name)
+		return ok
+	}) {
+		return false, nil
+	}
+
+	if r.containerCondition == nil {
+		return true, nil
+	}
+
+	vs, err := vars.forContainer(c)
+	if err != nil {
+		return false, err
+	}
+	ok, err := evalCondition(r.containerCondition, vs)
+	vars.trace.condition(r, c.Name, r.Match.ContainerCondition, ok, err)
+	if err != nil {
+		return false, fmt.Errorf("rule %s container condition: %w", r.Name, err)
+	}
+
+	return ok, nil
+}
+
+func evalCondition(prg cel.Program, vars map[string]interface{}) (bool, error) {
+	out, err := evalCEL(prg, vars)
+	if errors.Is(err, errCELNoSuchKey) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ok, isBool := out.(bool)
+	if !isBool {
+		return false, fmt.Errorf("expression returned %T, must return a bool", out)
+	}
+
+	return ok, nil
+}
+
+// compute sets the container resources computed by the rule expressions, the ones using a missing key
+// (e.g a resource the container doesn't have) are skipped.
+func (r *Rule) compute(c *corev1.Container, vars *celVars) error {
+	for _, cv := range r.computed {
+		vs, err := vars.forContainer(c)
+		if err != nil {
+			return err
+		}
+
+		out, err := evalCEL(cv.program, vs)
+		if errors.Is(err, errCELNoSuchKey) {
+			vars.trace.computed(r, c.Name, cv.field, "", err)
+			continue
+		}
+		if err != nil {
+			vars.trace.computed(r, c.Name, cv.field, "", err)
+			return fmt.Errorf("rule %s compute %s: %w", r.Name, cv.field, err)
+		}
+
+		q, err := resourceQuantity(cv.resource, out)
+		if err != nil {
+			vars.trace.computed(r, c.Name, cv.field, "", err)
+			return fmt.Errorf("rule %s compute %s: %w", r.Name, cv.field, err)
+		}
+		vars.trace.computed(r, c.Name, cv.field, q.String(), nil)
+
+		rl := &c.Resources.Requests
+		if cv.limits {
+			rl = &c.Resources.Limits
+		}
+		if *rl == nil {
+			*rl = corev1.ResourceList{}
+		}
+		(*rl)[cv.resource] = q
+	}
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/policy"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		policy    string
+		expRules  int
+		expErr    bool
+		expErrMsg []string
+	}{
+		"A valid policy should be parsed.": {
+			policy: `
+rules:
+  - name: team-a
+    match:
+      namespaces: ["team-a"]
+      namespaceSelector:
+        matchLabels:
+          team: a
+      kinds: ["Deployment", "StatefulSet"]
+      objectSelector:
+        matchExpressions:
+          - {key: tier, operator: In, values: ["web"]}
+      containers: ["app", "istio-*"]
+    actions:
+      guaranteeMemory: true
+      defaults:
+        requests:
+          cpu: 100m
+          memory: 128Mi
+      bounds:
+        min:
+          cpu: 50m
+        max:
+          cpu: "2"
+      marks:
+        sizing: team-a
+  - name: everything
+    actions:
+      guaranteeMemory: true
+`,
+			expRules: 2,
+		},
+		"An unknown field should fail.": {
+			policy: `
+rules:
+  - name: team-a
+    actions:
+      guaranteMemory: true
+`,
+			expErr:    true,
+			expErrMsg: []string{"guaranteMemory"},
+		},
+		"An invalid quantity should fail.": {
+			policy: `
+rules:
+  - name: team-a
+    actions:
+      defaults:
+        requests:
+          memory: lots
+`,
+			expErr: true,
+		},
+		"All the validation errors should be returned.": {
+			policy: `
+rules:
+  - name: team-a
+    match:
+      kinds: ["Deploymnt"]
+    actions:
+      bounds:
+        min:
+          cpu: "2"
+        max:
+          cpu: "1"
+  - name: team-a
+    actions:
+      marks:
+        "bad key!": ok
+  - match:
+      containers: ["[app"]
+    actions:
+      guaranteeMemory: true
+`,
+			expErr: true,
+			expErrMsg: []string{
+				`rules[0](team-a).match.kinds[0]: unknown kind "Deploymnt"`,
+				`rules[0](team-a).actions.bounds: cpu minimum 2 is greater than the maximum 1`,
+				`rules[1](team-a).name: duplicated`,
+				`rules[1](team-a).actions.marks: invalid label key "bad key!"`,
+				`rules[2].name: required`,
+				`rules[2].match.containers[0]: invalid container name pattern "[app"`,
+			},
+		},
+		"A policy with CEL expressions should be parsed.": {
+			policy: `
+rules:
+  - name: ml-batch
+    match:
+      condition: "object.metadata.labels['tier'] == 'batch'"
+      containerCondition: "container.image.startsWith('ghcr.io/ml/')"
+    actions:
+      compute:
+        requests.memory: "limits.memory * 0.9"
+        limits.cpu: "'2'"
+`,
+			expRules: 1,
+		},
+		"Invalid CEL expressions should fail at load time.": {
+			policy: `
+rules:
+  - name: ml-batch
+    match:
+      condition: "object.metadata.labels['tier']"
+      containerCondition: "container.image.startsWith("
+    actions:
+      compute:
+        requests.memory: "limits.memory > 1.0"
+        memory: "1.0"
+`,
+			expErr: true,
+			expErrMsg: []string{
+				"rules[0](ml-batch).match.containerCondition: ERROR",
+				"rules[0](ml-batch).actions.compute: invalid key \"memory\"",
+				"rules[0](ml-batch).actions.compute[requests.memory]: expression returns bool",
+			},
+		},
+		"A condition not returning a bool should fail at load time.": {
+			policy: `
+rules:
+  - name: ml-batch
+    match:
+      containerCondition: "container.name + 'x'"
+    actions:
+      guaranteeMemory: true
+`,
+			expErr:    true,
+			expErrMsg: []string{"rules[0](ml-batch).match.containerCondition: expression returns string, must return bool"},
+		},
+		"Invalid classes should fail.": {
+			policy: `
+classes:
+  s:
+    explicit: maybe
+    resources:
+      requests:
+        memory: 256Mi
+      limits:
+        memory: 128Mi
+  m: {}
+rules: []
+`,
+			expErr: true,
+			expErrMsg: []string{
+				`classes[s].explicit: invalid value "maybe"`,
+				`classes[s].resources: memory request 256Mi is greater than the limit 128Mi`,
+				`classes[m]: resources or containers are required`,
+			},
+		},
+		"Invalid profiles should fail.": {
+			policy: `
+profiles:
+  - name: redis
+    image: "redis:*"
+    imageRegex: "^redis"
+    limitRatios:
+      memory: 0.5
+  - name: redis
+    imageRegex: "(redis"
+  - image: "[redis"
+    min:
+      memory: 1Gi
+rules: []
+`,
+			expErr: true,
+			expErrMsg: []string{
+				`profiles[0](redis): image and imageRegex can't be used together`,
+				`profiles[0](redis).limitRatios: memory ratio must be greater or equal than 1`,
+				`profiles[1](redis).name: duplicated`,
+				`profiles[1](redis).imageRegex: error parsing regexp`,
+				`profiles[1](redis): defaults, min or limitRatios is required`,
+				`profiles[2].name: required`,
+				`profiles[2].image: invalid image pattern "[redis"`,
+			},
+		},
+		"A rule without actions should fail.": {
+			policy: `
+rules:
+  - name: team-a
+    match:
+      namespaces: ["team-a"]
+`,
+			expErr:    true,
+			expErrMsg: []string{"rules[0](team-a).actions: at least one action is required"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			p, err := policy.Parse([]byte(test.policy))
+			if test.expErr {
+				require.Error(err)
+				for _, msg := range test.expErrMsg {
+					assert.Contains(err.Error(), msg)
+				}
+				return
+			}
+			require.NoError(err)
+
+			assert.Len(p.Rules, test.expRules)
+		})
+	}
+}
+
+func TestPolicyMatch(t *testing.T) {
+	p, err := policy.Parse([]byte(`
+rules:
+  - name: sidecars
+    match:
+      containers: ["istio-*"]
+    actions:
+      guaranteeMemory: true
+  - name: team-a-web
+    match:
+      namespaces: ["team-a"]
+      kinds: ["Deployment"]
+      objectSelector:
+        matchLabels:
+          tier: web
+    actions:
+      guaranteeMemory: true
+  - name: production
+    match:
+      namespaceSelector:
+        matchLabels:
+          env: production
+    actions:
+      guaranteeMemory: true
+`))
+	require.NoError(t, err)
+
+	newDeployment := func(ns string, lbls map[string]string, containers ...string) *appsv1.Deployment {
+		d := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns, Labels: lbls}}
+		for _, c := range containers {
+			d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, corev1.Container{Name: c})
+		}
+		return d
+	}
+
+	tests := map[string]struct {
+		obj      metav1.Object
+		nsLabels labels.Set
+		expRule  string
+	}{
+		"A resource with a matching container should match the first rule.": {
+			obj:     newDeployment("team-a", map[string]string{"tier": "web"}, "app", "istio-proxy"),
+			expRule: "sidecars",
+		},
+		"A resource matching namespace, kind and labels should match.": {
+			obj:     newDeployment("team-a", map[string]string{"tier": "web"}, "app"),
+			expRule: "team-a-web",
+		},
+		"A resource with other labels should not match.": {
+			obj: newDeployment("team-a", map[string]string{"tier": "db"}, "app"),
+		},
+		"A resource on a namespace with matching labels should match.": {
+			obj:      newDeployment("team-b", nil, "app"),
+			nsLabels: labels.Set{"env": "production"},
+			expRule:  "production",
+		},
+		"A resource of other kind should not match.": {
+			obj: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Labels: map[string]string{"tier": "web"}}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			r, err := p.Match(test.obj, test.nsLabels)
+			require.NoError(err)
+			if test.expRule == "" {
+				assert.Nil(r)
+				return
+			}
+			if assert.NotNil(r) {
+				assert.Equal(test.expRule, r.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Profile is the sizing of the containers of an image, e.g `redis:*` needs about 1Gi of memory.
+type Profile struct {
+	// Name identifies the profile in the warnings, it must be unique.
+	Name string `json:"name"`
+	// Image is a `path.Match` pattern of the container images (e.g `envoyproxy/*`).
+	Image string `json:"image,omitempty"`
+	// ImageRegex is a regular expression of the container images, used instead of the image pattern.
+	ImageRegex string `json:"imageRegex,omitempty"`
+	// Container is a `path.Match` pattern of the container names, optional.
+	Container string `json:"container,omitempty"`
+	// Defaults are the requests and limits set on the containers that don't have them.
+	Defaults *corev1.ResourceRequirements `json:"defaults,omitempty"`
+	// Min are the minimum container requests and limits.
+	Min corev1.ResourceList `json:"min,omitempty"`
+	// LimitRatios are the maximum limit to request ratios, the missing or greater limits are set to the
+	// request multiplied by the ratio (e.g `memory: 1` guarantees the memory).
+	LimitRatios map[corev1.ResourceName]float64 `json:"limitRatios,omitempty"`
+
+	imageRegex  *regexp.Regexp
+	specificity int
+}
+
+func (p *Profile) compile(field string) []error {
+	var errs []error
+
+	switch {
+	case p.Image == "" && p.ImageRegex == "":
+		errs = append(errs, fmt.Errorf("%s: image or imageRegex is required", field))
+	case p.Image != "" && p.ImageRegex != "":
+		errs = append(errs, fmt.Errorf("%s: image and imageRegex can't be used together", field))
+	case p.Image != "":
+		if _, err := path.Match(p.Image, ""); err != nil {
+			errs = append(errs, fmt.Errorf("%s.image: invalid image pattern %q", field, p.Image))
+		}
+		p.specificity = len(p.Image) - strings.Count(p.Image, "*") - strings.Count(p.Image, "?")
+	default:
+		re, err := regexp.Compile(p.ImageRegex)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.imageRegex: %w", field, err))
+			break
+		}
+		p.imageRegex = re
+		// The literal prefix of an anchored regex is empty, the anchor doesn't make it less specific.
+		if unanchored, err := regexp.Compile(strings.TrimPrefix(p.ImageRegex, "^")); err == nil {
+			prefix, _ := unanchored.LiteralPrefix()
+			p.specificity = len(prefix)
+		}
+	}
+
+	if p.Container != "" {
+		if _, err := path.Match(p.Container, ""); err != nil {
+			errs = append(errs, fmt.Errorf("%s.container: invalid container name pattern %q", field, p.Container))
+		}
+		// A profile for specific containers is more specific than any image pattern.
+		p.specificity += 1 << 16
+	}
+
+	if p.Defaults == nil && len(p.Min) == 0 && len(p.LimitRatios) == 0 {
+		errs = append(errs, fmt.Errorf("%s: defaults, min or limitRatios is required", field))
+	}
+
+	for rName, ratio := range p.LimitRatios {
+		if ratio < 1 {
+			errs = append(errs, fmt.Errorf("%s.limitRatios: %s ratio must be greater or equal than 1", field, rName))
+		}
+	}
+
+	return errs
+}
+
+// matches returns true if the profile applies to the container.
+func (p *Profile) matches(c *corev1.Container) bool {
+	if p.Container != "" {
+		if ok, _ := path.Match(p.Container, c.Name); !ok {
+			return false
+		}
+	}
+
+	if p.imageRegex != nil {
+		return p.imageRegex.MatchString(c.Image)
+	}
+
+	ok, _ := path.Match(p.Image, c.Image)
+	return ok
+}
+
+// profile returns the most specific profile of the container: the ones with a container name pattern,
+// then the ones with the longest literal image pattern and finally the first one in the policies
+// precedence order.
+func profile(policies []*Policy, c *corev1.Container) *Profile {
+	var best *Profile
+	for _, p := range policies {
+		for i := range p.Profiles {
+			pr := &p.Profiles[i]
+			if !pr.matches(c) {
+				continue
+			}
+			if best == nil || pr.specificity > best.specificity {
+				best = pr
+			}
+		}
+	}
+
+	return best
+}
+
+// apply applies the profile to the container: first the defaults, then the minimums and finally the ratios.
+func (p *Profile) apply(c *corev1.Container) error {
+	applyDefaults(c, p.Defaults)
+	applyBounds(c, &Bounds{Min: p.Min})
+
+	for rName, ratio := range p.LimitRatios {
+		request, ok := c.Resources.Requests[rName]
+		if !ok {
+			continue
+		}
+
+		maxQ, err := resourceQuantity(rName, request.AsApproximateFloat64()*ratio)
+		if err != nil {
+			return fmt.Errorf("profile %s %s limit ratio: %w", p.Name, rName, err)
+		}
+
+		limit, ok := c.Resources.Limits[rName]
+		if ok && limit.Cmp(maxQ) <= 0 {
+			continue
+		}
+		if c.Resources.Limits == nil {
+			c.Resources.Limits = corev1.ResourceList{}
+		}
+		c.Resources.Limits[rName] = maxQ
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/log"
+)
+
+// Source knows how to get the policies applied to the resources of a namespace, in precedence order.
+type Source interface {
+	Policies(namespace string) ([]*Policy, error)
+	// Ready returns why the policies are not available yet, e.g the policy resources are not synced.
+	Ready() error
+}
+
+// Sources returns a source with the policies of all the sources, in the sources order.
+func Sources(sources ...Source) Source {
+	return multiSource(sources)
+}
+
+type multiSource []Source
+
+func (m multiSource) Policies(namespace string) ([]*Policy, error) {
+	var policies []*Policy
+	for _, s := range m {
+		ps, err := s.Policies(namespace)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, ps...)
+	}
+
+	return policies, nil
+}
+
+func (m multiSource) Ready() error {
+	for _, s := range m {
+		err := s.Ready()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Store has the active policy, the policy can be replaced while the mutators are using it.
+type Store struct {
+	active atomic.Pointer[Policy]
+}
+
+// NewStore returns a new store with the policy as the active one.
+func NewStore(p *Policy) *Store {
+	s := &Store{}
+	s.Set(p)
+	return s
+}
+
+// Policy returns the active policy.
+func (s *Store) Policy() *Policy {
+	return s.active.Load()
+}
+
+// Policies satisfies Source interface.
+func (s *Store) Policies(_ string) ([]*Policy, error) {
+	p := s.active.Load()
+	if p == nil {
+		return nil, nil
+	}
+
+	return []*Policy{p}, nil
+}
+
+// Ready satisfies Source interface.
+func (s *Store) Ready() error {
+	if s.active.Load() == nil {
+		return fmt.Errorf("policy not loaded")
+	}
+
+	return nil
+}
+
+// Set replaces the active policy.
+func (s *Store) Set(p *Policy) {
+	s.active.Store(p)
+}
+
+// MetricsRecorder knows how to record the policy metrics.
+type MetricsRecorder interface {
+	// SetActivePolicy records the hash of the active policy.
+	SetActivePolicy(hash string)
+	// IncPolicyReload records a policy reload attempt.
+	IncPolicyReload(success bool)
+}
+
+// DummyMetricsRecorder is a metrics recorder that doesn't record anything.
+var DummyMetricsRecorder MetricsRecorder = dummyMetricsRecorder(0)
+
+type dummyMetricsRecorder int
+
+func (dummyMetricsRecorder) SetActivePolicy(_ string) {}
+func (dummyMetricsRecorder) IncPolicyReload(_ bool)   {}
+
+// ReloaderConfig is the configuration of the policy reloader.
+type ReloaderConfig struct {
+	// File is the policy file, normally a mounted ConfigMap.
+	File string
+	// Store is where the reloaded policy is set.
+	Store *Store
+	// Interval is how often the file is checked for changes, by default 10s.
+	Interval time.Duration
+	// Signals trigger a reload on every received signal (e.g SIGHUP), optional.
+	Signals <-chan os.Signal
+	// MetricsRecorder records the active policy and the reloads.
+	MetricsRecorder MetricsRecorder
+	// Logger logs the reloads.
+	Logger log.Logger
+}
+
+func (c *ReloaderConfig) defaults() error {
+	if c.File == "" {
+		return fmt.Errorf("policy file is required")
+	}
+
+	if c.Store == nil {
+		return fmt.Errorf("policy store is required")
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+
+	if c.MetricsRecorder == nil {
+		c.MetricsRecorder = DummyMetricsRecorder
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	return nil
+}
+
+// Reloader reloads the policy file when it changes, if the new policy is invalid the active one is kept.
+type Reloader struct {
+	cfg    ReloaderConfig
+	logger log.Logger
+	mu     sync.Mutex
+	// invalidHash and invalidErr are from the last invalid policy, so it's only reported once.
+	invalidHash string
+	invalidErr  error
+}
+
+// NewReloader returns a new policy reloader.
+func NewReloader(config ReloaderConfig) (*Reloader, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	r := &Reloader{
+		cfg:    config,
+		logger: config.Logger.WithKV(log.KV{"svc": "policy.Reloader", "file": config.File}),
+	}
+	if p := config.Store.Policy(); p != nil {
+		config.MetricsRecorder.SetActivePolicy(p.Hash())
+	}
+
+	return r, nil
+}
+
+// Reload loads the policy file and replaces the active policy if it changed.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := os.ReadFile(r.cfg.File)
+	if err != nil {
+		r.cfg.MetricsRecorder.IncPolicyReload(false)
+		r.logger.Errorf("could not read policy file, keeping the active policy: %s", err)
+		return err
+	}
+
+	h := hash(data)
+	if active := r.cfg.Store.Policy(); active != nil && active.Hash() == h {
+		r.logger.Debugf("policy %s didn't change", h)
+		return nil
+	}
+	if h == r.invalidHash {
+		return r.invalidErr
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		r.invalidHash, r.invalidErr = h, err
+		r.cfg.MetricsRecorder.IncPolicyReload(false)
+		r.logger.WithKV(log.KV{"policy": h}).Errorf("could not reload policy, keeping the active one: %s", err)
+		return err
+	}
+	p.name = r.cfg.File
+
+	r.cfg.Store.Set(p)
+	r.cfg.MetricsRecorder.IncPolicyReload(true)
+	r.cfg.MetricsRecorder.SetActivePolicy(p.Hash())
+	r.logger.WithKV(log.KV{"policy": p.Hash()}).Infof("policy reloaded with %d rules", len(p.Rules))
+
+	return nil
+}
+
+// Run reloads the policy on every interval and signal until the context is done.
+func (r *Reloader) Run(ctx context.Context) error {
+	t := time.NewTicker(r.cfg.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case s := <-r.cfg.Signals:
+			r.logger.Infof("signal %s received, reloading policy", s)
+			_ = r.Reload()
+		case <-t.C:
+			_ = r.Reload()
+		}
+	}
+}
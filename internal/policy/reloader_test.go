@@ -0,0 +1,115 @@
+package policy_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/policy"
+)
+
+type testMetricsRecorder struct {
+	active  string
+	reloads map[bool]int
+}
+
+func (t *testMetricsRecorder) SetActivePolicy(hash string) { t.active = hash }
+func (t *testMetricsRecorder) IncPolicyReload(success bool) {
+	if t.reloads == nil {
+		t.reloads = map[bool]int{}
+	}
+	t.reloads[success]++
+}
+
+func TestReloaderReload(t *testing.T) {
+	const initial = `
+rules:
+  - name: all
+    actions:
+      guaranteeMemory: true
+`
+
+	tests := map[string]struct {
+		newPolicy     string
+		removeFile    bool
+		expErr        bool
+		expRule       string
+		expChanged    bool
+		expReloadsOK  int
+		expReloadsErr int
+	}{
+		"Having the same policy, it should not be replaced.": {
+			newPolicy: initial,
+			expRule:   "all",
+		},
+		"Having a new valid policy, it should be replaced.": {
+			newPolicy: `
+rules:
+  - name: team-a
+    actions:
+      marks:
+        team: a
+`,
+			expRule:      "team-a",
+			expChanged:   true,
+			expReloadsOK: 1,
+		},
+		"Having a new invalid policy, the active one should be kept.": {
+			newPolicy: `
+rules:
+  - name: team-a
+    actions: {}
+`,
+			expErr:        true,
+			expRule:       "all",
+			expReloadsErr: 1,
+		},
+		"Having a missing policy file, the active one should be kept.": {
+			removeFile:    true,
+			expErr:        true,
+			expRule:       "all",
+			expReloadsErr: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			file := filepath.Join(t.TempDir(), "policy.yaml")
+			require.NoError(os.WriteFile(file, []byte(initial), 0o600))
+			p, err := policy.Load(file)
+			require.NoError(err)
+			store := policy.NewStore(p)
+
+			rec := &testMetricsRecorder{}
+			r, err := policy.NewReloader(policy.ReloaderConfig{File: file, Store: store, MetricsRecorder: rec})
+			require.NoError(err)
+			assert.Equal(p.Hash(), rec.active)
+
+			if test.removeFile {
+				require.NoError(os.Remove(file))
+			} else {
+				require.NoError(os.WriteFile(file, []byte(test.newPolicy), 0o600))
+			}
+
+			err = r.Reload()
+			if test.expErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+
+			active := store.Policy()
+			assert.Equal(test.expRule, active.Rules[0].Name)
+			assert.Equal(test.expChanged, active.Hash() != p.Hash())
+			assert.Equal(active.Hash(), rec.active)
+			assert.Equal(test.expReloadsOK, rec.reloads[true])
+			assert.Equal(test.expReloadsErr, rec.reloads[false])
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package policy
+
+import (
+	"context"
+)
+
+// Trace records the policy decisions taken on a resource, it explains why the resource was changed.
+type Trace struct {
+	// Class is the sizing class expanded on the resource.
+	Class string `json:"class,omitempty"`
+	// Profiles are the sizing profiles applied to the containers.
+	Profiles []ProfileDecision `json:"profiles,omitempty"`
+	// Policy is the policy of the matched rule.
+	Policy string `json:"policy,omitempty"`
+	// Rule is the name of the matched rule, empty if no rule matched.
+	Rule string `json:"rule,omitempty"`
+	// Conditions are the CEL conditions evaluated while matching, in evaluation order.
+	Conditions []ConditionDecision `json:"conditions,omitempty"`
+	// Computed are the container resources computed by the matched rule.
+	Computed []ComputedDecision `json:"computed,omitempty"`
+}
+
+// ProfileDecision is a sizing profile applied to a container.
+type ProfileDecision struct {
+	Container string `json:"container"`
+	Profile   string `json:"profile"`
+	Changed   bool   `json:"changed"`
+}
+
+// ConditionDecision is the result of a rule condition, the container is empty on the resource conditions.
+type ConditionDecision struct {
+	Rule       string `json:"rule"`
+	Container  string `json:"container,omitempty"`
+	Expression string `json:"expression"`
+	Result     bool   `json:"result"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ComputedDecision is a container resource computed by a rule, the value is empty if it was skipped.
+type ComputedDecision struct {
+	Rule       string `json:"rule"`
+	Container  string `json:"container"`
+	Field      string `json:"field"`
+	Expression string `json:"expression"`
+	Value      string `json:"value,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context that records on the returned trace the decisions of the policy mutators
+// called with it.
+func WithTrace(ctx context.Context) (context.Context, *Trace) {
+	t := &Trace{}
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// traceFrom returns the trace of the context, nil if the decisions are not recorded. All the trace
+// methods are safe to call on a nil trace.
+func traceFrom(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+func (t *Trace) class(name string) {
+	if t == nil {
+		return
+	}
+	t.Class = name
+}
+
+func (t *Trace) profile(container, profile string, changed bool) {
+	if t == nil {
+		return
+	}
+	t.Profiles = append(t.Profiles, ProfileDecision{Container: container, Profile: profile, Changed: changed})
+}
+
+func (t *Trace) rule(p *Policy, r *Rule) {
+	if t == nil {
+		return
+	}
+	t.Policy, t.Rule = p.Name(), r.Name
+}
+
+func (t *Trace) condition(r *Rule, container, expr string, result bool, err error) {
+	if t == nil {
+		return
+	}
+	d := ConditionDecision{Rule: r.Name, Container: container, Expression: expr, Result: result}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	t.Conditions = append(t.Conditions, d)
+}
+
+func (t *Trace) computed(r *Rule, container, field, value string, err error) {
+	if t == nil {
+		return
+	}
+	d := ComputedDecision{Rule: r.Name, Container: container, Field: field, Expression: r.Actions.Compute[field], Value: value}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	t.Computed = append(t.Computed, d)
+}
@@ -0,0 +1,374 @@
+package registration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/log"
+)
+
+const (
+	// ManagedByLabel is the label set on the registered webhook configurations.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "k8s-sizing-webhook"
+)
+
+// Webhook is a webhook served by the application.
+type Webhook struct {
+	// Name is the webhook name, e.g `allmark.bitteeinbit.dev`.
+	Name string
+	// Path is the webhook server path, e.g `/wh/mutating/allmark`.
+	Path string
+	// Mutating is true for the mutating webhooks, false for the validating ones.
+	Mutating bool
+	// FailurePolicy is what happens when the webhook can't be called, by default `Fail`.
+	FailurePolicy admissionregistrationv1.FailurePolicyType
+	// ReinvocationPolicy is when a mutating webhook is called again, by default `Never`.
+	ReinvocationPolicy admissionregistrationv1.ReinvocationPolicyType
+	// Rules are the operations and resources sent to the webhook.
+	Rules []admissionregistrationv1.RuleWithOperations
+	// ObjectSelector selects the resources sent to the webhook by their labels, all if nil.
+	ObjectSelector *metav1.LabelSelector
+}
+
+// Config is the configuration of the webhook registration reconciler.
+type Config struct {
+	// Client is the Kubernetes client used to manage the webhook configurations.
+	Client kubernetes.Interface
+	// Name is the name of the MutatingWebhookConfiguration and ValidatingWebhookConfiguration.
+	Name string
+	// ServiceNamespace is the namespace of the webhook service.
+	ServiceNamespace string
+	// ServiceName is the name of the webhook service.
+	ServiceName string
+	// ServicePort is the port of the webhook service, by default 443.
+	ServicePort int32
+	// Webhooks are the registered webhooks, the configurations without webhooks are removed.
+	Webhooks []Webhook
+	// CABundleFile is the PEM CA file that signed the webhook certificate, if empty the caBundle of the
+	// registered webhooks is kept (e.g set by cert-manager).
+	CABundleFile string
+	// CABundle returns the PEM CA that signed the webhook certificate (e.g the bootstrapped one), used instead of
+	// the CA file. The webhooks are not registered while it returns nil, so they are never created without a CA.
+	CABundle func() []byte
+	// Interval is how often the webhook configurations are reconciled, by default 1m.
+	Interval time.Duration
+	// Logger logs the changes.
+	Logger log.Logger
+}
+
+func (c *Config) defaults() error {
+	if c.Client == nil {
+		return fmt.Errorf("kubernetes client is required")
+	}
+
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if c.ServiceNamespace == "" || c.ServiceName == "" {
+		return fmt.Errorf("service namespace and name are required")
+	}
+
+	if c.ServicePort == 0 {
+		c.ServicePort = 443
+	}
+
+	for i, wh := range c.Webhooks {
+		if wh.Name == "" || wh.Path == "" {
+			return fmt.Errorf("webhooks[%d]: name and path are required", i)
+		}
+
+		if wh.FailurePolicy == "" {
+			c.Webhooks[i].FailurePolicy = admissionregistrationv1.Fail
+		}
+		if fp := c.Webhooks[i].FailurePolicy; fp != admissionregistrationv1.Fail && fp != admissionregistrationv1.Ignore {
+			return fmt.Errorf("webhooks[%d]: invalid failure policy %q, must be %q or %q", i, fp, admissionregistrationv1.Fail, admissionregistrationv1.Ignore)
+		}
+
+		if wh.ReinvocationPolicy == "" {
+			c.Webhooks[i].ReinvocationPolicy = admissionregistrationv1.NeverReinvocationPolicy
+		}
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	return nil
+}
+
+// Reconciler keeps the webhook configurations of the cluster in line with the webhooks served by the application.
+type Reconciler struct {
+	cfg    Config
+	logger log.Logger
+}
+
+// NewReconciler returns a new webhook registration reconciler.
+func NewReconciler(config Config) (*Reconciler, error) {
+	// The webhooks defaults are set on a copy, the configuration could be shared.
+	config.Webhooks = append([]Webhook(nil), config.Webhooks...)
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return &Reconciler{
+		cfg:    config,
+		logger: config.Logger.WithKV(log.KV{"svc": "registration.Reconciler", "name": config.Name}),
+	}, nil
+}
+
+// Apply creates, updates or removes the webhook configurations so they register the webhooks.
+func (r *Reconciler) Apply(ctx context.Context) error {
+	var caBundle []byte
+	if r.cfg.CABundleFile != "" {
+		var err error
+		caBundle, err = os.ReadFile(r.cfg.CABundleFile)
+		if err != nil {
+			return fmt.Errorf("could not read CA bundle file: %w", err)
+		}
+	} else if r.cfg.CABundle != nil {
+		caBundle = r.cfg.CABundle()
+		if len(caBundle) == 0 {
+			return fmt.Errorf("CA bundle not available yet")
+		}
+	}
+
+	var mutating []admissionregistrationv1.MutatingWebhook
+	var validating []admissionregistrationv1.ValidatingWebhook
+	for _, wh := range r.cfg.Webhooks {
+		cc := admissionregistrationv1.WebhookClientConfig{
+			Service: &admissionregistrationv1.ServiceReference{
+				Namespace: r.cfg.ServiceNamespace,
+				Name:      r.cfg.ServiceName,
+				Path:      ptr(wh.Path),
+				Port:      ptr(r.cfg.ServicePort),
+			},
+			CABundle: caBundle,
+		}
+		// The API server defaults are set, so the registered webhooks are only updated when they change.
+		rules := make([]admissionregistrationv1.RuleWithOperations, 0, len(wh.Rules))
+		for _, rule := range wh.Rules {
+			if rule.Scope == nil {
+				rule.Scope = ptr(admissionregistrationv1.AllScopes)
+			}
+			rules = append(rules, rule)
+		}
+		objectSelector := wh.ObjectSelector
+		if objectSelector == nil {
+			objectSelector = &metav1.LabelSelector{}
+		}
+
+		if wh.Mutating {
+			mutating = append(mutating, admissionregistrationv1.MutatingWebhook{
+				Name:                    wh.Name,
+				ClientConfig:            cc,
+				Rules:                   rules,
+				FailurePolicy:           ptr(wh.FailurePolicy),
+				MatchPolicy:             ptr(admissionregistrationv1.Equivalent),
+				NamespaceSelector:       &metav1.LabelSelector{},
+				ObjectSelector:          objectSelector,
+				SideEffects:             ptr(admissionregistrationv1.SideEffectClassNone),
+				TimeoutSeconds:          ptr(int32(10)),
+				AdmissionReviewVersions: []string{"v1"},
+				ReinvocationPolicy:      ptr(wh.ReinvocationPolicy),
+			})
+			continue
+		}
+
+		validating = append(validating, admissionregistrationv1.ValidatingWebhook{
+			Name:                    wh.Name,
+			ClientConfig:            cc,
+			Rules:                   rules,
+			FailurePolicy:           ptr(wh.FailurePolicy),
+			MatchPolicy:             ptr(admissionregistrationv1.Equivalent),
+			NamespaceSelector:       &metav1.LabelSelector{},
+			ObjectSelector:          objectSelector,
+			SideEffects:             ptr(admissionregistrationv1.SideEffectClassNone),
+			TimeoutSeconds:          ptr(int32(10)),
+			AdmissionReviewVersions: []string{"v1"},
+		})
+	}
+
+	err := r.applyMutating(ctx, mutating, caBundle != nil)
+	if err != nil {
+		return err
+	}
+
+	return r.applyValidating(ctx, validating, caBundle != nil)
+}
+
+func (r *Reconciler) applyMutating(ctx context.Context, webhooks []admissionregistrationv1.MutatingWebhook, hasCABundle bool) error {
+	client := r.cfg.Client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+
+	current, err := client.Get(ctx, r.cfg.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if len(webhooks) == 0 {
+			return nil
+		}
+		_, err := client.Create(ctx, &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: r.objectMeta(),
+			Webhooks:   webhooks,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("could not create mutating webhook configuration: %w", err)
+		}
+		r.logger.Infof("mutating webhook configuration created with %d webhooks", len(webhooks))
+		return nil
+	case err != nil:
+		return fmt.Errorf("could not get mutating webhook configuration: %w", err)
+	}
+
+	if len(webhooks) == 0 {
+		return r.delete(ctx, "mutating", client.Delete)
+	}
+
+	if !hasCABundle {
+		caBundles := map[string][]byte{}
+		for _, wh := range current.Webhooks {
+			caBundles[wh.Name] = wh.ClientConfig.CABundle
+		}
+		for i, wh := range webhooks {
+			webhooks[i].ClientConfig.CABundle = caBundles[wh.Name]
+		}
+	}
+	if equality.Semantic.DeepEqual(current.Webhooks, webhooks) && current.Labels[ManagedByLabel] == managedBy {
+		r.logger.Debugf("mutating webhook configuration didn't change")
+		return nil
+	}
+
+	current = current.DeepCopy()
+	current.Labels = mergeLabels(current.Labels)
+	current.Webhooks = webhooks
+	_, err = client.Update(ctx, current, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("could not update mutating webhook configuration: %w", err)
+	}
+	r.logger.Infof("mutating webhook configuration updated with %d webhooks", len(webhooks))
+
+	return nil
+}
+
+func (r *Reconciler) applyValidating(ctx context.Context, webhooks []admissionregistrationv1.ValidatingWebhook, hasCABundle bool) error {
+	client := r.cfg.Client.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+
+	current, err := client.Get(ctx, r.cfg.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if len(webhooks) == 0 {
+			return nil
+		}
+		_, err := client.Create(ctx, &admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: r.objectMeta(),
+			Webhooks:   webhooks,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("could not create validating webhook configuration: %w", err)
+		}
+		r.logger.Infof("validating webhook configuration created with %d webhooks", len(webhooks))
+		return nil
+	case err != nil:
+		return fmt.Errorf("could not get validating webhook configuration: %w", err)
+	}
+
+	if len(webhooks) == 0 {
+		return r.delete(ctx, "validating", client.Delete)
+	}
+
+	if !hasCABundle {
+		caBundles := map[string][]byte{}
+		for _, wh := range current.Webhooks {
+			caBundles[wh.Name] = wh.ClientConfig.CABundle
+		}
+		for i, wh := range webhooks {
+			webhooks[i].ClientConfig.CABundle = caBundles[wh.Name]
+		}
+	}
+	if equality.Semantic.DeepEqual(current.Webhooks, webhooks) && current.Labels[ManagedByLabel] == managedBy {
+		r.logger.Debugf("validating webhook configuration didn't change")
+		return nil
+	}
+
+	current = current.DeepCopy()
+	current.Labels = mergeLabels(current.Labels)
+	current.Webhooks = webhooks
+	_, err = client.Update(ctx, current, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("could not update validating webhook configuration: %w", err)
+	}
+	r.logger.Infof("validating webhook configuration updated with %d webhooks", len(webhooks))
+
+	return nil
+}
+
+// Delete removes the webhook configurations, e.g when the application is uninstalled.
+func (r *Reconciler) Delete(ctx context.Context) error {
+	admissionregistration := r.cfg.Client.AdmissionregistrationV1()
+
+	err := r.delete(ctx, "mutating", admissionregistration.MutatingWebhookConfigurations().Delete)
+	if err != nil {
+		return err
+	}
+
+	return r.delete(ctx, "validating", admissionregistration.ValidatingWebhookConfigurations().Delete)
+}
+
+func (r *Reconciler) delete(ctx context.Context, kind string, del func(context.Context, string, metav1.DeleteOptions) error) error {
+	err := del(ctx, r.cfg.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("could not delete %s webhook configuration: %w", kind, err)
+	}
+	if err == nil {
+		r.logger.Infof("%s webhook configuration deleted", kind)
+	}
+
+	return nil
+}
+
+// Run applies the webhook configurations on every interval until the context is done, so the manual changes
+// are reverted.
+func (r *Reconciler) Run(ctx context.Context) error {
+	t := time.NewTicker(r.cfg.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			err := r.Apply(ctx)
+			if err != nil {
+				r.logger.Errorf("could not apply webhook configurations: %s", err)
+			}
+		}
+	}
+}
+
+func (r *Reconciler) objectMeta() metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: r.cfg.Name, Labels: mergeLabels(nil)}
+}
+
+func mergeLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ManagedByLabel] = managedBy
+
+	return labels
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,307 @@
+package registration_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/registration"
+)
+
+var (
+	testRules = []admissionregistrationv1.RuleWithOperations{{
+		Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+		Rule: admissionregistrationv1.Rule{
+			APIGroups:   []string{"*"},
+			APIVersions: []string{"*"},
+			Resources:   []string{"pods"},
+		},
+	}}
+	testMutating   = registration.Webhook{Name: "allmark.bitteeinbit.dev", Path: "/wh/mutating/allmark", Mutating: true, Rules: testRules}
+	testValidating = registration.Webhook{Name: "cpubounds.bitteeinbit.dev", Path: "/wh/validating/cpubounds", FailurePolicy: admissionregistrationv1.Ignore, Rules: testRules}
+)
+
+func newTestReconciler(t *testing.T, cli *fake.Clientset, webhooks []registration.Webhook, caBundleFile string) *registration.Reconciler {
+	t.Helper()
+
+	r, err := registration.NewReconciler(registration.Config{
+		Client:           cli,
+		Name:             "webhook",
+		ServiceNamespace: "test",
+		ServiceName:      "webhook",
+		Webhooks:         webhooks,
+		CABundleFile:     caBundleFile,
+	})
+	require.NoError(t, err)
+
+	return r
+}
+
+// countActions returns the number of the client actions with the verb.
+func countActions(cli *fake.Clientset, verb string) int {
+	n := 0
+	for _, a := range cli.Actions() {
+		if a.GetVerb() == verb {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestReconcilerApply(t *testing.T) {
+	tests := map[string]struct {
+		objs        []runtime.Object
+		webhooks    []registration.Webhook
+		caBundle    string
+		expMutating []string
+		expValidate []string
+		expCABundle string
+		expCreates  int
+		expUpdates  int
+		expDeletes  int
+	}{
+		"Having no webhook configurations, they should be created.": {
+			webhooks:    []registration.Webhook{testMutating, testValidating},
+			expMutating: []string{"allmark.bitteeinbit.dev"},
+			expValidate: []string{"cpubounds.bitteeinbit.dev"},
+			expCreates:  2,
+		},
+		"Having a CA bundle file, it should be set on the webhooks.": {
+			webhooks:    []registration.Webhook{testMutating, testValidating},
+			caBundle:    "ca",
+			expMutating: []string{"allmark.bitteeinbit.dev"},
+			expValidate: []string{"cpubounds.bitteeinbit.dev"},
+			expCABundle: "ca",
+			expCreates:  2,
+		},
+		"Having only mutating webhooks, the validating configuration should not be created.": {
+			webhooks:    []registration.Webhook{testMutating},
+			expMutating: []string{"allmark.bitteeinbit.dev"},
+			expCreates:  1,
+		},
+		"Having a changed webhook configuration, it should be updated keeping the caBundle.": {
+			objs: []runtime.Object{
+				&admissionregistrationv1.MutatingWebhookConfiguration{
+					ObjectMeta: metav1.ObjectMeta{Name: "webhook", Annotations: map[string]string{"keep": "true"}},
+					Webhooks: []admissionregistrationv1.MutatingWebhook{
+						{Name: "allmark.bitteeinbit.dev", ClientConfig: admissionregistrationv1.WebhookClientConfig{CABundle: []byte("bootstrapped")}},
+						{Name: "memfix.bitteeinbit.dev"},
+					},
+				},
+			},
+			webhooks:    []registration.Webhook{testMutating},
+			expMutating: []string{"allmark.bitteeinbit.dev"},
+			expCABundle: "bootstrapped",
+			expUpdates:  1,
+		},
+		"Having a webhook configuration without enabled webhooks, it should be deleted.": {
+			objs: []runtime.Object{
+				&admissionregistrationv1.ValidatingWebhookConfiguration{
+					ObjectMeta: metav1.ObjectMeta{Name: "webhook"},
+					Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "cpubounds.bitteeinbit.dev"}},
+				},
+			},
+			webhooks:    []registration.Webhook{testMutating},
+			expMutating: []string{"allmark.bitteeinbit.dev"},
+			expCreates:  1,
+			expDeletes:  1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			ctx := context.Background()
+
+			var caBundleFile string
+			if test.caBundle != "" {
+				caBundleFile = filepath.Join(t.TempDir(), "ca.crt")
+				require.NoError(os.WriteFile(caBundleFile, []byte(test.caBundle), 0o600))
+			}
+
+			cli := fake.NewSimpleClientset(test.objs...)
+			r := newTestReconciler(t, cli, test.webhooks, caBundleFile)
+			require.NoError(r.Apply(ctx))
+
+			assert.Equal(test.expCreates, countActions(cli, "create"))
+			assert.Equal(test.expUpdates, countActions(cli, "update"))
+			assert.Equal(test.expDeletes, countActions(cli, "delete"))
+
+			mwc, err := cli.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "webhook", metav1.GetOptions{})
+			if test.expMutating == nil {
+				assert.True(apierrors.IsNotFound(err))
+			} else {
+				require.NoError(err)
+				assert.Equal("k8s-sizing-webhook", mwc.Labels[registration.ManagedByLabel])
+				var names []string
+				for _, wh := range mwc.Webhooks {
+					names = append(names, wh.Name)
+					assert.Equal("webhook", wh.ClientConfig.Service.Name)
+					assert.Equal("test", wh.ClientConfig.Service.Namespace)
+					assert.Equal(test.expCABundle, string(wh.ClientConfig.CABundle))
+				}
+				assert.Equal(test.expMutating, names)
+				for k, v := range objMeta(test.objs, "mutating").Annotations {
+					assert.Equal(v, mwc.Annotations[k], "the annotations should be kept")
+				}
+			}
+
+			vwc, err := cli.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "webhook", metav1.GetOptions{})
+			if test.expValidate == nil {
+				assert.True(apierrors.IsNotFound(err))
+			} else {
+				require.NoError(err)
+				var names []string
+				for _, wh := range vwc.Webhooks {
+					names = append(names, wh.Name)
+					assert.Equal(admissionregistrationv1.Ignore, *wh.FailurePolicy)
+					assert.Equal(test.expCABundle, string(wh.ClientConfig.CABundle))
+				}
+				assert.Equal(test.expValidate, names)
+			}
+
+			// The applied configurations should not be updated again.
+			cli.ClearActions()
+			require.NoError(r.Apply(ctx))
+			assert.Zero(countActions(cli, "create") + countActions(cli, "update") + countActions(cli, "delete"))
+		})
+	}
+}
+
+func TestReconcilerApplyCABundle(t *testing.T) {
+	tests := map[string]struct {
+		caBundle    string
+		expErr      bool
+		expCABundle string
+	}{
+		"Having a CA bundle, it should be set on the created webhooks.": {
+			caBundle:    "bootstrapped",
+			expCABundle: "bootstrapped",
+		},
+		"Having no CA bundle yet, the webhooks should not be registered.": {
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			ctx := context.Background()
+
+			cli := fake.NewSimpleClientset()
+			r, err := registration.NewReconciler(registration.Config{
+				Client:           cli,
+				Name:             "webhook",
+				ServiceNamespace: "test",
+				ServiceName:      "webhook",
+				Webhooks:         []registration.Webhook{testMutating, testValidating},
+				CABundle:         func() []byte { return []byte(test.caBundle) },
+			})
+			require.NoError(err)
+
+			err = r.Apply(ctx)
+			if test.expErr {
+				assert.Error(err)
+				assert.Zero(countActions(cli, "create"))
+				return
+			}
+			require.NoError(err)
+
+			mwc, err := cli.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "webhook", metav1.GetOptions{})
+			require.NoError(err)
+			for _, wh := range mwc.Webhooks {
+				assert.Equal(test.expCABundle, string(wh.ClientConfig.CABundle))
+			}
+			vwc, err := cli.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "webhook", metav1.GetOptions{})
+			require.NoError(err)
+			for _, wh := range vwc.Webhooks {
+				assert.Equal(test.expCABundle, string(wh.ClientConfig.CABundle))
+			}
+		})
+	}
+}
+
+// objMeta returns the object metadata of the first mutating or validating webhook configuration of the objects.
+func objMeta(objs []runtime.Object, kind string) metav1.ObjectMeta {
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *admissionregistrationv1.MutatingWebhookConfiguration:
+			if kind == "mutating" {
+				return o.ObjectMeta
+			}
+		case *admissionregistrationv1.ValidatingWebhookConfiguration:
+			if kind == "validating" {
+				return o.ObjectMeta
+			}
+		}
+	}
+
+	return metav1.ObjectMeta{}
+}
+
+func TestReconcilerDelete(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	cli := fake.NewSimpleClientset()
+	r := newTestReconciler(t, cli, []registration.Webhook{testMutating, testValidating}, "")
+	require.NoError(r.Apply(ctx))
+	require.NoError(r.Delete(ctx))
+
+	_, err := cli.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "webhook", metav1.GetOptions{})
+	assert.True(apierrors.IsNotFound(err))
+	_, err = cli.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "webhook", metav1.GetOptions{})
+	assert.True(apierrors.IsNotFound(err))
+
+	// Deleting the missing configurations should not fail.
+	assert.NoError(r.Delete(ctx))
+}
+
+func TestNewReconciler(t *testing.T) {
+	tests := map[string]struct {
+		config registration.Config
+		expErr bool
+	}{
+		"Having a valid configuration, it should not fail.": {
+			config: registration.Config{Client: fake.NewSimpleClientset(), Name: "webhook", ServiceNamespace: "test", ServiceName: "webhook", Webhooks: []registration.Webhook{testMutating}},
+		},
+		"Having no service, it should fail.": {
+			config: registration.Config{Client: fake.NewSimpleClientset(), Name: "webhook"},
+			expErr: true,
+		},
+		"Having a webhook without path, it should fail.": {
+			config: registration.Config{Client: fake.NewSimpleClientset(), Name: "webhook", ServiceNamespace: "test", ServiceName: "webhook", Webhooks: []registration.Webhook{{Name: "allmark.bitteeinbit.dev"}}},
+			expErr: true,
+		},
+		"Having an invalid failure policy, it should fail.": {
+			config: registration.Config{Client: fake.NewSimpleClientset(), Name: "webhook", ServiceNamespace: "test", ServiceName: "webhook", Webhooks: []registration.Webhook{{Name: "allmark.bitteeinbit.dev", Path: "/wh/mutating/allmark", FailurePolicy: "Maybe"}}},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := registration.NewReconciler(test.config)
+			if test.expErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
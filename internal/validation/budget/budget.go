@@ -0,0 +1,313 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	autoscalingv2listers "k8s.io/client-go/listers/autoscaling/v2"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// Mode is how the budget violations are enforced.
+type Mode string
+
+const (
+	// ModeDeny rejects the resources that exceed the budget.
+	ModeDeny Mode = "deny"
+	// ModeWarn admits the resources that exceed the budget returning warnings.
+	ModeWarn Mode = "warn"
+)
+
+const (
+	kindDeployment  = "Deployment"
+	kindStatefulSet = "StatefulSet"
+)
+
+// ParseBudget parses a budget in the `cpu=10,memory=20Gi` format.
+func ParseBudget(s string) (corev1.ResourceList, error) {
+	budget := corev1.ResourceList{}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid budget %q, must be in resource=quantity format", kv)
+		}
+
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q budget quantity %q: %w", k, v, err)
+		}
+		budget[corev1.ResourceName(k)] = q
+	}
+
+	return budget, nil
+}
+
+// Result is the result of a budget check.
+type Result struct {
+	// Violations are the human readable budget violations, empty if the budget is respected.
+	Violations []string
+	// Mode is how the violations should be enforced.
+	Mode Mode
+}
+
+// Checker knows how to check the scaled out requests of Kubernetes workloads fit on the namespace budget.
+type Checker interface {
+	// CheckBudget checks a workload.
+	CheckBudget(ctx context.Context, obj metav1.Object) (*Result, error)
+	// CheckScale checks a scale subresource update of a workload resource (e.g `deployments`).
+	CheckScale(ctx context.Context, resourceName string, scale *autoscalingv1.Scale) (*Result, error)
+}
+
+// Config is the configuration of the budget checker.
+type Config struct {
+	// Default is the budget of the namespaces without a specific one, empty means no budget.
+	Default corev1.ResourceList
+	// Namespaces are the budgets of specific namespaces, they replace the default one.
+	Namespaces map[string]corev1.ResourceList
+	// Mode is how the violations are enforced, by default ModeDeny.
+	Mode Mode
+	// DeploymentLister is used to get the other deployments of the namespace.
+	DeploymentLister appsv1listers.DeploymentLister
+	// StatefulSetLister is used to get the other statefulsets of the namespace.
+	StatefulSetLister appsv1listers.StatefulSetLister
+	// HPALister is used to get the maximum replicas of the autoscaled workloads.
+	HPALister autoscalingv2listers.HorizontalPodAutoscalerLister
+}
+
+func (c *Config) defaults() error {
+	if c.DeploymentLister == nil {
+		return fmt.Errorf("deployment lister is required")
+	}
+
+	if c.StatefulSetLister == nil {
+		return fmt.Errorf("statefulset lister is required")
+	}
+
+	if c.HPALister == nil {
+		return fmt.Errorf("hpa lister is required")
+	}
+
+	if c.Mode == "" {
+		c.Mode = ModeDeny
+	}
+
+	if c.Mode != ModeDeny && c.Mode != ModeWarn {
+		return fmt.Errorf("invalid mode %q, must be %q or %q", c.Mode, ModeDeny, ModeWarn)
+	}
+
+	return nil
+}
+
+// NewBudgetChecker returns a new checker that will multiply the per pod requests by the replicas,
+// or the maximum replicas of a matching HorizontalPodAutoscaler, and compare the namespace total
+// with the namespace budget.
+func NewBudgetChecker(config Config) (Checker, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return budgetchecker{cfg: config}, nil
+}
+
+type budgetchecker struct {
+	cfg Config
+}
+
+// scaledWorkload is a workload at its maximum scale.
+type scaledWorkload struct {
+	requests corev1.ResourceList
+	replicas int32
+}
+
+func (b budgetchecker) CheckBudget(ctx context.Context, obj metav1.Object) (*Result, error) {
+	var kind string
+	var replicas *int32
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		kind, replicas = kindDeployment, o.Spec.Replicas
+	case *appsv1.StatefulSet:
+		kind, replicas = kindStatefulSet, o.Spec.Replicas
+	default:
+		return nil, workload.ErrNotSupported(obj)
+	}
+
+	spec, err := workload.PodSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.check(ctx, obj.GetNamespace(), kind, obj.GetName(), spec, replicas)
+}
+
+func (b budgetchecker) CheckScale(ctx context.Context, resourceName string, scale *autoscalingv1.Scale) (*Result, error) {
+	var kind string
+	var spec *corev1.PodSpec
+	switch resourceName {
+	case "deployments":
+		d, err := b.cfg.DeploymentLister.Deployments(scale.Namespace).Get(scale.Name)
+		if err != nil {
+			return nil, fmt.Errorf("could not get %s deployment: %w", scale.Name, err)
+		}
+		kind, spec = kindDeployment, &d.Spec.Template.Spec
+	case "statefulsets":
+		s, err := b.cfg.StatefulSetLister.StatefulSets(scale.Namespace).Get(scale.Name)
+		if err != nil {
+			return nil, fmt.Errorf("could not get %s statefulset: %w", scale.Name, err)
+		}
+		kind, spec = kindStatefulSet, &s.Spec.Template.Spec
+	default:
+		return nil, fmt.Errorf("scale of %s is not supported", resourceName)
+	}
+
+	replicas := scale.Spec.Replicas
+	return b.check(ctx, scale.Namespace, kind, scale.Name, spec, &replicas)
+}
+
+func (b budgetchecker) budget(namespace string) corev1.ResourceList {
+	if nsb, ok := b.cfg.Namespaces[namespace]; ok {
+		return nsb
+	}
+	return b.cfg.Default
+}
+
+func (b budgetchecker) check(_ context.Context, namespace, kind, name string, spec *corev1.PodSpec, replicas *int32) (*Result, error) {
+	res := &Result{Mode: b.cfg.Mode}
+	budget := b.budget(namespace)
+	if len(budget) == 0 {
+		return res, nil
+	}
+
+	target, err := b.scaled(namespace, kind, name, spec, replicas)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the rest of the namespace workloads at their maximum scale, and the stored target workload.
+	workloads := []scaledWorkload{target}
+	var stored *scaledWorkload
+	deployments, err := b.cfg.DeploymentLister.Deployments(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("could not list deployments: %w", err)
+	}
+	for _, d := range deployments {
+		w, err := b.scaled(namespace, kindDeployment, d.Name, &d.Spec.Template.Spec, d.Spec.Replicas)
+		if err != nil {
+			return nil, err
+		}
+		if kind == kindDeployment && d.Name == name {
+			stored = &w
+			continue
+		}
+		workloads = append(workloads, w)
+	}
+
+	statefulSets, err := b.cfg.StatefulSetLister.StatefulSets(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("could not list statefulsets: %w", err)
+	}
+	for _, s := range statefulSets {
+		w, err := b.scaled(namespace, kindStatefulSet, s.Name, &s.Spec.Template.Spec, s.Spec.Replicas)
+		if err != nil {
+			return nil, err
+		}
+		if kind == kindStatefulSet && s.Name == name {
+			stored = &w
+			continue
+		}
+		workloads = append(workloads, w)
+	}
+
+	total := corev1.ResourceList{}
+	for _, w := range workloads {
+		for rName, q := range w.requests {
+			t := total[rName]
+			t.Add(multiply(q, w.replicas))
+			total[rName] = t
+		}
+	}
+
+	rNames := make([]string, 0, len(budget))
+	for rName := range budget {
+		rNames = append(rNames, string(rName))
+	}
+	sort.Strings(rNames)
+
+	for _, rName := range rNames {
+		limit := budget[corev1.ResourceName(rName)]
+		t := total[corev1.ResourceName(rName)]
+		if t.Cmp(limit) <= 0 {
+			continue
+		}
+
+		// A namespace over budget can always shrink, only the workloads growing its total are violations.
+		q := multiply(target.requests[corev1.ResourceName(rName)], target.replicas)
+		if stored != nil {
+			storedQ := multiply(stored.requests[corev1.ResourceName(rName)], stored.replicas)
+			if q.Cmp(storedQ) <= 0 {
+				continue
+			}
+		}
+		res.Violations = append(res.Violations, fmt.Sprintf("namespace %q %s budget %s exceeded with %s, %s %q requests %s at %d replicas",
+			namespace, rName, limit.String(), t.String(), strings.ToLower(kind), name, q.String(), target.replicas))
+	}
+
+	return res, nil
+}
+
+// scaled returns the workload at its maximum scale, this is the replicas or the maximum replicas of the
+// HorizontalPodAutoscaler targeting the workload if greater.
+func (b budgetchecker) scaled(namespace, kind, name string, spec *corev1.PodSpec, replicas *int32) (scaledWorkload, error) {
+	w := scaledWorkload{
+		requests: workload.PodRequests(spec),
+		replicas: 1,
+	}
+	if replicas != nil {
+		w.replicas = *replicas
+	}
+
+	hpas, err := b.cfg.HPALister.HorizontalPodAutoscalers(namespace).List(labels.Everything())
+	if err != nil {
+		return scaledWorkload{}, fmt.Errorf("could not list horizontal pod autoscalers: %w", err)
+	}
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		if ref.Kind == kind && ref.Name == name && hpa.Spec.MaxReplicas > w.replicas {
+			w.replicas = hpa.Spec.MaxReplicas
+		}
+	}
+
+	return w, nil
+}
+
+func multiply(q resource.Quantity, n int32) resource.Quantity {
+	return *resource.NewMilliQuantity(q.MilliValue()*int64(n), q.Format)
+}
+
+// DummyChecker is a checker that doesn't do anything.
+var DummyChecker Checker = dummyChecker(0)
+
+type dummyChecker int
+
+func (dummyChecker) CheckBudget(_ context.Context, _ metav1.Object) (*Result, error) {
+	return &Result{Mode: ModeWarn}, nil
+}
+
+func (dummyChecker) CheckScale(_ context.Context, _ string, _ *autoscalingv1.Scale) (*Result, error) {
+	return &Result{Mode: ModeWarn}, nil
+}
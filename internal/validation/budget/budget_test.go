@@ -0,0 +1,251 @@
+package budget_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/budget"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func newTemplate(mem string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "test",
+					Image: "busybox",
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(mem)},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newDeployment(name string, replicas int32, mem string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(replicas),
+			Template: newTemplate(mem),
+		},
+	}
+}
+
+func newStatefulSet(name string, replicas int32, mem string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: int32Ptr(replicas),
+			Template: newTemplate(mem),
+		},
+	}
+}
+
+func newHPA(kind, name string, maxReplicas int32) *autoscalingv2.HorizontalPodAutoscaler {
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: kind, Name: name},
+			MaxReplicas:    maxReplicas,
+		},
+	}
+}
+
+func newChecker(ctx context.Context, t *testing.T, cfg budget.Config, objs ...runtime.Object) budget.Checker {
+	cli := fake.NewSimpleClientset(objs...)
+	factory := informers.NewSharedInformerFactory(cli, 0)
+	cfg.DeploymentLister = factory.Apps().V1().Deployments().Lister()
+	cfg.StatefulSetLister = factory.Apps().V1().StatefulSets().Lister()
+	cfg.HPALister = factory.Autoscaling().V2().HorizontalPodAutoscalers().Lister()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	c, err := budget.NewBudgetChecker(cfg)
+	require.NoError(t, err)
+
+	return c
+}
+
+func mustBudget(s string) corev1.ResourceList {
+	b, err := budget.ParseBudget(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestBudgetCheckerCheckBudget(t *testing.T) {
+	tests := map[string]struct {
+		config        budget.Config
+		objs          []runtime.Object
+		obj           metav1.Object
+		expViolations []string
+		expErr        bool
+	}{
+		"Having no budget, it should be valid.": {
+			config: budget.Config{},
+			obj:    newDeployment("web", 100, "1Gi"),
+		},
+		"Having a deployment inside the budget, it should be valid.": {
+			config: budget.Config{Default: mustBudget("memory=4Gi")},
+			obj:    newDeployment("web", 4, "1Gi"),
+		},
+		"Having a deployment exceeding the budget, it should be invalid.": {
+			config:        budget.Config{Default: mustBudget("memory=4Gi")},
+			obj:           newDeployment("web", 5, "1Gi"),
+			expViolations: []string{`namespace "test" memory budget 4Gi exceeded with 5Gi, deployment "web" requests 5Gi at 5 replicas`},
+		},
+		"Having a deployment with an HPA, the maximum replicas should be used.": {
+			config: budget.Config{Default: mustBudget("memory=4Gi")},
+			objs: []runtime.Object{
+				newHPA("Deployment", "web", 8),
+			},
+			obj:           newDeployment("web", 2, "1Gi"),
+			expViolations: []string{`namespace "test" memory budget 4Gi exceeded with 8Gi, deployment "web" requests 8Gi at 8 replicas`},
+		},
+		"Having other workloads on the namespace, they should be added.": {
+			config: budget.Config{Default: mustBudget("memory=4Gi")},
+			objs: []runtime.Object{
+				newStatefulSet("db", 2, "1Gi"),
+				newDeployment("web", 1, "1Gi"),
+			},
+			obj:           newDeployment("web", 3, "1Gi"),
+			expViolations: []string{`namespace "test" memory budget 4Gi exceeded with 5Gi, deployment "web" requests 3Gi at 3 replicas`},
+		},
+		"Having a namespace over budget, scaling down is allowed.": {
+			config: budget.Config{Default: mustBudget("memory=4Gi")},
+			objs: []runtime.Object{
+				newStatefulSet("db", 2, "1Gi"),
+				newDeployment("web", 10, "1Gi"),
+			},
+			obj: newDeployment("web", 3, "1Gi"),
+		},
+		"Having a namespace over budget, reducing the requests is allowed.": {
+			config: budget.Config{Default: mustBudget("memory=4Gi")},
+			objs: []runtime.Object{
+				newDeployment("web", 6, "1Gi"),
+			},
+			obj: newDeployment("web", 6, "768Mi"),
+		},
+		"Having a namespace over budget, an unchanged workload should be allowed.": {
+			config: budget.Config{Default: mustBudget("memory=4Gi")},
+			objs: []runtime.Object{
+				newDeployment("web", 6, "1Gi"),
+			},
+			obj: newDeployment("web", 6, "1Gi"),
+		},
+		"Having a namespace budget, it should replace the default one.": {
+			config: budget.Config{
+				Default:    mustBudget("memory=4Gi"),
+				Namespaces: map[string]corev1.ResourceList{"test": mustBudget("memory=10Gi")},
+			},
+			obj: newStatefulSet("db", 5, "1Gi"),
+		},
+		"Unsupported object": {
+			config: budget.Config{Default: mustBudget("memory=4Gi")},
+			obj:    &corev1.Pod{},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			c := newChecker(ctx, t, test.config, test.objs...)
+
+			res, err := c.CheckBudget(ctx, test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expViolations, res.Violations)
+		})
+	}
+}
+
+func TestBudgetCheckerCheckScale(t *testing.T) {
+	tests := map[string]struct {
+		objs          []runtime.Object
+		resource      string
+		scale         *autoscalingv1.Scale
+		expViolations []string
+		expErr        bool
+	}{
+		"Scaling a deployment inside the budget, it should be valid.": {
+			objs:     []runtime.Object{newDeployment("web", 1, "1Gi")},
+			resource: "deployments",
+			scale: &autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test"},
+				Spec:       autoscalingv1.ScaleSpec{Replicas: 4},
+			},
+		},
+		"Scaling a statefulset over the budget, it should be invalid.": {
+			objs:     []runtime.Object{newStatefulSet("db", 1, "1Gi")},
+			resource: "statefulsets",
+			scale: &autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "test"},
+				Spec:       autoscalingv1.ScaleSpec{Replicas: 6},
+			},
+			expViolations: []string{`namespace "test" memory budget 4Gi exceeded with 6Gi, statefulset "db" requests 6Gi at 6 replicas`},
+		},
+		"Scaling down a deployment over the budget, it should be valid.": {
+			objs:     []runtime.Object{newDeployment("web", 8, "1Gi")},
+			resource: "deployments",
+			scale: &autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test"},
+				Spec:       autoscalingv1.ScaleSpec{Replicas: 6},
+			},
+		},
+		"Scaling a missing deployment, it should fail.": {
+			resource: "deployments",
+			scale: &autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test"},
+			},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			c := newChecker(ctx, t, budget.Config{Default: mustBudget("memory=4Gi")}, test.objs...)
+
+			res, err := c.CheckScale(ctx, test.resource, test.scale)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expViolations, res.Violations)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package cpu
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// Mode is how the violations of the bounds are enforced.
+type Mode string
+
+const (
+	// ModeDeny rejects the resources that violate the bounds.
+	ModeDeny Mode = "deny"
+	// ModeWarn admits the resources that violate the bounds returning warnings.
+	ModeWarn Mode = "warn"
+)
+
+// Bounds are the CPU constraints every container must satisfy.
+type Bounds struct {
+	// MaxLimitRequestRatio is the maximum CPU limit to request ratio, 0 disables the check.
+	MaxLimitRequestRatio float64
+	// Min is the minimum CPU request, nil disables the check.
+	Min *resource.Quantity
+	// Max is the maximum CPU limit, nil disables the check.
+	Max *resource.Quantity
+	// Mode is how the violations are enforced, by default ModeDeny.
+	Mode Mode
+}
+
+// ParseBounds parses bounds in the `ratio=4,min=100m,max=2,mode=warn` format, all keys are optional.
+func ParseBounds(s string) (Bounds, error) {
+	b := Bounds{Mode: ModeDeny}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return Bounds{}, fmt.Errorf("invalid bound %q, must be in key=value format", kv)
+		}
+
+		switch k {
+		case "ratio":
+			ratio, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return Bounds{}, fmt.Errorf("invalid ratio %q: %w", v, err)
+			}
+			b.MaxLimitRequestRatio = ratio
+		case "min":
+			q, err := resource.ParseQuantity(v)
+			if err != nil {
+				return Bounds{}, fmt.Errorf("invalid min %q: %w", v, err)
+			}
+			b.Min = &q
+		case "max":
+			q, err := resource.ParseQuantity(v)
+			if err != nil {
+				return Bounds{}, fmt.Errorf("invalid max %q: %w", v, err)
+			}
+			b.Max = &q
+		case "mode":
+			b.Mode = Mode(v)
+		default:
+			return Bounds{}, fmt.Errorf("unknown bound %q", k)
+		}
+	}
+
+	return b, b.validate()
+}
+
+func (b Bounds) validate() error {
+	if b.Mode != ModeDeny && b.Mode != ModeWarn {
+		return fmt.Errorf("invalid mode %q, must be %q or %q", b.Mode, ModeDeny, ModeWarn)
+	}
+
+	if b.MaxLimitRequestRatio != 0 && b.MaxLimitRequestRatio < 1 {
+		return fmt.Errorf("ratio must be greater or equal than 1")
+	}
+
+	if b.Min != nil && b.Max != nil && b.Min.Cmp(*b.Max) > 0 {
+		return fmt.Errorf("min %s is greater than max %s", b.Min, b.Max)
+	}
+
+	return nil
+}
+
+// Config is the configuration of the bounds validator.
+type Config struct {
+	// Default are the bounds used when the namespace doesn't have specific ones.
+	Default Bounds
+	// Namespaces are the bounds for specific namespaces, they replace the default ones.
+	Namespaces map[string]Bounds
+}
+
+func (c *Config) defaults() error {
+	if c.Default.Mode == "" {
+		c.Default.Mode = ModeDeny
+	}
+
+	err := c.Default.validate()
+	if err != nil {
+		return fmt.Errorf("invalid default bounds: %w", err)
+	}
+
+	for ns, b := range c.Namespaces {
+		if b.Mode == "" {
+			b.Mode = ModeDeny
+			c.Namespaces[ns] = b
+		}
+
+		err := b.validate()
+		if err != nil {
+			return fmt.Errorf("invalid %q namespace bounds: %w", ns, err)
+		}
+	}
+
+	return nil
+}
+
+// Result is the result of a CPU validation.
+type Result struct {
+	// Violations are the human readable bound violations, empty if valid.
+	Violations []string
+	// Mode is how the violations should be enforced.
+	Mode Mode
+}
+
+// Validator knows how to validate the CPU resources of Kubernetes resources.
+type Validator interface {
+	ValidateCPU(ctx context.Context, obj metav1.Object) (*Result, error)
+}
+
+// NewBoundsValidator returns a new validator that will check the CPU resources are inside the bounds.
+func NewBoundsValidator(config Config) (Validator, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return boundsvalidator{cfg: config}, nil
+}
+
+type boundsvalidator struct {
+	cfg Config
+}
+
+func (b boundsvalidator) bounds(namespace string) Bounds {
+	if nsb, ok := b.cfg.Namespaces[namespace]; ok {
+		return nsb
+	}
+	return b.cfg.Default
+}
+
+func (b boundsvalidator) validateContainer(bounds Bounds, c corev1.Container) []string {
+	var violations []string
+
+	limit := c.Resources.Limits.Cpu()
+	request := c.Resources.Requests.Cpu()
+	// Kubernetes defaults the request to the limit when only the limit is set.
+	if request.IsZero() {
+		request = limit
+	}
+
+	if bounds.MaxLimitRequestRatio != 0 && !limit.IsZero() && !request.IsZero() {
+		ratio := float64(limit.MilliValue()) / float64(request.MilliValue())
+		if ratio > bounds.MaxLimitRequestRatio {
+			violations = append(violations, fmt.Sprintf("container %q cpu limit to request ratio %.2f is greater than %.2f", c.Name, ratio, bounds.MaxLimitRequestRatio))
+		}
+	}
+
+	if bounds.Min != nil && request.Cmp(*bounds.Min) < 0 {
+		violations = append(violations, fmt.Sprintf("container %q cpu request %s is less than %s", c.Name, request, bounds.Min))
+	}
+
+	if bounds.Max != nil {
+		if limit.Cmp(*bounds.Max) > 0 {
+			violations = append(violations, fmt.Sprintf("container %q cpu limit %s is greater than %s", c.Name, limit, bounds.Max))
+		} else if request.Cmp(*bounds.Max) > 0 {
+			violations = append(violations, fmt.Sprintf("container %q cpu request %s is greater than %s", c.Name, request, bounds.Max))
+		}
+	}
+
+	return violations
+}
+
+func (b boundsvalidator) ValidateCPU(_ context.Context, obj metav1.Object) (*Result, error) {
+	spec, err := workload.PodSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := b.bounds(obj.GetNamespace())
+	res := &Result{Mode: bounds.Mode}
+	for _, c := range spec.InitContainers {
+		res.Violations = append(res.Violations, b.validateContainer(bounds, c)...)
+	}
+	for _, c := range spec.Containers {
+		res.Violations = append(res.Violations, b.validateContainer(bounds, c)...)
+	}
+
+	return res, nil
+}
+
+// DummyValidator is a validator that doesn't do anything.
+var DummyValidator Validator = dummyValidator(0)
+
+type dummyValidator int
+
+func (dummyValidator) ValidateCPU(_ context.Context, _ metav1.Object) (*Result, error) {
+	return &Result{Mode: ModeWarn}, nil
+}
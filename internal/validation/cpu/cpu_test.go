@@ -0,0 +1,194 @@
+package cpu_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/cpu"
+)
+
+func newPod(ns string, limit, request string) *corev1.Pod {
+	res := corev1.ResourceRequirements{}
+	if limit != "" {
+		res.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(limit)}
+	}
+	if request != "" {
+		res.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(request)}
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: ns},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "test", Image: "busybox", Resources: res}},
+		},
+	}
+}
+
+func mustBounds(s string) cpu.Bounds {
+	b, err := cpu.ParseBounds(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestParseBounds(t *testing.T) {
+	tests := map[string]struct {
+		bounds   string
+		expRatio float64
+		expMin   string
+		expMax   string
+		expMode  cpu.Mode
+		expErr   bool
+	}{
+		"Having all the bounds, they should be parsed.": {
+			bounds:   "ratio=4,min=100m,max=2,mode=warn",
+			expRatio: 4,
+			expMin:   "100m",
+			expMax:   "2",
+			expMode:  cpu.ModeWarn,
+		},
+		"Having no bounds, the mode should be deny.": {
+			bounds:  "",
+			expMode: cpu.ModeDeny,
+		},
+		"Having an unknown key, it should fail.": {
+			bounds: "foo=1",
+			expErr: true,
+		},
+		"Having an invalid quantity, it should fail.": {
+			bounds: "min=abc",
+			expErr: true,
+		},
+		"Having min greater than max, it should fail.": {
+			bounds: "min=2,max=1",
+			expErr: true,
+		},
+		"Having a ratio less than 1, it should fail.": {
+			bounds: "ratio=0.5",
+			expErr: true,
+		},
+		"Having an invalid mode, it should fail.": {
+			bounds: "mode=audit",
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			b, err := cpu.ParseBounds(test.bounds)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expRatio, b.MaxLimitRequestRatio)
+			assert.Equal(test.expMode, b.Mode)
+			if test.expMin != "" {
+				assert.Equal(test.expMin, b.Min.String())
+			}
+			if test.expMax != "" {
+				assert.Equal(test.expMax, b.Max.String())
+			}
+		})
+	}
+}
+
+func TestBoundsValidator(t *testing.T) {
+	tests := map[string]struct {
+		config        cpu.Config
+		obj           metav1.Object
+		expViolations []string
+		expMode       cpu.Mode
+		expErr        bool
+	}{
+		"Having a pod inside the bounds, it should be valid.": {
+			config:  cpu.Config{Default: mustBounds("ratio=4,min=100m,max=2")},
+			obj:     newPod("default", "1", "500m"),
+			expMode: cpu.ModeDeny,
+		},
+		"Having a pod exceeding the ratio, it should be invalid.": {
+			config:        cpu.Config{Default: mustBounds("ratio=4")},
+			obj:           newPod("default", "2", "100m"),
+			expViolations: []string{`container "test" cpu limit to request ratio 20.00 is greater than 4.00`},
+			expMode:       cpu.ModeDeny,
+		},
+		"Having a pod without limit, the ratio should not be checked.": {
+			config:  cpu.Config{Default: mustBounds("ratio=4")},
+			obj:     newPod("default", "", "100m"),
+			expMode: cpu.ModeDeny,
+		},
+		"Having a pod below the minimum, it should be invalid.": {
+			config:        cpu.Config{Default: mustBounds("min=100m")},
+			obj:           newPod("default", "", "50m"),
+			expViolations: []string{`container "test" cpu request 50m is less than 100m`},
+			expMode:       cpu.ModeDeny,
+		},
+		"Having a pod with only limit, the request should be defaulted to the limit.": {
+			config:  cpu.Config{Default: mustBounds("min=100m")},
+			obj:     newPod("default", "200m", ""),
+			expMode: cpu.ModeDeny,
+		},
+		"Having a pod over the maximum, it should be invalid.": {
+			config:        cpu.Config{Default: mustBounds("max=1")},
+			obj:           newPod("default", "2", "500m"),
+			expViolations: []string{`container "test" cpu limit 2 is greater than 1`},
+			expMode:       cpu.ModeDeny,
+		},
+		"Having a pod on a namespace with specific bounds, the namespace bounds should be used.": {
+			config: cpu.Config{
+				Default:    mustBounds("ratio=2"),
+				Namespaces: map[string]cpu.Bounds{"team-a": mustBounds("ratio=10,mode=warn")},
+			},
+			obj:     newPod("team-a", "2", "500m"),
+			expMode: cpu.ModeWarn,
+		},
+		"Having a deployment, the template containers should be validated.": {
+			config: cpu.Config{Default: mustBounds("min=100m,mode=warn")},
+			obj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{Spec: newPod("", "", "10m").Spec},
+				},
+			},
+			expViolations: []string{`container "test" cpu request 10m is less than 100m`},
+			expMode:       cpu.ModeWarn,
+		},
+		"Unsupported object": {
+			config: cpu.Config{Default: mustBounds("min=100m")},
+			obj:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			v, err := cpu.NewBoundsValidator(test.config)
+			require.NoError(err)
+
+			res, err := v.ValidateCPU(context.TODO(), test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expViolations, res.Violations)
+			assert.Equal(test.expMode, res.Mode)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package level
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// Level is how strict the sizing of the namespace resources is, every level includes the previous ones.
+type Level string
+
+const (
+	// LevelNone doesn't check the resources.
+	LevelNone Level = "none"
+	// LevelBounded requires the CPU and memory requests and the memory limit on every container.
+	LevelBounded Level = "bounded"
+	// LevelGuaranteed also requires the memory requests to be equal to the limits.
+	LevelGuaranteed Level = "guaranteed"
+)
+
+// Mode is how the violations of a level are handled, every mode is set with its own namespace label.
+type Mode string
+
+const (
+	// ModeEnforce rejects the resources that violate the level.
+	ModeEnforce Mode = "enforce"
+	// ModeWarn admits the resources that violate the level returning warnings.
+	ModeWarn Mode = "warn"
+	// ModeAudit admits the resources that violate the level, only logging and recording them.
+	ModeAudit Mode = "audit"
+)
+
+// Modes are all the modes, in the order they are checked.
+var Modes = []Mode{ModeEnforce, ModeWarn, ModeAudit}
+
+// LabelPrefix is the prefix of the namespace labels, e.g `sizing.bitteeinbit.dev/enforce: guaranteed`.
+const LabelPrefix = "sizing.bitteeinbit.dev/"
+
+// Label returns the namespace label of the mode.
+func Label(m Mode) string {
+	return LabelPrefix + string(m)
+}
+
+// Result is the result of a level check.
+type Result struct {
+	// Levels are the levels of the namespace by mode, the modes without label are missing.
+	Levels map[Mode]Level
+	// Violations are the human readable level violations by mode, empty if valid.
+	Violations map[Mode][]string
+}
+
+// Checker knows how to check the Kubernetes resources satisfy the sizing levels of their namespace.
+type Checker interface {
+	CheckLevels(ctx context.Context, obj metav1.Object) (*Result, error)
+}
+
+// MetricsRecorder knows how to record the level violations.
+type MetricsRecorder interface {
+	IncLevelViolation(mode, level string)
+}
+
+// DummyMetricsRecorder is a metrics recorder that doesn't record anything.
+var DummyMetricsRecorder MetricsRecorder = dummyMetricsRecorder(0)
+
+type dummyMetricsRecorder int
+
+func (dummyMetricsRecorder) IncLevelViolation(_, _ string) {}
+
+// Config is the configuration of the level checker.
+type Config struct {
+	// NamespaceLister is used to get the namespace labels, normally backed by an informer cache.
+	NamespaceLister corev1listers.NamespaceLister
+	// MetricsRecorder records the violations.
+	MetricsRecorder MetricsRecorder
+}
+
+func (c *Config) defaults() error {
+	if c.NamespaceLister == nil {
+		return fmt.Errorf("namespace lister is required")
+	}
+
+	if c.MetricsRecorder == nil {
+		c.MetricsRecorder = DummyMetricsRecorder
+	}
+
+	return nil
+}
+
+// NewLevelChecker returns a new checker that will check the resources with the levels set on the labels
+// of their namespace. Like the Pod Security Admission, an invalid level is checked as the strictest one.
+func NewLevelChecker(config Config) (Checker, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return levelchecker{cfg: config}, nil
+}
+
+type levelchecker struct {
+	cfg Config
+}
+
+func (l levelchecker) CheckLevels(_ context.Context, obj metav1.Object) (*Result, error) {
+	spec, err := workload.PodSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	ns, err := l.cfg.NamespaceLister.Get(obj.GetNamespace())
+	if err != nil {
+		return nil, fmt.Errorf("could not get %s namespace: %w", obj.GetNamespace(), err)
+	}
+
+	res := &Result{Levels: map[Mode]Level{}, Violations: map[Mode][]string{}}
+	for _, m := range Modes {
+		v, ok := ns.Labels[Label(m)]
+		if !ok {
+			continue
+		}
+
+		lvl := Level(v)
+		res.Levels[m] = lvl
+		violations := checkLevel(lvl, spec)
+		if len(violations) == 0 {
+			continue
+		}
+
+		res.Violations[m] = violations
+		l.cfg.MetricsRecorder.IncLevelViolation(string(m), v)
+	}
+
+	return res, nil
+}
+
+func checkLevel(lvl Level, spec *corev1.PodSpec) []string {
+	switch lvl {
+	case LevelNone:
+		return nil
+	case LevelBounded, LevelGuaranteed:
+	default:
+		// Unknown levels are checked as the strictest one, so a typo doesn't disable the checks.
+		lvl = LevelGuaranteed
+	}
+
+	var violations []string
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, v := range checkContainer(lvl, c) {
+			violations = append(violations, fmt.Sprintf("violates %q sizing level: container %q %s", lvl, c.Name, v))
+		}
+	}
+
+	return violations
+}
+
+func checkContainer(lvl Level, c corev1.Container) []string {
+	var violations []string
+
+	// Kubernetes defaults the requests to the limits when only the limits are set.
+	requests := c.Resources.Requests.DeepCopy()
+	for rName, q := range c.Resources.Limits {
+		if _, ok := requests[rName]; !ok {
+			if requests == nil {
+				requests = corev1.ResourceList{}
+			}
+			requests[rName] = q
+		}
+	}
+
+	if _, ok := requests[corev1.ResourceCPU]; !ok {
+		violations = append(violations, "doesn't have a cpu request")
+	}
+	if _, ok := requests[corev1.ResourceMemory]; !ok {
+		violations = append(violations, "doesn't have a memory request")
+	}
+	limit, hasLimit := c.Resources.Limits[corev1.ResourceMemory]
+	if !hasLimit {
+		violations = append(violations, "doesn't have a memory limit")
+	}
+
+	if lvl == LevelGuaranteed && hasLimit {
+		if request, ok := requests[corev1.ResourceMemory]; ok && request.Cmp(limit) != 0 {
+			violations = append(violations, fmt.Sprintf("memory request %s is not equal to the limit %s", request.String(), limit.String()))
+		}
+	}
+
+	return violations
+}
+
+// DummyChecker is a checker that doesn't do anything.
+var DummyChecker Checker = dummyChecker(0)
+
+type dummyChecker int
+
+func (dummyChecker) CheckLevels(_ context.Context, _ metav1.Object) (*Result, error) {
+	return &Result{}, nil
+}
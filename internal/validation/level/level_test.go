@@ -0,0 +1,174 @@
+package level_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/level"
+)
+
+func newNamespace(labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: labels}}
+}
+
+func newDeployment(requests, limits map[corev1.ResourceName]string) *appsv1.Deployment {
+	rl := func(m map[corev1.ResourceName]string) corev1.ResourceList {
+		if m == nil {
+			return nil
+		}
+		l := corev1.ResourceList{}
+		for k, v := range m {
+			l[k] = resource.MustParse(v)
+		}
+		return l
+	}
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:      "app",
+				Image:     "busybox",
+				Resources: corev1.ResourceRequirements{Requests: rl(requests), Limits: rl(limits)},
+			}}}},
+		},
+	}
+}
+
+type testMetricsRecorder struct {
+	violations []string
+}
+
+func (t *testMetricsRecorder) IncLevelViolation(mode, level string) {
+	t.violations = append(t.violations, mode+"/"+level)
+}
+
+func TestLevelChecker(t *testing.T) {
+	bounded := newDeployment(
+		map[corev1.ResourceName]string{corev1.ResourceCPU: "100m", corev1.ResourceMemory: "128Mi"},
+		map[corev1.ResourceName]string{corev1.ResourceMemory: "256Mi"},
+	)
+	guaranteed := newDeployment(
+		map[corev1.ResourceName]string{corev1.ResourceCPU: "100m"},
+		map[corev1.ResourceName]string{corev1.ResourceMemory: "256Mi"},
+	)
+
+	tests := map[string]struct {
+		namespace     *corev1.Namespace
+		obj           metav1.Object
+		expLevels     map[level.Mode]level.Level
+		expViolations map[level.Mode][]string
+		expMetrics    []string
+		expErr        bool
+	}{
+		"Having a namespace without labels, it should be valid.": {
+			namespace:     newNamespace(nil),
+			obj:           newDeployment(nil, nil),
+			expLevels:     map[level.Mode]level.Level{},
+			expViolations: map[level.Mode][]string{},
+		},
+		"Having a none level, it should be valid.": {
+			namespace:     newNamespace(map[string]string{"sizing.bitteeinbit.dev/enforce": "none"}),
+			obj:           newDeployment(nil, nil),
+			expLevels:     map[level.Mode]level.Level{level.ModeEnforce: level.LevelNone},
+			expViolations: map[level.Mode][]string{},
+		},
+		"Having a bounded level and a resource without resources, it should have violations.": {
+			namespace: newNamespace(map[string]string{"sizing.bitteeinbit.dev/enforce": "bounded"}),
+			obj:       newDeployment(nil, nil),
+			expLevels: map[level.Mode]level.Level{level.ModeEnforce: level.LevelBounded},
+			expViolations: map[level.Mode][]string{level.ModeEnforce: {
+				`violates "bounded" sizing level: container "app" doesn't have a cpu request`,
+				`violates "bounded" sizing level: container "app" doesn't have a memory request`,
+				`violates "bounded" sizing level: container "app" doesn't have a memory limit`,
+			}},
+			expMetrics: []string{"enforce/bounded"},
+		},
+		"Having a bounded level and a bounded resource, it should be valid.": {
+			namespace:     newNamespace(map[string]string{"sizing.bitteeinbit.dev/enforce": "bounded"}),
+			obj:           bounded,
+			expLevels:     map[level.Mode]level.Level{level.ModeEnforce: level.LevelBounded},
+			expViolations: map[level.Mode][]string{},
+		},
+		"Having a guaranteed level and a resource with the memory limit only, it should be valid.": {
+			namespace:     newNamespace(map[string]string{"sizing.bitteeinbit.dev/enforce": "guaranteed"}),
+			obj:           guaranteed,
+			expLevels:     map[level.Mode]level.Level{level.ModeEnforce: level.LevelGuaranteed},
+			expViolations: map[level.Mode][]string{},
+		},
+		"Having different levels by mode, each mode should have its violations.": {
+			namespace: newNamespace(map[string]string{
+				"sizing.bitteeinbit.dev/enforce": "bounded",
+				"sizing.bitteeinbit.dev/warn":    "guaranteed",
+				"sizing.bitteeinbit.dev/audit":   "guaranteed",
+			}),
+			obj: bounded,
+			expLevels: map[level.Mode]level.Level{
+				level.ModeEnforce: level.LevelBounded,
+				level.ModeWarn:    level.LevelGuaranteed,
+				level.ModeAudit:   level.LevelGuaranteed,
+			},
+			expViolations: map[level.Mode][]string{
+				level.ModeWarn:  {`violates "guaranteed" sizing level: container "app" memory request 128Mi is not equal to the limit 256Mi`},
+				level.ModeAudit: {`violates "guaranteed" sizing level: container "app" memory request 128Mi is not equal to the limit 256Mi`},
+			},
+			expMetrics: []string{"warn/guaranteed", "audit/guaranteed"},
+		},
+		"Having an unknown level, it should be checked as guaranteed.": {
+			namespace: newNamespace(map[string]string{"sizing.bitteeinbit.dev/enforce": "guaranted"}),
+			obj:       bounded,
+			expLevels: map[level.Mode]level.Level{level.ModeEnforce: "guaranted"},
+			expViolations: map[level.Mode][]string{
+				level.ModeEnforce: {`violates "guaranteed" sizing level: container "app" memory request 128Mi is not equal to the limit 256Mi`},
+			},
+			expMetrics: []string{"enforce/guaranted"},
+		},
+		"Having a missing namespace, it should fail.": {
+			obj:    bounded,
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cli := fake.NewSimpleClientset()
+			if test.namespace != nil {
+				cli = fake.NewSimpleClientset(test.namespace)
+			}
+			factory := informers.NewSharedInformerFactory(cli, 0)
+			nsLister := factory.Core().V1().Namespaces().Lister()
+			factory.Start(ctx.Done())
+			factory.WaitForCacheSync(ctx.Done())
+
+			metrics := &testMetricsRecorder{}
+			c, err := level.NewLevelChecker(level.Config{NamespaceLister: nsLister, MetricsRecorder: metrics})
+			require.NoError(err)
+
+			res, err := c.CheckLevels(ctx, test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expLevels, res.Levels)
+			assert.Equal(test.expViolations, res.Violations)
+			assert.Equal(test.expMetrics, metrics.violations)
+		})
+	}
+}
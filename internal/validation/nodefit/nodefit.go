@@ -0,0 +1,173 @@
+package nodefit
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+// Mode is how the pods that don't fit on any node are handled.
+type Mode string
+
+const (
+	// ModeDeny rejects the resources that don't fit.
+	ModeDeny Mode = "deny"
+	// ModeWarn admits the resources that don't fit returning warnings.
+	ModeWarn Mode = "warn"
+)
+
+// Result is the result of a node fit check.
+type Result struct {
+	// Violations are the human readable reasons the pod doesn't fit, empty if it fits.
+	Violations []string
+	// Mode is how the violations should be enforced.
+	Mode Mode
+}
+
+// Checker knows how to check if the pods of Kubernetes resources fit on the cluster nodes.
+type Checker interface {
+	CheckNodeFit(ctx context.Context, obj metav1.Object) (*Result, error)
+}
+
+// Config is the configuration of the node fit checker.
+type Config struct {
+	// NodeLister is used to get the cluster nodes, normally backed by an informer cache.
+	NodeLister corev1listers.NodeLister
+	// Mode is how the violations are enforced, by default ModeDeny.
+	Mode Mode
+}
+
+func (c *Config) defaults() error {
+	if c.NodeLister == nil {
+		return fmt.Errorf("node lister is required")
+	}
+
+	if c.Mode == "" {
+		c.Mode = ModeDeny
+	}
+
+	if c.Mode != ModeDeny && c.Mode != ModeWarn {
+		return fmt.Errorf("invalid mode %q, must be %q or %q", c.Mode, ModeDeny, ModeWarn)
+	}
+
+	return nil
+}
+
+// NewNodeFitChecker returns a new checker that will compare the effective pod requests
+// with the allocatable resources of the nodes the pod could be scheduled on.
+func NewNodeFitChecker(config Config) (Checker, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return nodefitchecker{cfg: config}, nil
+}
+
+type nodefitchecker struct {
+	cfg Config
+}
+
+func (n nodefitchecker) CheckNodeFit(_ context.Context, obj metav1.Object) (*Result, error) {
+	spec, err := workload.PodSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Mode: n.cfg.Mode}
+	requests := workload.PodRequests(spec)
+	if len(requests) == 0 {
+		return res, nil
+	}
+
+	nodes, err := n.cfg.NodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("could not list nodes: %w", err)
+	}
+
+	var candidates []*corev1.Node
+	for _, node := range nodes {
+		if schedulable(spec, node) {
+			candidates = append(candidates, node)
+		}
+	}
+
+	// Without candidates we can't tell anything, e.g. the cluster autoscaler could scale a node group from zero.
+	if len(candidates) == 0 {
+		return res, nil
+	}
+
+	largest := corev1.ResourceList{}
+	for _, node := range candidates {
+		if fits(requests, node.Status.Allocatable) {
+			return res, nil
+		}
+
+		for name, q := range node.Status.Allocatable {
+			if l, ok := largest[name]; !ok || q.Cmp(l) > 0 {
+				largest[name] = q
+			}
+		}
+	}
+
+	res.Violations = []string{fmt.Sprintf("pod requests %s don't fit on any of the %d matching nodes, largest allocatable is %s",
+		workload.FormatResources(requests, requests), len(candidates), workload.FormatResources(largest, requests))}
+
+	return res, nil
+}
+
+func fits(requests, allocatable corev1.ResourceList) bool {
+	for name, q := range requests {
+		a, ok := allocatable[name]
+		if !ok || q.Cmp(a) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// schedulable returns if the pod could be scheduled on the node based on the node selector and taints.
+func schedulable(spec *corev1.PodSpec, node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		tolerated := false
+		for j := range spec.Tolerations {
+			if spec.Tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DummyChecker is a checker that doesn't do anything.
+var DummyChecker Checker = dummyChecker(0)
+
+type dummyChecker int
+
+func (dummyChecker) CheckNodeFit(_ context.Context, _ metav1.Object) (*Result, error) {
+	return &Result{Mode: ModeWarn}, nil
+}
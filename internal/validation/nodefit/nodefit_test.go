@@ -0,0 +1,151 @@
+package nodefit_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/validation/nodefit"
+)
+
+func newNode(name string, labels map[string]string, taints []corev1.Taint, cpu, mem string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec:       corev1.NodeSpec{Taints: taints},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(mem),
+			},
+		},
+	}
+}
+
+func newPodSpec(mem string) corev1.PodSpec {
+	return corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name:  "test",
+				Image: "busybox",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(mem)},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(mem)},
+				},
+			},
+		},
+	}
+}
+
+var gpuTaint = corev1.Taint{Key: "gpu", Value: "true", Effect: corev1.TaintEffectNoSchedule}
+
+func TestNodeFitChecker(t *testing.T) {
+	tests := map[string]struct {
+		nodes         []runtime.Object
+		mode          nodefit.Mode
+		obj           metav1.Object
+		expViolations []string
+		expMode       nodefit.Mode
+		expErr        bool
+	}{
+		"Having a pod that fits on a node, it should be valid.": {
+			nodes: []runtime.Object{
+				newNode("n1", nil, nil, "2", "4Gi"),
+			},
+			obj:     &corev1.Pod{Spec: newPodSpec("2Gi")},
+			expMode: nodefit.ModeDeny,
+		},
+		"Having a pod bigger than any node, it should be invalid.": {
+			nodes: []runtime.Object{
+				newNode("n1", nil, nil, "2", "4Gi"),
+				newNode("n2", nil, nil, "2", "8Gi"),
+			},
+			obj:           &corev1.Pod{Spec: newPodSpec("16Gi")},
+			expViolations: []string{"pod requests memory=16Gi don't fit on any of the 2 matching nodes, largest allocatable is memory=8Gi"},
+			expMode:       nodefit.ModeDeny,
+		},
+		"Having a pod that only fits on a node not matching the node selector, it should be invalid.": {
+			nodes: []runtime.Object{
+				newNode("small", map[string]string{"pool": "small"}, nil, "2", "4Gi"),
+				newNode("big", map[string]string{"pool": "big"}, nil, "2", "64Gi"),
+			},
+			obj: &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: func() corev1.PodSpec {
+				s := newPodSpec("16Gi")
+				s.NodeSelector = map[string]string{"pool": "small"}
+				return s
+			}()}}},
+			expViolations: []string{"pod requests memory=16Gi don't fit on any of the 1 matching nodes, largest allocatable is memory=4Gi"},
+			expMode:       nodefit.ModeDeny,
+		},
+		"Having a pod that only fits on a tainted node without toleration, it should be invalid.": {
+			nodes: []runtime.Object{
+				newNode("small", nil, nil, "2", "4Gi"),
+				newNode("gpu", nil, []corev1.Taint{gpuTaint}, "2", "64Gi"),
+			},
+			mode:          nodefit.ModeWarn,
+			obj:           &corev1.Pod{Spec: newPodSpec("16Gi")},
+			expViolations: []string{"pod requests memory=16Gi don't fit on any of the 1 matching nodes, largest allocatable is memory=4Gi"},
+			expMode:       nodefit.ModeWarn,
+		},
+		"Having a pod that fits on a tainted node with toleration, it should be valid.": {
+			nodes: []runtime.Object{
+				newNode("small", nil, nil, "2", "4Gi"),
+				newNode("gpu", nil, []corev1.Taint{gpuTaint}, "2", "64Gi"),
+			},
+			obj: &corev1.Pod{Spec: func() corev1.PodSpec {
+				s := newPodSpec("16Gi")
+				s.Tolerations = []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists}}
+				return s
+			}()},
+			expMode: nodefit.ModeDeny,
+		},
+		"Having no matching nodes, it should be valid.": {
+			nodes: []runtime.Object{
+				newNode("gpu", nil, []corev1.Taint{gpuTaint}, "2", "4Gi"),
+			},
+			obj:     &corev1.Pod{Spec: newPodSpec("16Gi")},
+			expMode: nodefit.ModeDeny,
+		},
+		"Unsupported object": {
+			obj:    &corev1.Service{},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cli := fake.NewSimpleClientset(test.nodes...)
+			factory := informers.NewSharedInformerFactory(cli, 0)
+			nodeLister := factory.Core().V1().Nodes().Lister()
+			factory.Start(ctx.Done())
+			factory.WaitForCacheSync(ctx.Done())
+
+			c, err := nodefit.NewNodeFitChecker(nodefit.Config{NodeLister: nodeLister, Mode: test.mode})
+			require.NoError(err)
+
+			res, err := c.CheckNodeFit(ctx, test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expViolations, res.Violations)
+			assert.Equal(test.expMode, res.Mode)
+		})
+	}
+}
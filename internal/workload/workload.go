@@ -0,0 +1,192 @@
+package workload
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrNotSupported will be used when the object is not a supported workload.
+func ErrNotSupported(obj metav1.Object) error {
+	return fmt.Errorf("object %s is not supported", reflect.TypeOf(obj))
+}
+
+// PodSpec returns the pod spec of a workload, in case of a pod it will be its own spec.
+// The returned spec points to the object so it can be mutated in place.
+func PodSpec(obj metav1.Object) (*corev1.PodSpec, error) {
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return &o.Spec, nil
+	case *appsv1.ReplicaSet:
+		return &o.Spec.Template.Spec, nil
+	case *appsv1.Deployment:
+		return &o.Spec.Template.Spec, nil
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template.Spec, nil
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template.Spec, nil
+	case *batchv1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template.Spec, nil
+	case *batchv1beta1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template.Spec, nil
+	case *batchv1.Job:
+		return &o.Spec.Template.Spec, nil
+	}
+
+	return nil, ErrNotSupported(obj)
+}
+
+// PodTemplateMeta returns the pod template metadata of a workload, in case of a pod it will be its own metadata.
+// The returned metadata points to the object so it can be mutated in place.
+func PodTemplateMeta(obj metav1.Object) (*metav1.ObjectMeta, error) {
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return &o.ObjectMeta, nil
+	case *appsv1.ReplicaSet:
+		return &o.Spec.Template.ObjectMeta, nil
+	case *appsv1.Deployment:
+		return &o.Spec.Template.ObjectMeta, nil
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template.ObjectMeta, nil
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template.ObjectMeta, nil
+	case *batchv1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template.ObjectMeta, nil
+	case *batchv1beta1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template.ObjectMeta, nil
+	case *batchv1.Job:
+		return &o.Spec.Template.ObjectMeta, nil
+	}
+
+	return nil, ErrNotSupported(obj)
+}
+
+// PodSelector returns the selector of the pods of a workload, nil in case of a pod or a workload without selector.
+func PodSelector(obj metav1.Object) (*metav1.LabelSelector, error) {
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return nil, nil
+	case *appsv1.ReplicaSet:
+		return o.Spec.Selector, nil
+	case *appsv1.Deployment:
+		return o.Spec.Selector, nil
+	case *appsv1.DaemonSet:
+		return o.Spec.Selector, nil
+	case *appsv1.StatefulSet:
+		return o.Spec.Selector, nil
+	case *batchv1.CronJob:
+		return o.Spec.JobTemplate.Spec.Selector, nil
+	case *batchv1beta1.CronJob:
+		return o.Spec.JobTemplate.Spec.Selector, nil
+	case *batchv1.Job:
+		return o.Spec.Selector, nil
+	}
+
+	return nil, ErrNotSupported(obj)
+}
+
+// Kind returns the Kubernetes kind of a workload.
+func Kind(obj metav1.Object) (string, error) {
+	switch obj.(type) {
+	case *corev1.Pod:
+		return "Pod", nil
+	case *appsv1.ReplicaSet:
+		return "ReplicaSet", nil
+	case *appsv1.Deployment:
+		return "Deployment", nil
+	case *appsv1.DaemonSet:
+		return "DaemonSet", nil
+	case *appsv1.StatefulSet:
+		return "StatefulSet", nil
+	case *batchv1.CronJob, *batchv1beta1.CronJob:
+		return "CronJob", nil
+	case *batchv1.Job:
+		return "Job", nil
+	}
+
+	return "", ErrNotSupported(obj)
+}
+
+// Kinds are the supported workload kinds.
+var Kinds = []string{"Pod", "ReplicaSet", "Deployment", "DaemonSet", "StatefulSet", "CronJob", "Job"}
+
+// PodRequests returns the effective requests of a pod, this is the resources the scheduler
+// needs to find on a node: the containers and sidecars sum, or the biggest init container if
+// greater, plus the pod overhead.
+func PodRequests(spec *corev1.PodSpec) corev1.ResourceList {
+	reqs := corev1.ResourceList{}
+	for _, c := range spec.Containers {
+		addResources(reqs, c.Resources.Requests)
+	}
+
+	// Sidecars run along the containers, regular init containers run one by one before them.
+	sidecars := corev1.ResourceList{}
+	initPeak := corev1.ResourceList{}
+	for _, c := range spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			addResources(reqs, c.Resources.Requests)
+			addResources(sidecars, c.Resources.Requests)
+			continue
+		}
+
+		peak := corev1.ResourceList{}
+		addResources(peak, sidecars)
+		addResources(peak, c.Resources.Requests)
+		maxResources(initPeak, peak)
+	}
+	maxResources(reqs, initPeak)
+
+	addResources(reqs, spec.Overhead)
+
+	for name, q := range reqs {
+		if q.IsZero() {
+			delete(reqs, name)
+		}
+	}
+
+	return reqs
+}
+
+func addResources(dst, src corev1.ResourceList) {
+	for name, q := range src {
+		v := dst[name]
+		v.Add(q)
+		dst[name] = v
+	}
+}
+
+func maxResources(dst, src corev1.ResourceList) {
+	for name, q := range src {
+		if v, ok := dst[name]; !ok || q.Cmp(v) > 0 {
+			dst[name] = q
+		}
+	}
+}
+
+// FormatResources formats the resources of the list that are present on the filter in a stable way.
+func FormatResources(rl corev1.ResourceList, filter corev1.ResourceList) string {
+	names := make([]string, 0, len(filter))
+	for name := range filter {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		q, ok := rl[corev1.ResourceName(name)]
+		if !ok {
+			q = resource.Quantity{}
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", name, q.String()))
+	}
+
+	return strings.Join(parts, ",")
+}
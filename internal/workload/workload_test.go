@@ -0,0 +1,243 @@
+package workload_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bitte-ein-bit/k8s-sizing-webhook/internal/workload"
+)
+
+func TestPodSpec(t *testing.T) {
+	spec := corev1.PodSpec{Containers: []corev1.Container{{Name: "test", Image: "busybox"}}}
+
+	tests := map[string]struct {
+		obj     metav1.Object
+		expSpec *corev1.PodSpec
+		expErr  bool
+	}{
+		"Having a pod, its own spec should be returned.": {
+			obj:     &corev1.Pod{Spec: spec},
+			expSpec: &spec,
+		},
+		"Having a deployment, the template spec should be returned.": {
+			obj:     &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: spec}}},
+			expSpec: &spec,
+		},
+		"Having a cronjob, the job template spec should be returned.": {
+			obj: &batchv1.CronJob{Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: spec}},
+			}}},
+			expSpec: &spec,
+		},
+		"Unsupported object": {
+			obj:    &corev1.Service{},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gotSpec, err := workload.PodSpec(test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expSpec, gotSpec)
+		})
+	}
+}
+
+func TestPodTemplateMeta(t *testing.T) {
+	meta := metav1.ObjectMeta{Annotations: map[string]string{"sizing.bitteeinbit.dev/class": "m"}}
+
+	tests := map[string]struct {
+		obj     metav1.Object
+		expMeta *metav1.ObjectMeta
+		expErr  bool
+	}{
+		"Having a pod, its own metadata should be returned.": {
+			obj:     &corev1.Pod{ObjectMeta: meta},
+			expMeta: &meta,
+		},
+		"Having a deployment, the template metadata should be returned.": {
+			obj:     &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: meta}}},
+			expMeta: &meta,
+		},
+		"Having a cronjob, the job template metadata should be returned.": {
+			obj: &batchv1.CronJob{Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{ObjectMeta: meta}},
+			}}},
+			expMeta: &meta,
+		},
+		"Unsupported object": {
+			obj:    &corev1.Service{},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gotMeta, err := workload.PodTemplateMeta(test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expMeta, gotMeta)
+		})
+	}
+}
+
+func TestPodSelector(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+
+	tests := map[string]struct {
+		obj         metav1.Object
+		expSelector *metav1.LabelSelector
+		expErr      bool
+	}{
+		"Having a pod, no selector should be returned.": {
+			obj: &corev1.Pod{},
+		},
+		"Having a deployment, its selector should be returned.": {
+			obj:         &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Selector: selector}},
+			expSelector: selector,
+		},
+		"Having a cronjob, the job template selector should be returned.": {
+			obj: &batchv1.CronJob{Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{Selector: selector},
+			}}},
+			expSelector: selector,
+		},
+		"Unsupported object": {
+			obj:    &corev1.Service{},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gotSelector, err := workload.PodSelector(test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expSelector, gotSelector)
+		})
+	}
+}
+
+func TestKind(t *testing.T) {
+	tests := map[string]struct {
+		obj     metav1.Object
+		expKind string
+		expErr  bool
+	}{
+		"Having a pod, it should return its kind.": {
+			obj:     &corev1.Pod{},
+			expKind: "Pod",
+		},
+		"Having a statefulset, it should return its kind.": {
+			obj:     &appsv1.StatefulSet{},
+			expKind: "StatefulSet",
+		},
+		"Having a cronjob, it should return its kind.": {
+			obj:     &batchv1.CronJob{},
+			expKind: "CronJob",
+		},
+		"Unsupported object": {
+			obj:    &corev1.Service{},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gotKind, err := workload.Kind(test.obj)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			assert.Equal(test.expKind, gotKind)
+		})
+	}
+}
+
+func TestPodRequests(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	container := func(name, cpu string, restart *corev1.ContainerRestartPolicy) corev1.Container {
+		return corev1.Container{
+			Name:          name,
+			RestartPolicy: restart,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+			},
+		}
+	}
+
+	tests := map[string]struct {
+		spec   corev1.PodSpec
+		expCPU string
+	}{
+		"Having multiple containers, the requests should be added.": {
+			spec:   corev1.PodSpec{Containers: []corev1.Container{container("a", "100m", nil), container("b", "200m", nil)}},
+			expCPU: "300m",
+		},
+		"Having a bigger init container, the init container should be used.": {
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{container("init", "1", nil)},
+				Containers:     []corev1.Container{container("a", "100m", nil)},
+			},
+			expCPU: "1",
+		},
+		"Having a sidecar, it should be added to the containers.": {
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{container("sidecar", "50m", &always)},
+				Containers:     []corev1.Container{container("a", "100m", nil)},
+			},
+			expCPU: "150m",
+		},
+		"Having overhead, it should be added.": {
+			spec: corev1.PodSpec{
+				Overhead:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+				Containers: []corev1.Container{container("a", "100m", nil)},
+			},
+			expCPU: "350m",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			reqs := workload.PodRequests(&test.spec)
+			assert.Equal(test.expCPU, reqs.Cpu().String())
+		})
+	}
+}